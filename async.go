@@ -0,0 +1,245 @@
+package crawlab
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// BackpressureMode 队列满时的处理策略
+type BackpressureMode int
+
+const (
+	// BackpressureBlock 阻塞等待队列有空位（默认）
+	BackpressureBlock BackpressureMode = iota
+	// BackpressureDropOldest 丢弃队列里最老的一条，腾出位置
+	BackpressureDropOldest
+	// BackpressureError 直接返回ErrQueueFull
+	BackpressureError
+)
+
+var (
+	// ErrQueueFull 队列已满（BackpressureError模式）
+	ErrQueueFull = errors.New("item queue is full")
+	// ErrSinkClosed 异步队列已关闭
+	ErrSinkClosed = errors.New("async sink is closed")
+)
+
+// AsyncSink 异步数据队列
+//
+// 艹！Enqueue只是把数据丢进队列，后台goroutine负责攒批发送
+// 抓取goroutine不用再等JSON序列化和IPC写入
+type AsyncSink struct {
+	queue  chan sinkEntry
+	mode   BackpressureMode
+	writer *BatchWriter
+
+	flushReq chan chan error
+	done     chan struct{} // 关闭信号，唤醒阻塞的Enqueue
+	closing  chan struct{} // 通知后台goroutine做最后一次清空
+	finished chan error    // 后台goroutine退出时返回Close结果
+
+	mu        sync.RWMutex
+	closed    bool
+	closeOnce sync.Once
+
+	dropped int64
+	failed  int64
+}
+
+// sinkEntry 队列里的一条数据和它预留的去重键
+type sinkEntry struct {
+	item   interface{}
+	ticket dedupTicket
+}
+
+// NewAsyncSink 创建异步数据队列并启动后台goroutine
+//
+// 艹！queueSize是队列容量，writer为nil时默认每批100条、每秒flush一次
+func NewAsyncSink(queueSize int, mode BackpressureMode, writer *BatchWriter) *AsyncSink {
+	if queueSize < 1 {
+		queueSize = 1
+	}
+	if writer == nil {
+		writer = NewBatchWriter(100, time.Second)
+	}
+
+	s := &AsyncSink{
+		queue:    make(chan sinkEntry, queueSize),
+		mode:     mode,
+		writer:   writer,
+		flushReq: make(chan chan error),
+		done:     make(chan struct{}),
+		closing:  make(chan struct{}),
+		finished: make(chan error, 1),
+	}
+
+	go s.run()
+	return s
+}
+
+// Enqueue 把一条数据放进队列
+//
+// 艹！队列满了按BackpressureMode处理
+func (s *AsyncSink) Enqueue(item interface{}) error {
+	return s.enqueue(item, dedupTicket{})
+}
+
+// enqueue 放进队列，没放进去或被挤掉时放掉预留的去重键
+func (s *AsyncSink) enqueue(item interface{}, ticket dedupTicket) error {
+	err := s.push(sinkEntry{item: item, ticket: ticket})
+	if err != nil {
+		ticket.done(err)
+	}
+	return err
+}
+
+// push 按BackpressureMode把一条数据放进队列
+func (s *AsyncSink) push(entry sinkEntry) error {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	if s.closed {
+		return ErrSinkClosed
+	}
+
+	switch s.mode {
+	case BackpressureError:
+		select {
+		case s.queue <- entry:
+			return nil
+		default:
+			return ErrQueueFull
+		}
+
+	case BackpressureDropOldest:
+		for {
+			select {
+			case s.queue <- entry:
+				return nil
+			default:
+			}
+			select {
+			case old := <-s.queue:
+				atomic.AddInt64(&s.dropped, 1)
+				old.ticket.done(ErrQueueFull)
+			default:
+			}
+		}
+
+	default:
+		select {
+		case s.queue <- entry:
+			return nil
+		case <-s.done:
+			return ErrSinkClosed
+		}
+	}
+}
+
+// Flush 等待队列中已有的数据全部发送
+func (s *AsyncSink) Flush(ctx context.Context) error {
+	reply := make(chan error, 1)
+
+	select {
+	case s.flushReq <- reply:
+	case <-s.done:
+		return ErrSinkClosed
+	case <-ctx.Done():
+		return fmt.Errorf("flush cancelled: %w", ctx.Err())
+	}
+
+	select {
+	case err := <-reply:
+		return err
+	case <-ctx.Done():
+		return fmt.Errorf("flush cancelled: %w", ctx.Err())
+	}
+}
+
+// Close 停止接收新数据，并在ctx截止前把剩余数据发完
+//
+// 艹！超时返回错误，但后台goroutine仍会继续尝试发送
+func (s *AsyncSink) Close(ctx context.Context) error {
+	s.closeOnce.Do(func() {
+		close(s.done)
+
+		// 等正在执行的Enqueue全部返回
+		s.mu.Lock()
+		s.closed = true
+		s.mu.Unlock()
+
+		close(s.closing)
+	})
+
+	select {
+	case err := <-s.finished:
+		// 放回去，重复Close也能拿到结果
+		s.finished <- err
+		return err
+	case <-ctx.Done():
+		return fmt.Errorf("close timed out with %d items pending: %w", s.Pending(), ctx.Err())
+	}
+}
+
+// Pending 返回还未发送的条数（队列+批次缓冲）
+func (s *AsyncSink) Pending() int {
+	return len(s.queue) + s.writer.Pending()
+}
+
+// Dropped 返回因队列满被丢弃的条数
+func (s *AsyncSink) Dropped() int64 {
+	return atomic.LoadInt64(&s.dropped)
+}
+
+// Failed 返回序列化失败或被拒绝（例如超过大小限制）而没有发出去的条数
+//
+// 艹！整批发送失败的由BatchWriter.OnFlush报告，不算在这里
+func (s *AsyncSink) Failed() int64 {
+	return atomic.LoadInt64(&s.failed)
+}
+
+// run 后台goroutine：从队列取数据交给BatchWriter
+func (s *AsyncSink) run() {
+	for {
+		select {
+		case entry := <-s.queue:
+			s.add(entry)
+
+		case reply := <-s.flushReq:
+			s.drain()
+			reply <- s.writer.Flush()
+
+		case <-s.closing:
+			s.drain()
+			s.finished <- s.writer.Close()
+			return
+		}
+	}
+}
+
+// drain 非阻塞地把队列里剩余的数据全部取出
+func (s *AsyncSink) drain() {
+	for {
+		select {
+		case entry := <-s.queue:
+			s.add(entry)
+		default:
+			return
+		}
+	}
+}
+
+// add 交给BatchWriter，失败只记录不中断
+func (s *AsyncSink) add(entry sinkEntry) {
+	if err := s.writer.add(entry.item, entry.ticket); err != nil {
+		// 整批发送失败的条数由OnFlush统计，这里只数这一条本身的问题
+		if !errors.Is(err, errBatchSend) {
+			atomic.AddInt64(&s.failed, 1)
+		}
+		LogError("Async sink failed to save item: %v", err)
+	}
+}
@@ -0,0 +1,159 @@
+package crawlab
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+)
+
+// gateTransport 每次发送前先报到，再等放行的传输通道
+type gateTransport struct {
+	started chan struct{}
+	release chan struct{}
+
+	mu   sync.Mutex
+	sent []string
+}
+
+func newGateTransport() *gateTransport {
+	return &gateTransport{started: make(chan struct{}, 10), release: make(chan struct{})}
+}
+
+func (g *gateTransport) Send(msg IPCMessage) error {
+	g.started <- struct{}{}
+	<-g.release
+
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	for _, raw := range msg.Payload.([]json.RawMessage) {
+		var s string
+		json.Unmarshal(raw, &s)
+		g.sent = append(g.sent, s)
+	}
+	return nil
+}
+
+func (g *gateTransport) Close() error { return nil }
+
+func TestAsyncSinkBackpressure(t *testing.T) {
+	tests := []struct {
+		name        string
+		mode        BackpressureMode
+		wantErr     error
+		wantBlock   bool
+		wantSent    []string
+		wantDropped int64
+	}{
+		{"error when full", BackpressureError, ErrQueueFull, false, []string{"a", "b"}, 0},
+		{"drop oldest", BackpressureDropOldest, nil, false, []string{"a", "c"}, 1},
+		{"block until there is room", BackpressureBlock, nil, true, []string{"a", "b", "c"}, 0},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			gate := newGateTransport()
+			useTransport(t, gate)
+
+			// 每条单独一批，"a"卡在发送里，"b"占满容量为1的队列
+			sink := NewAsyncSink(1, tt.mode, NewBatchWriter(1, 0))
+			if err := sink.Enqueue("a"); err != nil {
+				t.Fatal(err)
+			}
+			<-gate.started
+			if err := sink.Enqueue("b"); err != nil {
+				t.Fatal(err)
+			}
+
+			result := make(chan error, 1)
+			go func() { result <- sink.Enqueue("c") }()
+
+			select {
+			case err := <-result:
+				if tt.wantBlock {
+					t.Fatalf("Enqueue returned %v on a full queue, want it to block", err)
+				}
+				if !errors.Is(err, tt.wantErr) {
+					t.Errorf("Enqueue err = %v, want %v", err, tt.wantErr)
+				}
+			case <-time.After(50 * time.Millisecond):
+				if !tt.wantBlock {
+					t.Fatal("Enqueue blocked on a full queue")
+				}
+			}
+
+			close(gate.release)
+			if tt.wantBlock {
+				if err := <-result; err != nil {
+					t.Errorf("blocked Enqueue err = %v", err)
+				}
+			}
+
+			ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+			defer cancel()
+			if err := sink.Close(ctx); err != nil {
+				t.Fatal(err)
+			}
+
+			if !equalStrings(gate.sent, tt.wantSent) {
+				t.Errorf("sent = %v, want %v", gate.sent, tt.wantSent)
+			}
+			if got := sink.Dropped(); got != tt.wantDropped {
+				t.Errorf("Dropped = %d, want %d", got, tt.wantDropped)
+			}
+			if err := sink.Enqueue("d"); !errors.Is(err, ErrSinkClosed) {
+				t.Errorf("Enqueue after Close = %v, want ErrSinkClosed", err)
+			}
+		})
+	}
+}
+
+func TestSpiderAsyncUnsent(t *testing.T) {
+	tests := []struct {
+		name       string
+		transport  Transport
+		items      []interface{}
+		wantSaved  int64
+		wantUnsent int64
+	}{
+		{"all sent", discardTransport{}, []interface{}{"a", "b", "c"}, 3, 0},
+		{"failed batches count as unsent", failingTransport{}, []interface{}{"a", "b", "c"}, 0, 3},
+		{"unencodable item counts as unsent", discardTransport{}, []interface{}{"a", make(chan int), "c"}, 2, 1},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			useTransport(t, tt.transport)
+
+			s := NewSpider("test")
+			s.BatchSize = 2
+			s.EnableAsync(10, BackpressureBlock, 0)
+			for _, item := range tt.items {
+				if err := s.Save(item); err != nil {
+					t.Fatal(err)
+				}
+			}
+			s.closeSink()
+
+			if s.Stats.ItemsSaved != tt.wantSaved || s.Stats.ItemsUnsent != tt.wantUnsent {
+				t.Errorf("ItemsSaved = %d, ItemsUnsent = %d, want %d, %d",
+					s.Stats.ItemsSaved, s.Stats.ItemsUnsent, tt.wantSaved, tt.wantUnsent)
+			}
+		})
+	}
+}
+
+// equalStrings 比较两个string切片，nil和空切片算相等
+func equalStrings(a, b []string) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
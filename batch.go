@@ -0,0 +1,217 @@
+package crawlab
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+)
+
+// batchEnvelopeOverhead IPC消息外层结构预留的字节数
+const batchEnvelopeOverhead = 1024
+
+// ErrItemTooLarge 单条数据超过IPC消息大小限制，Runner收到也会丢掉
+var ErrItemTooLarge = errors.New("item exceeds IPC message size limit")
+
+// errBatchSend 整批发送失败，和单条数据本身的错误区分开
+var errBatchSend = errors.New("failed to send batch")
+
+// BatchResult 单次flush的结果
+type BatchResult struct {
+	Items int   // 本批数据条数
+	Bytes int   // 本批payload字节数
+	Err   error // 发送错误，成功为nil
+}
+
+// BatchWriter 按条数和字节数自动分批的写入器
+//
+// 艹！一条一条Add就行，攒够BatchSize条或者快到5MB就自动发一批
+// 单条数据本身超过字节预算时Add直接返回ErrItemTooLarge
+// 发送和OnFlush回调都在锁外执行，回调里可以放心调用Add/Flush/Pending
+type BatchWriter struct {
+	MaxItems int               // 每批最多条数
+	MaxBytes int               // 每批最多字节数（默认由MaxIPCMessageSize推算）
+	OnFlush  func(BatchResult) // 每次flush后的回调，可为nil
+
+	mu       sync.Mutex
+	items    []batchEntry
+	size     int
+	closed   bool
+	stop     chan struct{}
+	wg       sync.WaitGroup
+	inflight sync.WaitGroup // 已经取出缓冲区、还在发送的批次
+}
+
+// batchEntry 缓冲区里的一条数据和它预留的去重键
+type batchEntry struct {
+	data   json.RawMessage
+	ticket dedupTicket
+}
+
+// NewBatchWriter 创建分批写入器
+//
+// 艹！batchSize<1时不限条数，只按字节分批
+// flushInterval>0时后台定时flush，避免数据攒在内存里太久
+func NewBatchWriter(batchSize int, flushInterval time.Duration) *BatchWriter {
+	w := &BatchWriter{
+		MaxItems: batchSize,
+		MaxBytes: MaxIPCMessageSize - batchEnvelopeOverhead,
+		stop:     make(chan struct{}),
+	}
+
+	if flushInterval > 0 {
+		w.wg.Add(1)
+		go w.loop(flushInterval)
+	}
+
+	return w
+}
+
+// Add 添加一条数据
+//
+// 艹！加进来之前先判断会不会超预算，超了就先把已有的发出去
+func (w *BatchWriter) Add(item interface{}) error {
+	return w.add(item, dedupTicket{})
+}
+
+// add 添加一条数据，ticket在这条数据发送结束时提交或放掉
+func (w *BatchWriter) add(item interface{}, ticket dedupTicket) error {
+	data, err := json.Marshal(item)
+	if err != nil {
+		err = fmt.Errorf("failed to marshal item: %w", err)
+		ticket.done(err)
+		return err
+	}
+	if len(data)+2 > w.MaxBytes {
+		err = fmt.Errorf("%w: %d bytes, limit %d bytes", ErrItemTooLarge, len(data), w.MaxBytes)
+		ticket.done(err)
+		return err
+	}
+
+	w.mu.Lock()
+	if w.closed {
+		w.mu.Unlock()
+		err = fmt.Errorf("batch writer is closed")
+		ticket.done(err)
+		return err
+	}
+
+	// 数组的逗号和方括号也要算进去
+	var full []batchEntry
+	if len(w.items) > 0 && w.size+len(data)+len(w.items)+2 > w.MaxBytes {
+		full = w.takeLocked()
+	}
+
+	w.items = append(w.items, batchEntry{data: data, ticket: ticket})
+	w.size += len(data)
+
+	var ready []batchEntry
+	if w.MaxItems > 0 && len(w.items) >= w.MaxItems {
+		ready = w.takeLocked()
+	}
+	w.mu.Unlock()
+
+	err = w.send(full)
+	if rerr := w.send(ready); err == nil {
+		err = rerr
+	}
+	return err
+}
+
+// Flush 立即发送缓冲区里的数据
+func (w *BatchWriter) Flush() error {
+	w.mu.Lock()
+	batch := w.takeLocked()
+	w.mu.Unlock()
+	return w.send(batch)
+}
+
+// Close 停止定时flush并发送剩余数据
+//
+// 艹！用完一定要Close，不然最后一批就丢了
+func (w *BatchWriter) Close() error {
+	w.mu.Lock()
+	if w.closed {
+		w.mu.Unlock()
+		return nil
+	}
+	w.closed = true
+	close(w.stop)
+	w.mu.Unlock()
+
+	w.wg.Wait()
+	err := w.Flush()
+	w.inflight.Wait()
+	return err
+}
+
+// Pending 返回缓冲区中还未发送的条数
+func (w *BatchWriter) Pending() int {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	return len(w.items)
+}
+
+// takeLocked 取出当前批次，调用方必须持有锁
+func (w *BatchWriter) takeLocked() []batchEntry {
+	if len(w.items) == 0 {
+		return nil
+	}
+	batch := w.items
+	w.items = nil
+	w.size = 0
+	w.inflight.Add(1)
+	return batch
+}
+
+// send 发送取出的批次并回调OnFlush，不能持有锁
+//
+// 艹！发送结束后按结果提交或放掉每条数据预留的去重键
+func (w *BatchWriter) send(batch []batchEntry) error {
+	if len(batch) == 0 {
+		return nil
+	}
+	defer w.inflight.Done()
+
+	payload := make([]json.RawMessage, len(batch))
+	size := len(batch) + 1
+	for i, entry := range batch {
+		payload[i] = entry.data
+		size += len(entry.data)
+	}
+	result := BatchResult{Items: len(batch), Bytes: size}
+
+	result.Err = sendIPCMessage("data", payload)
+	if result.Err != nil {
+		result.Err = fmt.Errorf("%w of %d items: %w", errBatchSend, result.Items, result.Err)
+	}
+	for _, entry := range batch {
+		entry.ticket.done(result.Err)
+	}
+
+	if w.OnFlush != nil {
+		w.OnFlush(result)
+	}
+
+	return result.Err
+}
+
+// loop 定时flush
+func (w *BatchWriter) loop(interval time.Duration) {
+	defer w.wg.Done()
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+			if err := w.Flush(); err != nil {
+				LogError("Periodic batch flush failed: %v", err)
+			}
+		case <-w.stop:
+			return
+		}
+	}
+}
@@ -0,0 +1,153 @@
+package crawlab
+
+import (
+	"encoding/json"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+)
+
+// batchSizes 每条data消息里的数据条数，顺便检查每批都没超过maxBytes
+func batchSizes(t *testing.T, msgs []IPCMessage, maxBytes int) []int {
+	t.Helper()
+	var sizes []int
+	for _, msg := range msgs {
+		items, ok := msg.Payload.([]json.RawMessage)
+		if !ok {
+			t.Fatalf("payload is %T, want []json.RawMessage", msg.Payload)
+		}
+		data, _ := json.Marshal(items)
+		if len(data) > maxBytes {
+			t.Errorf("batch of %d bytes exceeds MaxBytes %d", len(data), maxBytes)
+		}
+		sizes = append(sizes, len(items))
+	}
+	return sizes
+}
+
+func TestBatchWriterTriggers(t *testing.T) {
+	item := strings.Repeat("a", 8) // JSON里是10字节
+
+	tests := []struct {
+		name     string
+		maxItems int
+		maxBytes int
+		items    int
+		want     []int // 每批条数，最后一批是Close发的
+	}{
+		{"count trigger", 3, 1 << 20, 7, []int{3, 3, 1}},
+		{"exact multiple", 2, 1 << 20, 4, []int{2, 2}},
+		{"byte trigger", 0, 35, 7, []int{3, 3, 1}}, // 3条是[a,b,c]=34字节
+		{"bytes before count", 5, 35, 5, []int{3, 2}},
+		{"nothing added", 3, 1 << 20, 0, nil},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rec := &recordingTransport{}
+			useTransport(t, rec)
+
+			w := NewBatchWriter(tt.maxItems, 0)
+			w.MaxBytes = tt.maxBytes
+			var flushed []int
+			w.OnFlush = func(r BatchResult) { flushed = append(flushed, r.Items) }
+
+			for i := 0; i < tt.items; i++ {
+				if err := w.Add(item); err != nil {
+					t.Fatal(err)
+				}
+			}
+			if err := w.Close(); err != nil {
+				t.Fatal(err)
+			}
+
+			got := batchSizes(t, rec.msgs, tt.maxBytes)
+			if !equalInts(got, tt.want) || !equalInts(flushed, tt.want) {
+				t.Errorf("batches = %v, OnFlush = %v, want %v", got, flushed, tt.want)
+			}
+		})
+	}
+}
+
+func TestBatchWriterErrors(t *testing.T) {
+	t.Run("item too large", func(t *testing.T) {
+		rec := &recordingTransport{}
+		useTransport(t, rec)
+		w := NewBatchWriter(10, 0)
+		w.MaxBytes = 20
+		if err := w.Add(strings.Repeat("x", 30)); !errors.Is(err, ErrItemTooLarge) {
+			t.Errorf("err = %v, want ErrItemTooLarge", err)
+		}
+		w.Close()
+		if len(rec.msgs) != 0 {
+			t.Errorf("sent %d messages, want 0", len(rec.msgs))
+		}
+	})
+
+	t.Run("send failure", func(t *testing.T) {
+		useTransport(t, failingTransport{})
+		w := NewBatchWriter(2, 0)
+		var result BatchResult
+		w.OnFlush = func(r BatchResult) { result = r }
+
+		if err := w.Add(1); err != nil {
+			t.Fatal(err)
+		}
+		err := w.Add(2)
+		if !errors.Is(err, errBatchSend) || result.Err == nil || result.Items != 2 {
+			t.Errorf("err = %v, OnFlush = %+v", err, result)
+		}
+		w.Close()
+	})
+
+	t.Run("add after close", func(t *testing.T) {
+		useTransport(t, discardTransport{})
+		w := NewBatchWriter(2, 0)
+		w.Close()
+		if err := w.Add(1); err == nil {
+			t.Error("Add after Close succeeded")
+		}
+		if err := w.Close(); err != nil {
+			t.Errorf("second Close = %v", err)
+		}
+	})
+}
+
+func TestBatchWriterInterval(t *testing.T) {
+	rec := &recordingTransport{}
+	useTransport(t, rec)
+
+	done := make(chan BatchResult, 1)
+	w := NewBatchWriter(100, 10*time.Millisecond)
+	w.OnFlush = func(r BatchResult) { done <- r }
+	defer w.Close()
+
+	if err := w.Add("only one"); err != nil {
+		t.Fatal(err)
+	}
+	select {
+	case r := <-done:
+		if r.Items != 1 || r.Err != nil {
+			t.Errorf("flush = %+v", r)
+		}
+	case <-time.After(2 * time.Second):
+		t.Fatal("periodic flush never happened")
+	}
+	if n := w.Pending(); n != 0 {
+		t.Errorf("Pending = %d after periodic flush", n)
+	}
+}
+
+// equalInts 比较两个int切片，nil和空切片算相等
+func equalInts(a, b []int) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,128 @@
+package crawlab
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+)
+
+// DefaultMaxReplayBodySize 不可Seek的请求体为重试缓冲的默认上限（8MB）
+const DefaultMaxReplayBodySize = 8 * 1024 * 1024
+
+// ErrBodyNotRewindable 请求体无法重新发送（超过缓冲上限且不支持Seek）
+var ErrBodyNotRewindable = errors.New("request body cannot be rewound for retry")
+
+// ReplayableBody 每次发送都重新获取的请求体
+//
+// 艹！大文件上传又想重试就用它，每次尝试调用GetBody拿一个新的Reader
+// 返回的Reader如果实现了io.Closer，用完会被关闭
+//
+//	body := crawlab.NewReplayableBody(func() (io.Reader, error) { return os.Open(path) })
+//	client.Post(ctx, url, body)
+type ReplayableBody struct {
+	GetBody func() (io.Reader, error)
+
+	r io.Reader // 直接当io.Reader用时的第一份
+}
+
+// NewReplayableBody 创建可重放的请求体
+func NewReplayableBody(getBody func() (io.Reader, error)) *ReplayableBody {
+	return &ReplayableBody{GetBody: getBody}
+}
+
+// Read 实现io.Reader，脱离HTTPClient单独使用时只读第一份
+func (b *ReplayableBody) Read(p []byte) (int, error) {
+	if b.r == nil {
+		r, err := b.GetBody()
+		if err != nil {
+			return 0, err
+		}
+		b.r = r
+	}
+	return b.r.Read(p)
+}
+
+// requestBody 为重试准备好的请求体
+type requestBody struct {
+	open func(attempt int) (io.ReadCloser, error) // 每次尝试获取请求体
+	size int64                                    // 已知长度，-1表示未知
+}
+
+// newRequestBody 把任意io.Reader包装成可重放的请求体
+//
+// 艹！按优先级：
+//  1. ReplayableBody：每次调用GetBody
+//  2. io.Seeker（文件、bytes.Reader、strings.Reader）：每次Seek回起点，不占内存
+//  3. 其他Reader：最多缓冲maxBuffer字节；超过上限时第一次照常流式发送，需要重试时返回ErrBodyNotRewindable
+func newRequestBody(body io.Reader, maxBuffer int64) (*requestBody, error) {
+	if body == nil {
+		return nil, nil
+	}
+
+	switch b := body.(type) {
+	case *ReplayableBody:
+		return &requestBody{
+			size: -1,
+			open: func(int) (io.ReadCloser, error) {
+				r, err := b.GetBody()
+				if err != nil {
+					return nil, fmt.Errorf("failed to get request body: %w", err)
+				}
+				if rc, ok := r.(io.ReadCloser); ok {
+					return rc, nil
+				}
+				return io.NopCloser(r), nil
+			},
+		}, nil
+
+	case io.Seeker:
+		start, err := b.Seek(0, io.SeekCurrent)
+		if err != nil {
+			return nil, fmt.Errorf("failed to seek request body: %w", err)
+		}
+		size := int64(-1)
+		if end, err := b.Seek(0, io.SeekEnd); err == nil {
+			size = end - start
+		}
+		return &requestBody{
+			size: size,
+			open: func(int) (io.ReadCloser, error) {
+				if _, err := b.Seek(start, io.SeekStart); err != nil {
+					return nil, fmt.Errorf("failed to rewind request body: %w", err)
+				}
+				// 包一层，防止http.Client把调用方的文件关掉
+				return io.NopCloser(struct{ io.Reader }{body}), nil
+			},
+		}, nil
+	}
+
+	if maxBuffer <= 0 {
+		maxBuffer = DefaultMaxReplayBodySize
+	}
+
+	buf, err := io.ReadAll(io.LimitReader(body, maxBuffer+1))
+	if err != nil {
+		return nil, fmt.Errorf("failed to buffer request body: %w", err)
+	}
+
+	if int64(len(buf)) <= maxBuffer {
+		return &requestBody{
+			size: int64(len(buf)),
+			open: func(int) (io.ReadCloser, error) {
+				return io.NopCloser(bytes.NewReader(buf)), nil
+			},
+		}, nil
+	}
+
+	// 超过缓冲上限：只能发一次
+	return &requestBody{
+		size: -1,
+		open: func(attempt int) (io.ReadCloser, error) {
+			if attempt > 0 {
+				return nil, fmt.Errorf("%w: body exceeds %d bytes buffer, use a seekable body or NewReplayableBody", ErrBodyNotRewindable, maxBuffer)
+			}
+			return io.NopCloser(io.MultiReader(bytes.NewReader(buf), body)), nil
+		},
+	}, nil
+}
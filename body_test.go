@@ -0,0 +1,89 @@
+package crawlab
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// bodyRecorder 记录每次收到的请求体，前failures次返回503
+type bodyRecorder struct {
+	failures int
+
+	mu     sync.Mutex
+	bodies []string
+}
+
+func (b *bodyRecorder) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	data, _ := io.ReadAll(r.Body)
+
+	b.mu.Lock()
+	b.bodies = append(b.bodies, string(data))
+	n := len(b.bodies)
+	b.mu.Unlock()
+
+	if n <= b.failures {
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}
+}
+
+func TestRequestBodyReplay(t *testing.T) {
+	partlyRead := strings.NewReader("skip:payload")
+	partlyRead.Seek(5, io.SeekStart)
+
+	opened := 0
+	replayable := NewReplayableBody(func() (io.Reader, error) {
+		opened++
+		return strings.NewReader("payload"), nil
+	})
+
+	tests := []struct {
+		name     string
+		body     io.Reader
+		failures int
+		want     []string // 服务端每次收到的请求体
+		wantErr  error
+	}{
+		{"seekable body is rewound", bytes.NewReader([]byte("payload")), 2, []string{"payload", "payload", "payload"}, nil},
+		{"seek starts at the current offset", partlyRead, 1, []string{"payload", "payload"}, nil},
+		{"plain reader is buffered", struct{ io.Reader }{strings.NewReader("payload")}, 1, []string{"payload", "payload"}, nil},
+		{"replayable body reopens", replayable, 1, []string{"payload", "payload"}, nil},
+		{"oversized plain reader sends once", struct{ io.Reader }{strings.NewReader(strings.Repeat("x", 20))}, 0, []string{strings.Repeat("x", 20)}, nil},
+		{"oversized plain reader cannot retry", struct{ io.Reader }{strings.NewReader(strings.Repeat("x", 20))}, 1, []string{strings.Repeat("x", 20)}, ErrBodyNotRewindable},
+		{"empty body", struct{ io.Reader }{strings.NewReader("")}, 1, []string{"", ""}, nil},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rec := &bodyRecorder{failures: tt.failures}
+			srv := httptest.NewServer(rec)
+			defer srv.Close()
+
+			client := NewHTTPClient(5 * time.Second)
+			client.SetRetry(3, time.Millisecond)
+			client.MaxReplayBodySize = 10
+
+			resp, err := client.Put(context.Background(), srv.URL, tt.body)
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("err = %v, want %v", err, tt.wantErr)
+			}
+			if err == nil {
+				resp.Body.Close()
+			}
+			if !equalStrings(rec.bodies, tt.want) {
+				t.Errorf("server received %q, want %q", rec.bodies, tt.want)
+			}
+		})
+	}
+
+	if opened != 2 {
+		t.Errorf("ReplayableBody opened %d times, want 2", opened)
+	}
+}
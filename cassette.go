@@ -0,0 +1,473 @@
+package crawlab
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+	"unicode/utf8"
+)
+
+// ErrCassetteMiss 回放时磁带里没有匹配的请求（严格模式）
+var ErrCassetteMiss = errors.New("no matching interaction in cassette")
+
+// redactedValue 脱敏后的值
+const redactedValue = "REDACTED"
+
+// cassetteTail 磁带文件的结尾，追加时覆盖掉它
+const cassetteTail = "\n]\n"
+
+// CassetteMode 磁带模式
+type CassetteMode int
+
+const (
+	CassetteRecord CassetteMode = iota // 录制：真实请求，结果写入磁带
+	CassetteReplay                     // 回放：只从磁带返回
+	CassetteAuto                       // 磁带文件存在就回放，不存在就录制
+)
+
+// RecordedBody 录制的请求体/响应体
+//
+// 艹！文本直接存，二进制存base64，磁带文件人眼能看、能手改
+type RecordedBody struct {
+	Text   string `json:"body,omitempty"`
+	Base64 string `json:"body_base64,omitempty"`
+}
+
+// newRecordedBody 按内容选择存法
+func newRecordedBody(data []byte) RecordedBody {
+	if utf8.Valid(data) {
+		return RecordedBody{Text: string(data)}
+	}
+	return RecordedBody{Base64: base64.StdEncoding.EncodeToString(data)}
+}
+
+// Bytes 返回原始内容
+func (b RecordedBody) Bytes() []byte {
+	if b.Base64 != "" {
+		data, err := base64.StdEncoding.DecodeString(b.Base64)
+		if err == nil {
+			return data
+		}
+	}
+	return []byte(b.Text)
+}
+
+// RecordedRequest 录制的请求
+type RecordedRequest struct {
+	Method string      `json:"method"`
+	URL    string      `json:"url"`
+	Header http.Header `json:"header,omitempty"`
+	RecordedBody
+}
+
+// RecordedResponse 录制的响应
+type RecordedResponse struct {
+	StatusCode int         `json:"status_code"`
+	Status     string      `json:"status"`
+	Header     http.Header `json:"header,omitempty"`
+	RecordedBody
+}
+
+// Interaction 一次请求和响应
+type Interaction struct {
+	Request    RecordedRequest  `json:"request"`
+	Response   RecordedResponse `json:"response"`
+	RecordedAt time.Time        `json:"recorded_at"`
+}
+
+// RequestMatcher 判断请求和录制的请求是否匹配
+//
+// 艹！req是已经脱敏过的当前请求，和磁带里的存法一样
+type RequestMatcher func(req, recorded *RecordedRequest) bool
+
+// MatchMethod 方法相同
+func MatchMethod(req, recorded *RecordedRequest) bool {
+	return req.Method == recorded.Method
+}
+
+// MatchURL URL相同（查询参数顺序无关）
+func MatchURL(req, recorded *RecordedRequest) bool {
+	return canonicalURL(req.URL) == canonicalURL(recorded.URL)
+}
+
+// MatchBody 请求体相同
+func MatchBody(req, recorded *RecordedRequest) bool {
+	return bytes.Equal(req.Bytes(), recorded.Bytes())
+}
+
+// MatchHeader 指定的请求头相同
+func MatchHeader(names ...string) RequestMatcher {
+	return func(req, recorded *RecordedRequest) bool {
+		for _, name := range names {
+			if req.Header.Get(name) != recorded.Header.Get(name) {
+				return false
+			}
+		}
+		return true
+	}
+}
+
+// CassetteTransport 录制/回放HTTP请求的Transport
+//
+// 艹！写爬虫测试不用再打真网站：
+//   - 录制模式正常发请求，每次请求和响应都追加到磁带文件（文件随时都是完整的JSON数组）
+//   - 回放模式按Matchers找录制的响应，同样的请求按录制顺序依次返回
+//   - 写文件前按RedactHeaders/RedactParams脱敏，匹配时当前请求也按同样规则脱敏
+//   - Strict为true时找不到匹配返回ErrCassetteMiss，否则真的发出去
+//
+// 用法：
+//
+//	cassette, _ := crawlab.NewCassetteTransport("testdata/list.json", crawlab.CassetteAuto)
+//	defer cassette.Close()
+//	client.SetCassette(cassette)
+type CassetteTransport struct {
+	Path     string            // 磁带文件
+	Mode     CassetteMode      // 模式
+	Next     http.RoundTripper // 真实的Transport（默认http.DefaultTransport）
+	Matchers []RequestMatcher  // 匹配规则（默认方法+URL）
+	Strict   bool              // 回放时找不到匹配是否报错（默认true）
+
+	// MaxBodySize 录制的响应体上限（默认10MB，<=0不限制），超过的响应照常返回但不录
+	MaxBodySize int64
+
+	RedactHeaders []string           // 脱敏的请求头和响应头
+	RedactParams  []string           // 脱敏的URL查询参数
+	Redact        func(*Interaction) // 自定义脱敏，在上面两项之后执行
+
+	mu           sync.Mutex
+	interactions []Interaction
+	used         []bool
+	file         *os.File // 录制时打开的磁带文件
+}
+
+// NewCassetteTransport 创建录制/回放Transport
+//
+// 艹！回放模式下磁带文件必须存在；Auto模式按文件是否存在决定录制还是回放
+func NewCassetteTransport(path string, mode CassetteMode) (*CassetteTransport, error) {
+	t := &CassetteTransport{
+		Path:          path,
+		Mode:          mode,
+		Matchers:      []RequestMatcher{MatchMethod, MatchURL},
+		Strict:        true,
+		MaxBodySize:   DefaultMaxBodySize,
+		RedactHeaders: []string{"Authorization", "Proxy-Authorization", "Cookie", "Set-Cookie", "X-Api-Key"},
+		RedactParams:  []string{"access_token", "api_key", "apikey", "token", "key", "secret", "password"},
+	}
+
+	var cassette []Interaction
+	err := readJSONFile(path, &cassette)
+	switch {
+	case err == nil:
+		if mode == CassetteAuto {
+			t.Mode = CassetteReplay
+		}
+	case os.IsNotExist(err) && mode != CassetteReplay:
+		if mode == CassetteAuto {
+			t.Mode = CassetteRecord
+		}
+	default:
+		return nil, fmt.Errorf("failed to load cassette: %w", err)
+	}
+
+	if t.Mode == CassetteReplay {
+		t.interactions = cassette
+		t.used = make([]bool, len(cassette))
+	}
+	return t, nil
+}
+
+// SetCassette 用磁带录制或回放所有请求
+//
+// 艹！装在底层Transport上，重试、重定向的每一次请求都会录下来
+// 和SetProxyPool谁先谁后都行，代理池总是装在磁带后面的真实Transport上
+func (c *HTTPClient) SetCassette(t *CassetteTransport) {
+	if t.Next == nil {
+		t.Next = c.Client.Transport
+	}
+	c.Client.Transport = t
+}
+
+// Interactions 返回当前磁带里的所有交互
+func (t *CassetteTransport) Interactions() []Interaction {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return append([]Interaction(nil), t.interactions...)
+}
+
+// Unused 返回回放时没被用到的交互数，测试里检查请求有没有少发
+func (t *CassetteTransport) Unused() int {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	n := 0
+	for _, u := range t.used {
+		if !u {
+			n++
+		}
+	}
+	return n
+}
+
+// RoundTrip 实现http.RoundTripper
+func (t *CassetteTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	body, err := readRequestBody(req)
+	if err != nil {
+		return nil, err
+	}
+
+	if t.Mode == CassetteReplay {
+		return t.replay(req, body)
+	}
+	return t.record(req, body)
+}
+
+// replay 从磁带找匹配的响应
+func (t *CassetteTransport) replay(req *http.Request, body []byte) (*http.Response, error) {
+	current := t.redactRequest(req, body)
+
+	t.mu.Lock()
+	idx, last := -1, -1
+	for i := range t.interactions {
+		if !t.match(&current, &t.interactions[i].Request) {
+			continue
+		}
+		last = i
+		if !t.used[i] {
+			idx = i
+			break
+		}
+	}
+	// 同样的请求比录制时多发了，非严格模式重复用最后一个
+	if idx < 0 && !t.Strict {
+		idx = last
+	}
+	var it Interaction
+	if idx >= 0 {
+		t.used[idx] = true
+		it = t.interactions[idx]
+	}
+	t.mu.Unlock()
+
+	if idx < 0 {
+		if t.Strict {
+			return nil, fmt.Errorf("%w: %s %s", ErrCassetteMiss, current.Method, current.URL)
+		}
+		LogWarn("No cassette interaction for %s %s, sending real request", current.Method, current.URL)
+		return t.next().RoundTrip(withBody(req, body))
+	}
+
+	data := it.Response.Bytes()
+	return &http.Response{
+		Status:        it.Response.Status,
+		StatusCode:    it.Response.StatusCode,
+		Proto:         "HTTP/1.1",
+		ProtoMajor:    1,
+		ProtoMinor:    1,
+		Header:        it.Response.Header.Clone(),
+		Body:          io.NopCloser(bytes.NewReader(data)),
+		ContentLength: int64(len(data)),
+		Request:       req,
+	}, nil
+}
+
+// record 发真实请求并录下来
+func (t *CassetteTransport) record(req *http.Request, body []byte) (*http.Response, error) {
+	resp, err := t.next().RoundTrip(withBody(req, body))
+	if err != nil {
+		return nil, err
+	}
+
+	data, ok, err := bufferBody(resp, t.MaxBodySize)
+	if err != nil {
+		return nil, err
+	}
+	if !ok {
+		LogWarn("Response for %s exceeds %d bytes, not recorded", req.URL.Redacted(), t.MaxBodySize)
+		return resp, nil
+	}
+
+	it := Interaction{
+		Request: t.redactRequest(req, body),
+		Response: RecordedResponse{
+			StatusCode:   resp.StatusCode,
+			Status:       resp.Status,
+			Header:       t.redactHeader(resp.Header),
+			RecordedBody: newRecordedBody(data),
+		},
+		RecordedAt: time.Now(),
+	}
+	if t.Redact != nil {
+		t.Redact(&it)
+	}
+
+	t.mu.Lock()
+	t.interactions = append(t.interactions, it)
+	err = t.appendLocked(&it)
+	t.mu.Unlock()
+	if err != nil {
+		LogWarn("Failed to write cassette %s: %v", t.Path, err)
+	}
+	return resp, nil
+}
+
+// appendLocked 把一次交互追加到磁带文件，调用方必须持有锁
+//
+// 艹！第一次写时覆盖旧文件，之后把结尾的"]"换成",新交互]"，不用每次重写整个文件
+func (t *CassetteTransport) appendLocked(it *Interaction) error {
+	data, err := json.MarshalIndent(it, "  ", "  ")
+	if err != nil {
+		return err
+	}
+
+	if t.file == nil {
+		if dir := filepath.Dir(t.Path); dir != "" {
+			if err := os.MkdirAll(dir, 0755); err != nil {
+				return err
+			}
+		}
+		f, err := os.OpenFile(t.Path, os.O_RDWR|os.O_CREATE|os.O_TRUNC, 0600)
+		if err != nil {
+			return err
+		}
+		t.file = f
+		_, err = f.WriteString("[\n  " + string(data) + cassetteTail)
+		return err
+	}
+
+	if _, err := t.file.Seek(-int64(len(cassetteTail)), io.SeekEnd); err != nil {
+		return err
+	}
+	_, err = t.file.WriteString(",\n  " + string(data) + cassetteTail)
+	return err
+}
+
+// Close 关闭录制中的磁带文件，回放模式什么也不做
+func (t *CassetteTransport) Close() error {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	if t.file == nil {
+		return nil
+	}
+	err := t.file.Close()
+	t.file = nil
+	return err
+}
+
+// match 所有匹配规则都通过才算匹配
+func (t *CassetteTransport) match(req, recorded *RecordedRequest) bool {
+	for _, m := range t.Matchers {
+		if !m(req, recorded) {
+			return false
+		}
+	}
+	return true
+}
+
+// redactRequest 把请求转成脱敏后的录制格式
+func (t *CassetteTransport) redactRequest(req *http.Request, body []byte) RecordedRequest {
+	rr := RecordedRequest{
+		Method:       req.Method,
+		URL:          t.redactURL(req.URL),
+		Header:       t.redactHeader(req.Header),
+		RecordedBody: newRecordedBody(body),
+	}
+	if rr.Method == "" {
+		rr.Method = http.MethodGet
+	}
+
+	// 自定义脱敏也作用在当前请求上，匹配时两边才一致
+	if t.Redact != nil && t.Mode == CassetteReplay {
+		it := Interaction{Request: rr}
+		t.Redact(&it)
+		rr = it.Request
+	}
+	return rr
+}
+
+// redactURL 脱敏查询参数和URL里的密码
+func (t *CassetteTransport) redactURL(u *url.URL) string {
+	clean := *u
+	if clean.User != nil {
+		clean.User = url.UserPassword(clean.User.Username(), redactedValue)
+	}
+
+	if clean.RawQuery != "" && len(t.RedactParams) > 0 {
+		q := clean.Query()
+		changed := false
+		for _, name := range t.RedactParams {
+			for key := range q {
+				if strings.EqualFold(key, name) {
+					q.Set(key, redactedValue)
+					changed = true
+				}
+			}
+		}
+		if changed {
+			clean.RawQuery = q.Encode()
+		}
+	}
+	return clean.String()
+}
+
+// redactHeader 脱敏请求头/响应头
+func (t *CassetteTransport) redactHeader(h http.Header) http.Header {
+	clean := h.Clone()
+	for _, name := range t.RedactHeaders {
+		if _, ok := clean[http.CanonicalHeaderKey(name)]; ok {
+			clean.Set(name, redactedValue)
+		}
+	}
+	return clean
+}
+
+// next 真实的Transport
+func (t *CassetteTransport) next() http.RoundTripper {
+	if t.Next != nil {
+		return t.Next
+	}
+	return http.DefaultTransport
+}
+
+// readRequestBody 读出并关闭请求体
+func readRequestBody(req *http.Request) ([]byte, error) {
+	if req.Body == nil || req.Body == http.NoBody {
+		return nil, nil
+	}
+	defer req.Body.Close()
+
+	data, err := io.ReadAll(req.Body)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read request body: %w", err)
+	}
+	return data, nil
+}
+
+// withBody 复制一个带新请求体的请求，RoundTripper不能改调用方的请求
+func withBody(req *http.Request, body []byte) *http.Request {
+	if body == nil {
+		return req
+	}
+	r := req.Clone(req.Context())
+	r.Body = io.NopCloser(bytes.NewReader(body))
+	return r
+}
+
+// canonicalURL 查询参数排好序的URL
+func canonicalURL(raw string) string {
+	u, err := url.Parse(raw)
+	if err != nil {
+		return raw
+	}
+	u.RawQuery = u.Query().Encode()
+	return u.String()
+}
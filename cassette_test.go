@@ -0,0 +1,196 @@
+package crawlab
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+// recordCassette 对测试服务器录一盘磁带，返回磁带路径
+func recordCassette(t *testing.T, urls ...string) string {
+	t.Helper()
+
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Set-Cookie", "session=secret")
+		w.Write([]byte("page " + r.URL.Path))
+	}))
+	defer srv.Close()
+
+	path := filepath.Join(t.TempDir(), "cassette.json")
+	cassette, err := NewCassetteTransport(path, CassetteAuto)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if cassette.Mode != CassetteRecord {
+		t.Fatalf("Mode = %v, want record for a missing file", cassette.Mode)
+	}
+
+	client := NewHTTPClient(5 * time.Second)
+	client.SetCassette(cassette)
+	for _, u := range urls {
+		resp, err := client.Get(context.Background(), srv.URL+u)
+		if err != nil {
+			t.Fatal(err)
+		}
+		resp.Body.Close()
+	}
+	if err := cassette.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	// 回放时服务器已经关了，地址换成固定的方便匹配
+	replaceInFile(t, path, srv.URL, "http://cassette.test")
+	return path
+}
+
+// replaceInFile 替换文件里的字符串
+func replaceInFile(t *testing.T, path, old, new string) {
+	t.Helper()
+	var its []Interaction
+	if err := readJSONFile(path, &its); err != nil {
+		t.Fatalf("cassette is not valid JSON: %v", err)
+	}
+	for i := range its {
+		its[i].Request.URL = strings.Replace(its[i].Request.URL, old, new, 1)
+	}
+	if err := writeJSONFile(path, its); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestCassetteReplay(t *testing.T) {
+	path := recordCassette(t, "/a", "/b", "/a?token=abc")
+
+	cassette, err := NewCassetteTransport(path, CassetteAuto)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if cassette.Mode != CassetteReplay {
+		t.Fatalf("Mode = %v, want replay for an existing file", cassette.Mode)
+	}
+	client := NewHTTPClient(5 * time.Second)
+	client.SetCassette(cassette)
+
+	tests := []struct {
+		url      string
+		wantBody string
+		wantErr  error
+	}{
+		{"http://cassette.test/b", "page /b", nil},
+		{"http://cassette.test/a", "page /a", nil},
+		{"http://cassette.test/a?token=other", "page /a", nil}, // token脱敏后和录制的一样
+		{"http://cassette.test/a", "", ErrCassetteMiss},        // 录制时只请求了一次
+		{"http://cassette.test/missing", "", ErrCassetteMiss},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.url, func(t *testing.T) {
+			resp, err := client.Get(context.Background(), tt.url)
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("err = %v, want %v", err, tt.wantErr)
+			}
+			if err != nil {
+				return
+			}
+			defer resp.Body.Close()
+			body, _ := io.ReadAll(resp.Body)
+			if string(body) != tt.wantBody {
+				t.Errorf("body = %q, want %q", body, tt.wantBody)
+			}
+			if got := resp.Header.Get("Set-Cookie"); got != redactedValue {
+				t.Errorf("Set-Cookie = %q, want redacted", got)
+			}
+		})
+	}
+
+	if n := cassette.Unused(); n != 0 {
+		t.Errorf("Unused = %d, want 0", n)
+	}
+}
+
+func TestCassetteProxyPoolOrder(t *testing.T) {
+	tests := []struct {
+		name          string
+		cassetteFirst bool
+	}{
+		{"cassette then proxy pool", true},
+		{"proxy pool then cassette", false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			pool, err := NewProxyPool(ProxyRoundRobin, "http://127.0.0.1:3128")
+			if err != nil {
+				t.Fatal(err)
+			}
+			cassette, err := NewCassetteTransport(filepath.Join(t.TempDir(), "c.json"), CassetteRecord)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			client := NewHTTPClient(time.Second)
+			if tt.cassetteFirst {
+				client.SetCassette(cassette)
+				client.SetProxyPool(pool)
+			} else {
+				client.SetProxyPool(pool)
+				client.SetCassette(cassette)
+			}
+
+			if client.Client.Transport != cassette {
+				t.Fatalf("cassette is not the outermost transport")
+			}
+			next, ok := cassette.Next.(*http.Transport)
+			if !ok || next.Proxy == nil {
+				t.Errorf("proxy pool not installed behind the cassette")
+			}
+		})
+	}
+}
+
+func TestCassetteRecordBodyLimit(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(strings.Repeat("x", len(r.URL.Path))))
+	}))
+	defer srv.Close()
+
+	cassette, err := NewCassetteTransport(filepath.Join(t.TempDir(), "c.json"), CassetteRecord)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cassette.MaxBodySize = 8
+	client := NewHTTPClient(5 * time.Second)
+	client.SetCassette(cassette)
+
+	tests := []struct {
+		path     string
+		recorded int
+	}{
+		{"/short", 1},
+		{"/exactly", 2},       // 正好8字节
+		{"/too-long-path", 2}, // 超了不录，但响应体要完整
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.path, func(t *testing.T) {
+			resp, err := client.Get(context.Background(), srv.URL+tt.path)
+			if err != nil {
+				t.Fatal(err)
+			}
+			body, _ := io.ReadAll(resp.Body)
+			resp.Body.Close()
+			if len(body) != len(tt.path) {
+				t.Errorf("body length = %d, want %d", len(body), len(tt.path))
+			}
+			if n := len(cassette.Interactions()); n != tt.recorded {
+				t.Errorf("recorded %d interactions, want %d", n, tt.recorded)
+			}
+		})
+	}
+}
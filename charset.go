@@ -0,0 +1,468 @@
+package crawlab
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"mime"
+	"strings"
+	"sync"
+	"unicode/utf8"
+)
+
+// ErrUnsupportedCharset 不支持的字符编码
+var ErrUnsupportedCharset = errors.New("unsupported charset")
+
+// 规范化之后的编码名
+const (
+	CharsetUTF8        = "utf-8"
+	CharsetUTF16LE     = "utf-16le"
+	CharsetUTF16BE     = "utf-16be"
+	CharsetGBK         = "gbk" // 包括GB2312，GB18030的四字节部分解成U+FFFD
+	CharsetBig5        = "big5"
+	CharsetShiftJIS    = "shift_jis"
+	CharsetEUCJP       = "euc-jp"
+	CharsetWindows1252 = "windows-1252" // 包括ISO-8859-1和ASCII，和浏览器一致
+)
+
+// charsetAliases 编码别名，key都是小写
+var charsetAliases = map[string]string{
+	"utf-8":             CharsetUTF8,
+	"utf8":              CharsetUTF8,
+	"unicode-1-1-utf-8": CharsetUTF8,
+
+	"utf-16":   CharsetUTF16LE,
+	"utf-16le": CharsetUTF16LE,
+	"utf-16be": CharsetUTF16BE,
+
+	"gbk":         CharsetGBK,
+	"gb2312":      CharsetGBK,
+	"gb18030":     CharsetGBK,
+	"gb_2312-80":  CharsetGBK,
+	"csgb2312":    CharsetGBK,
+	"x-gbk":       CharsetGBK,
+	"cp936":       CharsetGBK,
+	"windows-936": CharsetGBK,
+	"euc-cn":      CharsetGBK,
+	"chinese":     CharsetGBK,
+
+	"big5":       CharsetBig5,
+	"big5-hkscs": CharsetBig5,
+	"cn-big5":    CharsetBig5,
+	"csbig5":     CharsetBig5,
+	"x-x-big5":   CharsetBig5,
+	"cp950":      CharsetBig5,
+
+	"shift_jis":   CharsetShiftJIS,
+	"shift-jis":   CharsetShiftJIS,
+	"sjis":        CharsetShiftJIS,
+	"x-sjis":      CharsetShiftJIS,
+	"ms_kanji":    CharsetShiftJIS,
+	"csshiftjis":  CharsetShiftJIS,
+	"windows-31j": CharsetShiftJIS,
+	"cp932":       CharsetShiftJIS,
+
+	"euc-jp":   CharsetEUCJP,
+	"x-euc-jp": CharsetEUCJP,
+	"eucjp":    CharsetEUCJP,
+
+	"windows-1252": CharsetWindows1252,
+	"cp1252":       CharsetWindows1252,
+	"x-cp1252":     CharsetWindows1252,
+	"iso-8859-1":   CharsetWindows1252,
+	"iso8859-1":    CharsetWindows1252,
+	"latin1":       CharsetWindows1252,
+	"l1":           CharsetWindows1252,
+	"us-ascii":     CharsetWindows1252,
+	"ascii":        CharsetWindows1252,
+}
+
+// NormalizeCharset 把编码别名规范化，不认识的返回空字符串
+//
+// 艹！网页上写的编码名五花八门，GB2312、gb_2312-80、x-gbk其实都按GBK解
+func NormalizeCharset(label string) string {
+	label = strings.ToLower(strings.Trim(strings.TrimSpace(label), `"'`))
+	return charsetAliases[label]
+}
+
+// DetectCharset 检测响应体的编码
+//
+// 艹！顺序和浏览器差不多：BOM → Content-Type的charset → 前1024字节里的<meta>和<?xml?>声明
+// 都没有的话，是合法UTF-8就当UTF-8，能按GBK解开就当GBK，否则当Windows-1252
+func DetectCharset(contentType string, data []byte) string {
+	if cs := bomCharset(data); cs != "" {
+		return cs
+	}
+	if _, params, err := mime.ParseMediaType(contentType); err == nil {
+		if cs := NormalizeCharset(params["charset"]); cs != "" {
+			return cs
+		}
+	}
+	if cs := sniffCharset(data); cs != "" {
+		return cs
+	}
+
+	if utf8.Valid(data) {
+		return CharsetUTF8
+	}
+	if text := decodeGBK(data); !strings.ContainsRune(text, utf8.RuneError) {
+		return CharsetGBK
+	}
+	return CharsetWindows1252
+}
+
+// DecodeCharset 按指定编码把字节解成UTF-8字符串
+//
+// 艹！解不出来的字节变成U+FFFD，不会报错；只有编码不认识才返回ErrUnsupportedCharset
+func DecodeCharset(data []byte, charset string) (string, error) {
+	cs := NormalizeCharset(charset)
+	if cs == "" {
+		return "", fmt.Errorf("%w: %q", ErrUnsupportedCharset, charset)
+	}
+
+	switch cs {
+	case CharsetUTF8:
+		data = bytes.TrimPrefix(data, []byte("\xef\xbb\xbf"))
+		return strings.ToValidUTF8(string(data), "�"), nil
+	case CharsetUTF16LE:
+		return decodeUTF16(bytes.TrimPrefix(data, []byte("\xff\xfe")), false), nil
+	case CharsetUTF16BE:
+		return decodeUTF16(bytes.TrimPrefix(data, []byte("\xfe\xff")), true), nil
+	case CharsetGBK:
+		return decodeGBK(data), nil
+	case CharsetBig5:
+		return decodeBig5(data), nil
+	case CharsetShiftJIS:
+		return decodeShiftJIS(data), nil
+	case CharsetEUCJP:
+		return decodeEUCJP(data), nil
+	default:
+		return decodeWindows1252(data), nil
+	}
+}
+
+// bomCharset 根据BOM判断编码
+func bomCharset(data []byte) string {
+	switch {
+	case bytes.HasPrefix(data, []byte("\xef\xbb\xbf")):
+		return CharsetUTF8
+	case bytes.HasPrefix(data, []byte("\xff\xfe")):
+		return CharsetUTF16LE
+	case bytes.HasPrefix(data, []byte("\xfe\xff")):
+		return CharsetUTF16BE
+	}
+	return ""
+}
+
+// sniffCharset 从前1024字节的<meta charset>、<meta http-equiv>和<?xml encoding?>里找编码
+//
+// 艹！能写进ASCII里的声明不可能是UTF-16，所以声明成UTF-16的按UTF-8处理
+func sniffCharset(data []byte) string {
+	if len(data) > 1024 {
+		data = data[:1024]
+	}
+	head := strings.ToLower(string(data))
+
+	if strings.HasPrefix(head, "<?xml") {
+		if end := strings.Index(head, "?>"); end > 0 {
+			if cs := attrCharset(head[:end], "encoding="); cs != "" {
+				return cs
+			}
+		}
+	}
+
+	for {
+		i := strings.Index(head, "<meta")
+		if i < 0 {
+			return ""
+		}
+		head = head[i+len("<meta"):]
+		end := strings.IndexByte(head, '>')
+		if end < 0 {
+			return ""
+		}
+		if cs := attrCharset(head[:end], "charset="); cs != "" {
+			return cs
+		}
+		head = head[end:]
+	}
+}
+
+// attrCharset 从标签内容里取key后面的编码名
+func attrCharset(tag, key string) string {
+	i := strings.Index(tag, key)
+	if i < 0 {
+		return ""
+	}
+	value := strings.TrimLeft(tag[i+len(key):], " \t\r\n\"'")
+	if end := strings.IndexAny(value, " \t\r\n\"';/>"); end >= 0 {
+		value = value[:end]
+	}
+
+	cs := NormalizeCharset(value)
+	if cs == CharsetUTF16LE || cs == CharsetUTF16BE {
+		return CharsetUTF8
+	}
+	return cs
+}
+
+// decodeUTF16 解UTF-16，落单的代理项变成U+FFFD
+func decodeUTF16(data []byte, bigEndian bool) string {
+	var b strings.Builder
+	b.Grow(len(data))
+	for i := 0; i+1 < len(data); i += 2 {
+		u := rune(data[i]) | rune(data[i+1])<<8
+		if bigEndian {
+			u = rune(data[i])<<8 | rune(data[i+1])
+		}
+		if u >= 0xD800 && u < 0xDC00 && i+3 < len(data) {
+			lo := rune(data[i+2]) | rune(data[i+3])<<8
+			if bigEndian {
+				lo = rune(data[i+2])<<8 | rune(data[i+3])
+			}
+			if lo >= 0xDC00 && lo < 0xE000 {
+				b.WriteRune(0x10000 + (u-0xD800)<<10 + (lo - 0xDC00))
+				i += 2
+				continue
+			}
+		}
+		b.WriteRune(u) // 落单的代理项WriteRune会写成U+FFFD
+	}
+	if len(data)%2 == 1 {
+		b.WriteRune(utf8.RuneError)
+	}
+	return b.String()
+}
+
+// windows1252High Windows-1252的0x80-0x9F，没定义的位置按ISO-8859-1原样映射
+var windows1252High = [32]rune{
+	'€', '\u0081', '‚', 'ƒ', '„', '…', '†', '‡',
+	'ˆ', '‰', 'Š', '‹', 'Œ', '\u008D', 'Ž', '\u008F',
+	'\u0090', '‘', '’', '“', '”', '•', '–', '—',
+	'˜', '™', 'š', '›', 'œ', '\u009D', 'ž', 'Ÿ',
+}
+
+// decodeWindows1252 解Windows-1252（ISO-8859-1的超集）
+func decodeWindows1252(data []byte) string {
+	var b strings.Builder
+	b.Grow(len(data))
+	for _, c := range data {
+		switch {
+		case c < 0x80:
+			b.WriteByte(c)
+		case c < 0xA0:
+			b.WriteRune(windows1252High[c-0x80])
+		default:
+			b.WriteRune(rune(c))
+		}
+	}
+	return b.String()
+}
+
+// doubleByteTable 懒加载的双字节码表
+type doubleByteTable struct {
+	once  sync.Once
+	src   string
+	runes []rune
+}
+
+// lookup 取第i个位置的字符
+func (t *doubleByteTable) lookup(i int) rune {
+	t.once.Do(func() { t.runes = []rune(t.src) })
+	if i < 0 || i >= len(t.runes) {
+		return utf8.RuneError
+	}
+	return t.runes[i]
+}
+
+var (
+	gbkRunes  = &doubleByteTable{src: gbkTable}
+	big5Runes = &doubleByteTable{src: big5Table}
+	sjisRunes = &doubleByteTable{src: sjisTable}
+)
+
+// doubleByteDecoder 通用的双字节解码流程
+//
+// 艹！single处理单字节，返回ok=false表示这是首字节；
+// pair返回-1表示尾字节不合法，这时候尾字节如果是ASCII就不吃掉，和浏览器一致
+func doubleByteDecoder(data []byte, single func(c byte) (rune, bool), pair func(lead, trail byte) rune) string {
+	var b strings.Builder
+	b.Grow(len(data) * 3 / 2)
+	for i := 0; i < len(data); i++ {
+		c := data[i]
+		if r, ok := single(c); ok {
+			b.WriteRune(r)
+			continue
+		}
+		if i+1 >= len(data) {
+			b.WriteRune(utf8.RuneError)
+			break
+		}
+		r := pair(c, data[i+1])
+		if r < 0 {
+			b.WriteRune(utf8.RuneError)
+			if data[i+1] >= 0x80 {
+				i++
+			}
+			continue
+		}
+		b.WriteRune(r)
+		i++
+	}
+	return b.String()
+}
+
+// decodeGBK 解GBK/GB2312/GB18030
+func decodeGBK(data []byte) string {
+	var b strings.Builder
+	b.Grow(len(data) * 3 / 2)
+	for i := 0; i < len(data); i++ {
+		c := data[i]
+		switch {
+		case c < 0x80:
+			b.WriteByte(c)
+			continue
+		case c == 0x80:
+			b.WriteRune('€')
+			continue
+		case c == 0xFF || i+1 >= len(data):
+			b.WriteRune(utf8.RuneError)
+			continue
+		}
+
+		t := data[i+1]
+		switch {
+		case t >= 0x30 && t <= 0x39:
+			// GB18030四字节，码表太大没带，整个跳过
+			b.WriteRune(utf8.RuneError)
+			if i+3 < len(data) {
+				i += 3
+			} else {
+				i = len(data)
+			}
+		case t >= 0x40 && t <= 0xFE && t != 0x7F:
+			trail := int(t) - 0x40
+			if t > 0x7F {
+				trail--
+			}
+			b.WriteRune(gbkRunes.lookup(int(c-0x81)*190 + trail))
+			i++
+		default:
+			b.WriteRune(utf8.RuneError)
+			if t >= 0x80 {
+				i++
+			}
+		}
+	}
+	return b.String()
+}
+
+// decodeBig5 解Big5
+func decodeBig5(data []byte) string {
+	return doubleByteDecoder(data,
+		func(c byte) (rune, bool) {
+			if c < 0x80 {
+				return rune(c), true
+			}
+			if c == 0x80 || c == 0xFF {
+				return utf8.RuneError, true
+			}
+			return 0, false
+		},
+		func(lead, trail byte) rune {
+			var t int
+			switch {
+			case trail >= 0x40 && trail <= 0x7E:
+				t = int(trail) - 0x40
+			case trail >= 0xA1 && trail <= 0xFE:
+				t = int(trail) - 0xA1 + 63
+			default:
+				return -1
+			}
+			return big5Runes.lookup(int(lead-0x81)*157 + t)
+		})
+}
+
+// sjisSingle Shift-JIS的单字节部分，包括半角片假名
+func sjisSingle(c byte) (rune, bool) {
+	switch {
+	case c < 0x80:
+		return rune(c), true
+	case c >= 0xA1 && c <= 0xDF:
+		return 0xFF61 + rune(c-0xA1), true
+	case (c >= 0x81 && c <= 0x9F) || (c >= 0xE0 && c <= 0xFC):
+		return 0, false
+	}
+	return utf8.RuneError, true
+}
+
+// sjisPair 查Shift-JIS双字节码表
+func sjisPair(lead, trail byte) rune {
+	if trail < 0x40 || trail > 0xFC || trail == 0x7F {
+		return -1
+	}
+	l := int(lead) - 0x81
+	if lead >= 0xE0 {
+		l = int(lead) - 0xE0 + 31
+	}
+	t := int(trail) - 0x40
+	if trail > 0x7F {
+		t--
+	}
+	return sjisRunes.lookup(l*188 + t)
+}
+
+// decodeShiftJIS 解Shift-JIS（按Windows-31J）
+func decodeShiftJIS(data []byte) string {
+	return doubleByteDecoder(data, sjisSingle, sjisPair)
+}
+
+// decodeEUCJP 解EUC-JP
+//
+// 艹！JIS X 0208部分换算成Shift-JIS再查表，JIS X 0212（0x8F开头）解成U+FFFD
+func decodeEUCJP(data []byte) string {
+	var b strings.Builder
+	b.Grow(len(data) * 3 / 2)
+	for i := 0; i < len(data); i++ {
+		c := data[i]
+		if c < 0x80 {
+			b.WriteByte(c)
+			continue
+		}
+		if i+1 >= len(data) {
+			b.WriteRune(utf8.RuneError)
+			break
+		}
+
+		t := data[i+1]
+		switch {
+		case c == 0x8E && t >= 0xA1 && t <= 0xDF:
+			b.WriteRune(0xFF61 + rune(t-0xA1))
+			i++
+		case c == 0x8F && t >= 0xA1 && t <= 0xFE:
+			b.WriteRune(utf8.RuneError)
+			i += 2
+		case c >= 0xA1 && c <= 0xFE && t >= 0xA1 && t <= 0xFE:
+			j1, j2 := c-0x80, t-0x80
+			lead := (j1+1)/2 + 0x70
+			if j1 > 0x5E {
+				lead = (j1+1)/2 + 0xB0
+			}
+			trail := j2 + 0x7E
+			if j1%2 == 1 {
+				trail = j2 + 0x1F
+				if j2 >= 0x60 {
+					trail++
+				}
+			}
+			b.WriteRune(sjisPair(lead, trail))
+			i++
+		default:
+			b.WriteRune(utf8.RuneError)
+			if t >= 0x80 {
+				i++
+			}
+		}
+	}
+	return b.String()
+}
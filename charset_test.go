@@ -0,0 +1,97 @@
+package crawlab
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestNormalizeCharset(t *testing.T) {
+	tests := []struct {
+		label string
+		want  string
+	}{
+		{"UTF-8", CharsetUTF8},
+		{` "utf8" `, CharsetUTF8},
+		{"GB2312", CharsetGBK},
+		{"gb18030", CharsetGBK},
+		{"Big5-HKSCS", CharsetBig5},
+		{"Windows-31J", CharsetShiftJIS},
+		{"EUC-JP", CharsetEUCJP},
+		{"ISO-8859-1", CharsetWindows1252},
+		{"utf-16", CharsetUTF16LE},
+		{"koi8-r", ""},
+		{"", ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.label, func(t *testing.T) {
+			if got := NormalizeCharset(tt.label); got != tt.want {
+				t.Errorf("NormalizeCharset(%q) = %q, want %q", tt.label, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestDetectCharset(t *testing.T) {
+	tests := []struct {
+		name        string
+		contentType string
+		data        string
+		want        string
+	}{
+		{"utf-8 bom beats header", "text/html; charset=gbk", "\xef\xbb\xbfabc", CharsetUTF8},
+		{"utf-16le bom", "", "\xff\xfea\x00", CharsetUTF16LE},
+		{"utf-16be bom", "", "\xfe\xff\x00a", CharsetUTF16BE},
+		{"header", "text/html; charset=Shift_JIS", "<html>", CharsetShiftJIS},
+		{"header beats meta", "text/html; charset=big5", `<meta charset="gbk">`, CharsetBig5},
+		{"unknown header falls back to meta", "text/html; charset=x-unknown", `<meta charset="gbk">`, CharsetGBK},
+		{"meta charset", "text/html", `<html><head><meta charset="euc-jp"></head>`, CharsetEUCJP},
+		{"meta http-equiv", "", `<meta http-equiv="Content-Type" content="text/html; charset=gb2312">`, CharsetGBK},
+		{"valid utf-8", "", "中文", CharsetUTF8},
+		{"gbk bytes", "", "\xd6\xd0\xce\xc4", CharsetGBK},
+		{"latin1 fallback", "", "caf\xe9 \xff", CharsetWindows1252},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := DetectCharset(tt.contentType, []byte(tt.data)); got != tt.want {
+				t.Errorf("DetectCharset = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestDecodeCharset(t *testing.T) {
+	tests := []struct {
+		name    string
+		charset string
+		data    string
+		want    string
+		wantErr error
+	}{
+		{"utf-8 strips bom", "utf-8", "\xef\xbb\xbfabc", "abc", nil},
+		{"utf-8 invalid bytes", "utf-8", "a\xffb", "a�b", nil},
+		{"utf-16le", "utf-16le", "\xff\xfe-N\x87e", "中文", nil},
+		{"utf-16be", "utf-16be", "\x4e\x2d\x65\x87", "中文", nil},
+		{"utf-16 surrogate pair", "utf-16le", "\x3d\xd8\x00\xde", "😀", nil},
+		{"gbk", "gb2312", "\xd6\xd0\xce\xc4abc", "中文abc", nil},
+		{"big5", "big5", "\xa4\xa4\xa4\xe5", "中文", nil},
+		{"shift_jis", "sjis", "\x93\xfa\x96\x7b", "日本", nil},
+		{"shift_jis half-width katakana", "shift_jis", "\xb1", "ｱ", nil},
+		{"euc-jp", "euc-jp", "\xc6\xfc\xcb\xdc", "日本", nil},
+		{"windows-1252", "latin1", "caf\xe9 \x80", "café €", nil},
+		{"unsupported", "koi8-r", "abc", "", ErrUnsupportedCharset},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := DecodeCharset([]byte(tt.data), tt.charset)
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("err = %v, want %v", err, tt.wantErr)
+			}
+			if got != tt.want {
+				t.Errorf("DecodeCharset = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,359 @@
+package crawlab
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// CircuitState 熔断器状态
+type CircuitState int
+
+const (
+	CircuitClosed   CircuitState = iota // 关闭：正常放行
+	CircuitOpen                         // 打开：直接拒绝
+	CircuitHalfOpen                     // 半开：放少量请求试探
+)
+
+// String 返回状态名称
+func (s CircuitState) String() string {
+	switch s {
+	case CircuitClosed:
+		return "closed"
+	case CircuitOpen:
+		return "open"
+	case CircuitHalfOpen:
+		return "half-open"
+	default:
+		return fmt.Sprintf("state(%d)", int(s))
+	}
+}
+
+// ErrCircuitOpen 熔断器打开，请求被拒绝
+var ErrCircuitOpen = errors.New("circuit breaker is open")
+
+// outcome 一次调用结果
+type outcome struct {
+	at time.Time
+	ok bool
+}
+
+// CircuitBreaker 熔断器
+//
+// 艹！目标站挂了就别再一个劲儿地打了：
+//   - 关闭：统计Window内的失败率，请求数>=MinRequests且失败率>=FailureRate时打开
+//   - 打开：Cooldown内直接返回ErrCircuitOpen
+//   - 半开：冷却结束后放HalfOpenRequests个请求试探，全成功就关闭，失败一次就重新打开
+type CircuitBreaker struct {
+	Name             string        // 名称，日志里用
+	FailureRate      float64       // 触发熔断的失败率（0~1）
+	Window           time.Duration // 统计窗口
+	Cooldown         time.Duration // 打开后的冷却时间
+	MinRequests      int           // 窗口内至少多少请求才判断失败率（默认5）
+	HalfOpenRequests int           // 半开状态放行的试探请求数（默认1）
+
+	// OnStateChange 状态变化回调（在锁外调用）
+	OnStateChange func(name string, from, to CircuitState)
+
+	mu        sync.Mutex
+	state     CircuitState
+	outcomes  []outcome
+	openedAt  time.Time
+	probes    int // 半开状态已放行的请求数
+	successes int // 半开状态成功的请求数
+	rejected  int64
+	now       func() time.Time // 时钟，测试里替换掉就不用真的等冷却
+}
+
+// NewCircuitBreaker 创建熔断器
+func NewCircuitBreaker(name string, failureRate float64, window, cooldown time.Duration) *CircuitBreaker {
+	return &CircuitBreaker{
+		Name:             name,
+		FailureRate:      failureRate,
+		Window:           window,
+		Cooldown:         cooldown,
+		MinRequests:      5,
+		HalfOpenRequests: 1,
+	}
+}
+
+// State 返回当前状态
+func (b *CircuitBreaker) State() CircuitState {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.currentState(b.clock())
+}
+
+// Rejected 返回被拒绝的请求数
+func (b *CircuitBreaker) Rejected() int64 {
+	return atomic.LoadInt64(&b.rejected)
+}
+
+// Allow 判断是否放行，不放行时返回ErrCircuitOpen
+//
+// 艹！放行之后必须调用Record报告结果
+func (b *CircuitBreaker) Allow() error {
+	b.mu.Lock()
+	now := b.clock()
+	from := b.state
+	state := b.currentState(now)
+
+	allowed := true
+	switch state {
+	case CircuitOpen:
+		allowed = false
+	case CircuitHalfOpen:
+		if b.probes >= b.halfOpenLimit() {
+			allowed = false
+		} else {
+			b.probes++
+		}
+	}
+	b.mu.Unlock()
+
+	b.notify(from, state)
+
+	if !allowed {
+		atomic.AddInt64(&b.rejected, 1)
+		return fmt.Errorf("%w: %s", ErrCircuitOpen, b.Name)
+	}
+	return nil
+}
+
+// Record 报告一次调用结果
+func (b *CircuitBreaker) Record(success bool) {
+	b.mu.Lock()
+	now := b.clock()
+	from := b.state
+	to := b.currentState(now)
+
+	switch to {
+	case CircuitHalfOpen:
+		if !success {
+			to = b.transition(CircuitOpen, now)
+		} else if b.successes++; b.successes >= b.halfOpenLimit() {
+			to = b.transition(CircuitClosed, now)
+		}
+
+	case CircuitClosed:
+		b.outcomes = append(b.outcomes, outcome{at: now, ok: success})
+		b.prune(now)
+		if b.shouldTrip() {
+			to = b.transition(CircuitOpen, now)
+		}
+	}
+	b.mu.Unlock()
+
+	b.notify(from, to)
+}
+
+// Execute 通过熔断器执行fn
+//
+// 艹！被拒绝时返回包了ErrCircuitOpen的错误，fn不会执行
+func (b *CircuitBreaker) Execute(fn RetryFunc) error {
+	if err := b.Allow(); err != nil {
+		return err
+	}
+	err := fn()
+	b.Record(err == nil)
+	return err
+}
+
+// Wrap 包装RetryFunc，配合Retry使用
+//
+// 艹！熔断打开时返回Permanent错误，Retrier不会再傻等着重试
+//
+//	crawlab.Retry(breaker.Wrap(fn), 3, time.Second)
+func (b *CircuitBreaker) Wrap(fn RetryFunc) RetryFunc {
+	return func() error {
+		err := b.Execute(fn)
+		if errors.Is(err, ErrCircuitOpen) {
+			return Permanent(err)
+		}
+		return err
+	}
+}
+
+// report 按HTTP结果记录：连接错误和5xx算失败，请求被取消不计入
+func (b *CircuitBreaker) report(err error, resp *http.Response) {
+	if err != nil && errors.Is(err, context.Canceled) {
+		b.release()
+		return
+	}
+	b.Record(err == nil && resp.StatusCode < 500)
+}
+
+// release 放弃一次已放行的调用，不计成败
+func (b *CircuitBreaker) release() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.state == CircuitHalfOpen && b.probes > 0 {
+		b.probes--
+	}
+}
+
+// clock 当前时间
+func (b *CircuitBreaker) clock() time.Time {
+	if b.now != nil {
+		return b.now()
+	}
+	return time.Now()
+}
+
+// currentState 冷却结束时从打开转为半开，调用方必须持有锁
+func (b *CircuitBreaker) currentState(now time.Time) CircuitState {
+	if b.state == CircuitOpen && now.Sub(b.openedAt) >= b.Cooldown {
+		return b.transition(CircuitHalfOpen, now)
+	}
+	return b.state
+}
+
+// transition 切换状态并重置计数，调用方必须持有锁
+func (b *CircuitBreaker) transition(to CircuitState, now time.Time) CircuitState {
+	b.state = to
+	b.probes = 0
+	b.successes = 0
+	switch to {
+	case CircuitOpen:
+		b.openedAt = now
+	case CircuitClosed:
+		b.outcomes = nil
+	}
+	return to
+}
+
+// prune 丢掉窗口外的结果，调用方必须持有锁
+func (b *CircuitBreaker) prune(now time.Time) {
+	cutoff := now.Add(-b.Window)
+	i := 0
+	for i < len(b.outcomes) && b.outcomes[i].at.Before(cutoff) {
+		i++
+	}
+	b.outcomes = b.outcomes[i:]
+}
+
+// shouldTrip 判断失败率是否超标，调用方必须持有锁
+func (b *CircuitBreaker) shouldTrip() bool {
+	minRequests := b.MinRequests
+	if minRequests < 1 {
+		minRequests = 1
+	}
+	if len(b.outcomes) < minRequests {
+		return false
+	}
+
+	failures := 0
+	for _, o := range b.outcomes {
+		if !o.ok {
+			failures++
+		}
+	}
+	return float64(failures)/float64(len(b.outcomes)) >= b.FailureRate
+}
+
+// halfOpenLimit 半开状态的试探请求数
+func (b *CircuitBreaker) halfOpenLimit() int {
+	if b.HalfOpenRequests < 1 {
+		return 1
+	}
+	return b.HalfOpenRequests
+}
+
+// notify 记录状态变化并回调
+func (b *CircuitBreaker) notify(from, to CircuitState) {
+	if from == to {
+		return
+	}
+	LogWarn("Circuit breaker %s: %s -> %s", b.Name, from, to)
+	if b.OnStateChange != nil {
+		b.OnStateChange(b.Name, from, to)
+	}
+}
+
+// HostBreakers 按host分组的熔断器
+//
+// 艹！给HTTPClient用，每个host一个熔断器，一个站挂了不影响别的站
+type HostBreakers struct {
+	FailureRate float64       // 见CircuitBreaker
+	Window      time.Duration // 见CircuitBreaker
+	Cooldown    time.Duration // 见CircuitBreaker
+
+	mu        sync.Mutex
+	breakers  map[string]*CircuitBreaker
+	listeners []func(host string, from, to CircuitState)
+}
+
+// NewHostBreakers 创建按host分组的熔断器
+func NewHostBreakers(failureRate float64, window, cooldown time.Duration) *HostBreakers {
+	return &HostBreakers{
+		FailureRate: failureRate,
+		Window:      window,
+		Cooldown:    cooldown,
+		breakers:    make(map[string]*CircuitBreaker),
+	}
+}
+
+// Get 获取host对应的熔断器，不存在则创建
+func (h *HostBreakers) Get(host string) *CircuitBreaker {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	if b, ok := h.breakers[host]; ok {
+		return b
+	}
+
+	b := NewCircuitBreaker(host, h.FailureRate, h.Window, h.Cooldown)
+	b.OnStateChange = h.dispatch
+	h.breakers[host] = b
+	return b
+}
+
+// OnStateChange 注册状态变化监听
+func (h *HostBreakers) OnStateChange(fn func(host string, from, to CircuitState)) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.listeners = append(h.listeners, fn)
+}
+
+// Rejected 返回所有host被拒绝的请求总数
+func (h *HostBreakers) Rejected() int64 {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	var total int64
+	for _, b := range h.breakers {
+		total += b.Rejected()
+	}
+	return total
+}
+
+// States 返回每个host的当前状态
+func (h *HostBreakers) States() map[string]CircuitState {
+	h.mu.Lock()
+	breakers := make([]*CircuitBreaker, 0, len(h.breakers))
+	for _, b := range h.breakers {
+		breakers = append(breakers, b)
+	}
+	h.mu.Unlock()
+
+	states := make(map[string]CircuitState, len(breakers))
+	for _, b := range breakers {
+		states[b.Name] = b.State()
+	}
+	return states
+}
+
+// dispatch 把单个熔断器的状态变化转发给监听者
+func (h *HostBreakers) dispatch(host string, from, to CircuitState) {
+	h.mu.Lock()
+	listeners := append([]func(string, CircuitState, CircuitState){}, h.listeners...)
+	h.mu.Unlock()
+
+	for _, fn := range listeners {
+		fn(host, from, to)
+	}
+}
@@ -0,0 +1,193 @@
+package crawlab
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+)
+
+const testCooldown = time.Minute
+
+// breakerStep 熔断器测试的一步操作
+type breakerStep struct {
+	op        string // allow、ok、fail、release、cool（过完冷却）、tick（过一半冷却）、expire（过完窗口）
+	wantErr   bool   // allow是否被拒绝
+	wantState CircuitState
+}
+
+func TestCircuitBreakerTransitions(t *testing.T) {
+	tests := []struct {
+		name     string
+		halfOpen int
+		steps    []breakerStep
+	}{
+		{
+			name: "below min requests stays closed",
+			steps: []breakerStep{
+				{op: "fail", wantState: CircuitClosed},
+				{op: "fail", wantState: CircuitClosed},
+				{op: "allow", wantState: CircuitClosed},
+			},
+		},
+		{
+			name: "failure rate trips",
+			steps: []breakerStep{
+				{op: "ok", wantState: CircuitClosed},
+				{op: "fail", wantState: CircuitClosed},
+				{op: "fail", wantState: CircuitOpen},
+				{op: "allow", wantErr: true, wantState: CircuitOpen},
+			},
+		},
+		{
+			name: "stays open until cooldown ends",
+			steps: []breakerStep{
+				{op: "fail"}, {op: "fail"}, {op: "fail", wantState: CircuitOpen},
+				{op: "tick", wantState: CircuitOpen},
+				{op: "allow", wantErr: true, wantState: CircuitOpen},
+				{op: "tick", wantState: CircuitHalfOpen},
+			},
+		},
+		{
+			name: "failures outside the window are forgotten",
+			steps: []breakerStep{
+				{op: "fail"}, {op: "fail"},
+				{op: "expire", wantState: CircuitClosed},
+				{op: "ok"}, {op: "fail", wantState: CircuitClosed}, // 窗口里只有1成功1失败，不够MinRequests
+			},
+		},
+		{
+			name: "half-open success closes",
+			steps: []breakerStep{
+				{op: "fail"}, {op: "fail"}, {op: "fail", wantState: CircuitOpen},
+				{op: "cool", wantState: CircuitHalfOpen},
+				{op: "allow", wantState: CircuitHalfOpen},
+				{op: "allow", wantErr: true, wantState: CircuitHalfOpen}, // 只放一个试探请求
+				{op: "ok", wantState: CircuitClosed},
+				{op: "allow", wantState: CircuitClosed},
+			},
+		},
+		{
+			name: "half-open failure reopens",
+			steps: []breakerStep{
+				{op: "fail"}, {op: "fail"}, {op: "fail", wantState: CircuitOpen},
+				{op: "cool", wantState: CircuitHalfOpen},
+				{op: "allow", wantState: CircuitHalfOpen},
+				{op: "fail", wantState: CircuitOpen},
+				{op: "allow", wantErr: true, wantState: CircuitOpen},
+			},
+		},
+		{
+			name: "released probe frees the slot",
+			steps: []breakerStep{
+				{op: "fail"}, {op: "fail"}, {op: "fail", wantState: CircuitOpen},
+				{op: "cool", wantState: CircuitHalfOpen},
+				{op: "allow", wantState: CircuitHalfOpen},
+				{op: "release", wantState: CircuitHalfOpen},
+				{op: "allow", wantState: CircuitHalfOpen},
+			},
+		},
+		{
+			name:     "multiple probes must all succeed",
+			halfOpen: 2,
+			steps: []breakerStep{
+				{op: "fail"}, {op: "fail"}, {op: "fail", wantState: CircuitOpen},
+				{op: "cool", wantState: CircuitHalfOpen},
+				{op: "allow", wantState: CircuitHalfOpen},
+				{op: "allow", wantState: CircuitHalfOpen},
+				{op: "allow", wantErr: true, wantState: CircuitHalfOpen},
+				{op: "ok", wantState: CircuitHalfOpen},
+				{op: "ok", wantState: CircuitClosed},
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			// 假时钟，cool一步直接拨过冷却时间
+			now := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+			b := NewCircuitBreaker("test", 0.5, time.Hour, testCooldown)
+			b.now = func() time.Time { return now }
+			b.MinRequests = 3
+			if tt.halfOpen > 0 {
+				b.HalfOpenRequests = tt.halfOpen
+			}
+
+			for i, s := range tt.steps {
+				switch s.op {
+				case "allow":
+					err := b.Allow()
+					if (err != nil) != s.wantErr {
+						t.Fatalf("step %d: Allow() = %v, wantErr %v", i, err, s.wantErr)
+					}
+					if err != nil && !errors.Is(err, ErrCircuitOpen) {
+						t.Fatalf("step %d: Allow() = %v, want ErrCircuitOpen", i, err)
+					}
+				case "ok":
+					b.Record(true)
+				case "fail":
+					b.Record(false)
+				case "release":
+					b.report(context.Canceled, nil)
+				case "cool":
+					now = now.Add(testCooldown)
+				case "tick":
+					now = now.Add(testCooldown / 2)
+				case "expire":
+					now = now.Add(b.Window + time.Second)
+				}
+				if got := b.State(); got != s.wantState {
+					t.Fatalf("step %d (%s): state = %s, want %s", i, s.op, got, s.wantState)
+				}
+			}
+		})
+	}
+}
+
+func TestCircuitBreakerWrap(t *testing.T) {
+	b := NewCircuitBreaker("wrap", 0.5, time.Minute, time.Hour)
+	b.MinRequests = 1
+
+	calls := 0
+	fn := b.Wrap(func() error {
+		calls++
+		return errors.New("boom")
+	})
+
+	if err := fn(); err == nil || isPermanent(err) {
+		t.Fatalf("first call: err = %v, want retryable error", err)
+	}
+	err := fn()
+	if !errors.Is(err, ErrCircuitOpen) || !isPermanent(err) {
+		t.Fatalf("second call: err = %v, want permanent ErrCircuitOpen", err)
+	}
+	if calls != 1 {
+		t.Errorf("fn called %d times, want 1", calls)
+	}
+	if b.Rejected() != 1 {
+		t.Errorf("Rejected = %d, want 1", b.Rejected())
+	}
+}
+
+func TestHostBreakersIsolated(t *testing.T) {
+	h := NewHostBreakers(0.5, time.Minute, time.Hour)
+	a := h.Get("a.com")
+	a.MinRequests = 1
+	a.Record(false)
+
+	if a.State() != CircuitOpen {
+		t.Fatalf("a.com state = %s, want open", a.State())
+	}
+	if h.Get("a.com") != a {
+		t.Errorf("Get returned a different breaker for the same host")
+	}
+	if got := h.Get("b.com").Allow(); got != nil {
+		t.Errorf("b.com Allow() = %v, want nil", got)
+	}
+}
+
+// isPermanent 是否被标记为不可重试
+func isPermanent(err error) bool {
+	var perm *PermanentError
+	return errors.As(err, &perm)
+}
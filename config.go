@@ -2,13 +2,15 @@ package crawlab
 
 import (
 	"os"
+	"reflect"
 	"strconv"
 	"time"
 )
 
 // Config 爬虫配置
 //
-// 艹！从环境变量加载配置，设置合理的默认值
+// 艹！默认值 → 配置文件 → 环境变量 → 任务参数，逐层覆盖
+// 想加自己的配置项就嵌入Config，再用LoadConfigInto加载，见configload.go
 type Config struct {
 	// Crawlab环境信息
 	TaskID     string // 任务ID
@@ -18,16 +20,38 @@ type Config struct {
 	ScheduleID string // 调度ID
 
 	// 性能配置
-	MaxRetries     int           // 最大重试次数（默认3）
-	RetryDelay     time.Duration // 重试延迟（默认2秒）
-	RequestTimeout time.Duration // 请求超时（默认30秒）
-	MaxConcurrency int           // 最大并发数（默认10）
-	BatchSize      int           // 批量保存大小（默认100）
+	MaxRetries     int           `config:"max_retries" env:"CRAWLAB_MAX_RETRIES" default:"3"`           // 最大重试次数（默认3）
+	RetryDelay     time.Duration `config:"retry_delay" env:"CRAWLAB_RETRY_DELAY" default:"2s"`          // 重试延迟（默认2秒）
+	RequestTimeout time.Duration `config:"request_timeout" env:"CRAWLAB_REQUEST_TIMEOUT" default:"30s"` // 请求超时（默认30秒）
+	MaxConcurrency int           `config:"max_concurrency" env:"CRAWLAB_MAX_CONCURRENCY" default:"10"`  // 最大并发数（默认10）
+	BatchSize      int           `config:"batch_size" env:"CRAWLAB_BATCH_SIZE" default:"100"`           // 批量保存大小（默认100）
+
+	// 限流配置（见ratelimit.go）
+	RateLimit       float64       `config:"rate_limit" env:"CRAWLAB_RATE_LIMIT" default:"0"`              // 全局每秒请求数（默认0不限制）
+	HostRateLimit   float64       `config:"host_rate_limit" env:"CRAWLAB_HOST_RATE_LIMIT" default:"0"`    // 每个host每秒请求数（默认0不限制）
+	HostConcurrency int           `config:"host_concurrency" env:"CRAWLAB_HOST_CONCURRENCY" default:"0"`  // 每个host最大并发连接数（默认0不限制）
+	PolitenessDelay time.Duration `config:"politeness_delay" env:"CRAWLAB_POLITENESS_DELAY" default:"0s"` // 同一个host的请求间隔，实际随机0.5~1.5倍（默认0）
+
+	// 代理配置（见proxy.go）
+	Proxies   string `config:"proxies" env:"CRAWLAB_PROXIES" secret:"true"`               // 代理列表，逗号分隔（http/https/socks5），可能带用户名密码
+	ProxyFile string `config:"proxy_file" env:"CRAWLAB_PROXY_FILE"`                       // 代理文件，一行一个
+	ProxyMode string `config:"proxy_mode" env:"CRAWLAB_PROXY_MODE" default:"round-robin"` // 代理选择方式（round-robin/random/sticky）
+
+	// 缓存配置（见httpcache.go）
+	HTTPCache    string `config:"http_cache" env:"CRAWLAB_HTTP_CACHE" default:"off"`                 // 响应缓存模式（off/read-write/read-only/refresh）
+	HTTPCacheDir string `config:"http_cache_dir" env:"CRAWLAB_HTTP_CACHE_DIR" default:".cache/http"` // 响应缓存目录
+
+	// IPC配置
+	IPCTransport string `config:"ipc_transport" env:"CRAWLAB_IPC_TRANSPORT" default:"stdout"` // IPC传输通道（默认stdout）
+	LocalMode    bool   // 是否本地开发模式（数据写文件而不是stdout）
+
+	sources ConfigSources // 每个配置项的来源
 }
 
-// LoadConfig 从环境变量加载配置
+// LoadConfig 加载配置
 //
 // 艹！自动设置默认值，开箱即用
+// 某个配置项解析失败只会警告，继续用低一层的值
 func LoadConfig() *Config {
 	cfg := &Config{
 		// 加载Crawlab环境变量
@@ -36,21 +60,27 @@ func LoadConfig() *Config {
 		NodeID:     GetNodeID(),
 		Param:      GetParam(),
 		ScheduleID: GetScheduleID(),
-
-		// 默认性能配置
-		MaxRetries:     3,
-		RetryDelay:     2 * time.Second,
-		RequestTimeout: 30 * time.Second,
-		MaxConcurrency: 10,
-		BatchSize:      100,
 	}
 
-	// 从环境变量覆盖配置
-	cfg.MaxRetries = cfg.GetEnvInt("CRAWLAB_MAX_RETRIES", cfg.MaxRetries)
-	cfg.RetryDelay = cfg.GetEnvDuration("CRAWLAB_RETRY_DELAY", cfg.RetryDelay)
-	cfg.RequestTimeout = cfg.GetEnvDuration("CRAWLAB_REQUEST_TIMEOUT", cfg.RequestTimeout)
-	cfg.MaxConcurrency = cfg.GetEnvInt("CRAWLAB_MAX_CONCURRENCY", cfg.MaxConcurrency)
-	cfg.BatchSize = cfg.GetEnvInt("CRAWLAB_BATCH_SIZE", cfg.BatchSize)
+	// 默认值、配置文件、环境变量、任务参数逐层覆盖
+	sources, err := LoadConfigInto(cfg)
+	if err != nil {
+		LogWarn("%v", err)
+	}
+	cfg.LocalMode = IsLocalMode()
+
+	// 明确配置了IPC传输通道才切换（包括明确要stdout），没配置就保持默认：本地模式写文件，否则stdout
+	if v, ok := sources.Get("ipc_transport"); ok && v.Source != SourceDefault {
+		t, err := NewTransportFromSpec(cfg.IPCTransport)
+		if err != nil {
+			LogWarn("Failed to set IPC transport %s: %v, keeping the current one", cfg.IPCTransport, err)
+		} else if old := SetTransport(t); old != nil {
+			// 旧通道可能是文件或socket，不关就泄漏了
+			if err := old.Close(); err != nil {
+				LogWarn("Failed to close previous IPC transport: %v", err)
+			}
+		}
+	}
 
 	return cfg
 }
@@ -141,20 +171,70 @@ func (c *Config) Validate() error {
 		c.BatchSize = 1
 	}
 
+	if c.RateLimit < 0 {
+		LogWarn("RateLimit is negative, setting to 0")
+		c.RateLimit = 0
+	}
+
+	if c.HostRateLimit < 0 {
+		LogWarn("HostRateLimit is negative, setting to 0")
+		c.HostRateLimit = 0
+	}
+
+	if c.HostConcurrency < 0 {
+		LogWarn("HostConcurrency is negative, setting to 0")
+		c.HostConcurrency = 0
+	}
+
+	if c.PolitenessDelay < 0 {
+		LogWarn("PolitenessDelay is negative, setting to 0")
+		c.PolitenessDelay = 0
+	}
+
 	return nil
 }
 
+// setSources 记录配置来源，LoadConfigInto会调用
+func (c *Config) setSources(sources ConfigSources) {
+	c.sources = sources
+}
+
+// Sources 返回每个配置项的来源
+//
+// 艹！排查"为什么并发数不对"时看这个
+func (c *Config) Sources() ConfigSources {
+	return c.sources
+}
+
 // Print 打印配置信息
+//
+// 艹！通过LoadConfig/LoadConfigInto加载的配置会同时打印每项的来源，secret配置打码
+// 打印的总是当前值，加载之后被Validate或代码改过的会标出来
 func (c *Config) Print() {
 	LogInfo("========== 配置信息 ==========")
 	LogInfo("TaskID: %s", c.TaskID)
 	LogInfo("SpiderID: %s", c.SpiderID)
 	LogInfo("NodeID: %s", c.NodeID)
 	LogInfo("ScheduleID: %s", c.ScheduleID)
-	LogInfo("MaxRetries: %d", c.MaxRetries)
-	LogInfo("RetryDelay: %v", c.RetryDelay)
-	LogInfo("RequestTimeout: %v", c.RequestTimeout)
-	LogInfo("MaxConcurrency: %d", c.MaxConcurrency)
-	LogInfo("BatchSize: %d", c.BatchSize)
+	// 手动构造的Config没有来源记录，只打印当前值
+	values := configValues(configFields(reflect.ValueOf(c).Elem()))
+	for i, v := range values {
+		loaded, ok := c.sources.Get(v.Key)
+		switch {
+		case !ok:
+		case loaded.Value == v.Value:
+			values[i].Source = loaded.Source
+		default:
+			values[i].Source = "changed after load, was " + loaded.Display() + " from " + loaded.Source
+		}
+	}
+	for _, v := range values {
+		if v.Source == "" {
+			LogInfo("%s: %s", v.Field, v.Display())
+		} else {
+			LogInfo("%s: %s (%s)", v.Field, v.Display(), v.Source)
+		}
+	}
+	LogInfo("LocalMode: %v", c.LocalMode)
 	LogInfo("=============================")
 }
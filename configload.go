@@ -0,0 +1,260 @@
+package crawlab
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/url"
+	"os"
+	"reflect"
+	"strings"
+)
+
+// EnvConfigFile JSON配置文件路径的环境变量（可选）
+const EnvConfigFile = "CRAWLAB_CONFIG_FILE"
+
+// 配置来源
+const (
+	SourceDefault = "default" // default tag或代码里的初始值
+	SourceFile    = "file"    // JSON配置文件
+	SourceEnv     = "env"     // 环境变量
+	SourceParam   = "param"   // 任务参数
+)
+
+// ConfigValue 一个配置项的最终取值和来源
+type ConfigValue struct {
+	Key    string // 配置键（config tag）
+	Field  string // 结构体字段名
+	Value  string // 最终值
+	Source string // 来源，例如 default、file:crawlab.json、env:CRAWLAB_MAX_RETRIES、param
+	Secret bool   // 敏感配置（secret:"true"），打印时要打码
+}
+
+// Display 打印用的值，敏感配置打码
+func (v ConfigValue) Display() string {
+	if !v.Secret {
+		return v.Value
+	}
+	return maskSecret(v.Value)
+}
+
+// ConfigSources 所有配置项的来源记录，按字段顺序排列
+type ConfigSources []ConfigValue
+
+// Get 按配置键查找
+func (s ConfigSources) Get(key string) (ConfigValue, bool) {
+	for _, v := range s {
+		if v.Key == key {
+			return v, true
+		}
+	}
+	return ConfigValue{}, false
+}
+
+// configSourceSetter 嵌入了Config的结构体会自动拿到来源记录
+type configSourceSetter interface {
+	setSources(ConfigSources)
+}
+
+// LoadConfigInto 按层加载配置到结构体
+//
+// 艹！层级从低到高：default tag → JSON配置文件（CRAWLAB_CONFIG_FILE）→ 环境变量 → 任务参数
+// 字段声明方式：
+//
+//	Pages int `config:"pages" env:"MY_PAGES" default:"10"`
+//
+// 只有带config tag的字段会被加载，嵌入的结构体会递归处理
+// 密码、token之类的字段加上secret:"true"，Config.Print时会打码
+// 单个字段解析失败不会中断，所有错误汇总后返回
+func LoadConfigInto(v interface{}) (ConfigSources, error) {
+	return loadConfigLayers(v, os.Getenv(EnvConfigFile), GetParam())
+}
+
+// configField 一个可配置字段
+type configField struct {
+	key    string
+	field  string
+	value  reflect.Value
+	env    string
+	def    string
+	has    bool // 是否有default tag
+	secret bool // 是否敏感配置
+}
+
+// loadConfigLayers 按层加载配置
+func loadConfigLayers(v interface{}, file, param string) (ConfigSources, error) {
+	rv := reflect.ValueOf(v)
+	if rv.Kind() != reflect.Ptr || rv.IsNil() || rv.Elem().Kind() != reflect.Struct {
+		return nil, fmt.Errorf("LoadConfigInto requires a non-nil pointer to struct, got %T", v)
+	}
+
+	fields := configFields(rv.Elem())
+	sources := make([]string, len(fields))
+	var errs []string
+
+	// 第1层：默认值
+	for i, f := range fields {
+		sources[i] = SourceDefault
+		if f.has {
+			if err := setParamString(f.value, f.def); err != nil {
+				errs = append(errs, fmt.Sprintf("%s (default): %v", f.key, err))
+			}
+		}
+	}
+
+	// 第2层：配置文件
+	if file != "" {
+		values, err := readConfigFile(file)
+		if err != nil {
+			errs = append(errs, err.Error())
+		}
+		for i, f := range fields {
+			raw, ok := values[f.key]
+			if !ok {
+				continue
+			}
+			if err := setParamValue(f.value, raw); err != nil {
+				errs = append(errs, fmt.Sprintf("%s (file %s): %v", f.key, file, err))
+				continue
+			}
+			sources[i] = SourceFile + ":" + file
+		}
+	}
+
+	// 第3层：环境变量
+	for i, f := range fields {
+		if f.env == "" {
+			continue
+		}
+		val := os.Getenv(f.env)
+		if val == "" {
+			continue
+		}
+		if err := setParamString(f.value, val); err != nil {
+			errs = append(errs, fmt.Sprintf("%s (env %s): %v", f.key, f.env, err))
+			continue
+		}
+		sources[i] = SourceEnv + ":" + f.env
+	}
+
+	// 第4层：任务参数（只认JSON对象和key=value，裸列表跟配置无关）
+	if values, _, err := parseParamString(param); err == nil {
+		for i, f := range fields {
+			val, ok := lookupParam(values, f.key)
+			if !ok {
+				continue
+			}
+			if err := setParamValue(f.value, val); err != nil {
+				errs = append(errs, fmt.Sprintf("%s (param): %v", f.key, err))
+				continue
+			}
+			sources[i] = SourceParam
+		}
+	}
+
+	result := configValues(fields)
+	for i := range result {
+		result[i].Source = sources[i]
+	}
+
+	if setter, ok := v.(configSourceSetter); ok {
+		setter.setSources(result)
+	}
+
+	if len(errs) > 0 {
+		return result, fmt.Errorf("config errors: %s", strings.Join(errs, "; "))
+	}
+	return result, nil
+}
+
+// configFields 收集带config tag的字段
+func configFields(rv reflect.Value) []configField {
+	var fields []configField
+	rt := rv.Type()
+
+	for i := 0; i < rt.NumField(); i++ {
+		sf := rt.Field(i)
+		if !sf.IsExported() {
+			continue
+		}
+
+		key, ok := sf.Tag.Lookup("config")
+		if !ok {
+			if sf.Anonymous && sf.Type.Kind() == reflect.Struct {
+				fields = append(fields, configFields(rv.Field(i))...)
+			}
+			continue
+		}
+		if key == "" || key == "-" {
+			continue
+		}
+
+		f := configField{
+			key:   key,
+			field: sf.Name,
+			value: rv.Field(i),
+			env:   sf.Tag.Get("env"),
+		}
+		f.def, f.has = sf.Tag.Lookup("default")
+		f.secret = sf.Tag.Get("secret") == "true"
+		fields = append(fields, f)
+	}
+
+	return fields
+}
+
+// configValues 列出字段的当前取值，Source留空由调用方填
+func configValues(fields []configField) ConfigSources {
+	result := make(ConfigSources, len(fields))
+	for i, f := range fields {
+		result[i] = ConfigValue{
+			Key:    f.key,
+			Field:  f.field,
+			Value:  fmt.Sprint(f.value.Interface()),
+			Secret: f.secret,
+		}
+	}
+	return result
+}
+
+// maskSecret 给敏感配置打码
+//
+// 艹！逗号分隔的每一项：带host的URL只把用户名密码换成***，其余整项换成***
+func maskSecret(value string) string {
+	if value == "" {
+		return ""
+	}
+	parts := strings.Split(value, ",")
+	for i, p := range parts {
+		u, err := url.Parse(strings.TrimSpace(p))
+		if err != nil || u.Host == "" {
+			parts[i] = "***"
+			continue
+		}
+		if u.User == nil {
+			parts[i] = u.String()
+			continue
+		}
+		u.User = nil
+		parts[i] = strings.Replace(u.String(), "://", "://***@", 1)
+	}
+	return strings.Join(parts, ",")
+}
+
+// readConfigFile 读取JSON配置文件
+func readConfigFile(path string) (map[string]interface{}, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read config file %s: %w", path, err)
+	}
+
+	var obj map[string]json.RawMessage
+	if err := json.Unmarshal(data, &obj); err != nil {
+		return nil, fmt.Errorf("failed to parse config file %s: %w", path, err)
+	}
+
+	values := make(map[string]interface{}, len(obj))
+	for k, v := range obj {
+		values[k] = v
+	}
+	return values, nil
+}
@@ -0,0 +1,343 @@
+package crawlab
+
+import (
+	"encoding/json"
+	"fmt"
+	"net"
+	"net/http"
+	"net/http/cookiejar"
+	"net/url"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// SavedCookie 导出到文件的Cookie
+type SavedCookie struct {
+	Name     string    `json:"name"`
+	Value    string    `json:"value"`
+	Domain   string    `json:"domain"`
+	Path     string    `json:"path"`
+	Expires  time.Time `json:"expires,omitempty"` // 零值表示会话Cookie
+	Secure   bool      `json:"secure,omitempty"`
+	HttpOnly bool      `json:"http_only,omitempty"`
+	HostOnly bool      `json:"host_only,omitempty"` // 只发给Domain本身，不发给子域名
+}
+
+// expired 是否已过期
+func (c *SavedCookie) expired(now time.Time) bool {
+	return !c.Expires.IsZero() && !c.Expires.After(now)
+}
+
+// key Cookie的唯一标识
+func (c *SavedCookie) key() string {
+	return c.Domain + ";" + c.Path + ";" + c.Name
+}
+
+// CookieJar 可以导出导入的CookieJar
+//
+// 艹！标准库的cookiejar拿不出里面的Cookie，登录态没法存下来，只好自己写一个
+// 实现http.CookieJar：
+//   - Domain是公共后缀（com、co.uk这种）的Cookie直接拒绝，防止超级Cookie
+//   - 明文http收到的Secure Cookie直接拒绝
+//
+// 内置的公共后缀只有常见的几十个，要完整列表就设置PublicSuffixList（例如golang.org/x/net/publicsuffix.List）
+//
+//	jar := client.Cookies()
+//	jar.Load("cookies.json")   // 接着上次的登录态
+//	defer jar.Save("cookies.json")
+type CookieJar struct {
+	PublicSuffixList cookiejar.PublicSuffixList // 公共后缀列表，为nil时用内置的常见后缀
+
+	mu      sync.Mutex
+	cookies map[string]*SavedCookie
+}
+
+// NewCookieJar 创建CookieJar
+func NewCookieJar() *CookieJar {
+	return &CookieJar{cookies: make(map[string]*SavedCookie)}
+}
+
+// SetCookies 实现http.CookieJar
+func (j *CookieJar) SetCookies(u *url.URL, cookies []*http.Cookie) {
+	host := canonicalHost(u.Host)
+	now := time.Now()
+
+	j.mu.Lock()
+	defer j.mu.Unlock()
+
+	for _, c := range cookies {
+		// 明文连接不能设置Secure Cookie，不然中间人能覆盖https的登录态
+		if c.Secure && u.Scheme != "https" {
+			continue
+		}
+
+		sc := &SavedCookie{
+			Name:     c.Name,
+			Value:    c.Value,
+			Path:     c.Path,
+			Secure:   c.Secure,
+			HttpOnly: c.HttpOnly,
+		}
+
+		// 域名：不带Domain只发给当前host；带了就必须是当前host或它的上级域名
+		// host本身就是公共后缀时Domain属性不算数，只发给host自己
+		domain := strings.TrimPrefix(strings.ToLower(c.Domain), ".")
+		switch {
+		case domain == "" || domain == host:
+			sc.Domain = host
+			sc.HostOnly = domain == "" || j.isPublicSuffix(domain)
+		case net.ParseIP(host) == nil && strings.HasSuffix(host, "."+domain) && !j.isPublicSuffix(domain):
+			sc.Domain = domain
+		default:
+			continue
+		}
+
+		if sc.Path == "" || sc.Path[0] != '/' {
+			sc.Path = defaultCookiePath(u.Path)
+		}
+
+		switch {
+		case c.MaxAge < 0:
+			sc.Expires = now
+		case c.MaxAge > 0:
+			sc.Expires = now.Add(time.Duration(c.MaxAge) * time.Second)
+		case !c.Expires.IsZero():
+			sc.Expires = c.Expires
+		}
+
+		if sc.expired(now) {
+			delete(j.cookies, sc.key())
+			continue
+		}
+		j.cookies[sc.key()] = sc
+	}
+}
+
+// Cookies 实现http.CookieJar
+func (j *CookieJar) Cookies(u *url.URL) []*http.Cookie {
+	host := canonicalHost(u.Host)
+	path := u.Path
+	if path == "" {
+		path = "/"
+	}
+	https := u.Scheme == "https"
+	now := time.Now()
+
+	j.mu.Lock()
+	var matched []*SavedCookie
+	for k, c := range j.cookies {
+		if c.expired(now) {
+			delete(j.cookies, k)
+			continue
+		}
+		if c.Secure && !https {
+			continue
+		}
+		if !cookieDomainMatch(c, host) || !cookiePathMatch(c.Path, path) {
+			continue
+		}
+		matched = append(matched, c)
+	}
+	j.mu.Unlock()
+
+	// 路径长的排前面，一样长按名字排，保证顺序稳定
+	sort.Slice(matched, func(a, b int) bool {
+		if len(matched[a].Path) != len(matched[b].Path) {
+			return len(matched[a].Path) > len(matched[b].Path)
+		}
+		return matched[a].Name < matched[b].Name
+	})
+
+	cookies := make([]*http.Cookie, len(matched))
+	for i, c := range matched {
+		cookies[i] = &http.Cookie{Name: c.Name, Value: c.Value}
+	}
+	return cookies
+}
+
+// All 返回所有未过期的Cookie（按域名、路径、名字排序）
+func (j *CookieJar) All() []SavedCookie {
+	now := time.Now()
+
+	j.mu.Lock()
+	all := make([]SavedCookie, 0, len(j.cookies))
+	for _, c := range j.cookies {
+		if !c.expired(now) {
+			all = append(all, *c)
+		}
+	}
+	j.mu.Unlock()
+
+	sort.Slice(all, func(a, b int) bool {
+		return all[a].key() < all[b].key()
+	})
+	return all
+}
+
+// Add 导入Cookie，过期的会被跳过
+func (j *CookieJar) Add(cookies ...SavedCookie) {
+	now := time.Now()
+
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	for _, c := range cookies {
+		c := c
+		c.Domain = strings.TrimPrefix(strings.ToLower(c.Domain), ".")
+		if c.Path == "" {
+			c.Path = "/"
+		}
+		if c.Domain == "" || c.expired(now) {
+			continue
+		}
+		j.cookies[c.key()] = &c
+	}
+}
+
+// Clear 清空所有Cookie
+func (j *CookieJar) Clear() {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	j.cookies = make(map[string]*SavedCookie)
+}
+
+// Len 返回Cookie数量（包括还没清理的过期Cookie）
+func (j *CookieJar) Len() int {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	return len(j.cookies)
+}
+
+// Clone 复制一个独立的CookieJar
+func (j *CookieJar) Clone() *CookieJar {
+	c := NewCookieJar()
+	c.PublicSuffixList = j.PublicSuffixList
+	c.Add(j.All()...)
+	return c
+}
+
+// isPublicSuffix 判断domain是不是公共后缀，公共后缀不能当Cookie的Domain
+func (j *CookieJar) isPublicSuffix(domain string) bool {
+	if !strings.Contains(domain, ".") {
+		return true
+	}
+	if j.PublicSuffixList != nil {
+		return j.PublicSuffixList.PublicSuffix(domain) == domain
+	}
+	return commonPublicSuffixes[domain]
+}
+
+// commonPublicSuffixes 常见的多级公共后缀，单级的（com、cn）不用列
+var commonPublicSuffixes = map[string]bool{
+	"co.uk": true, "org.uk": true, "ac.uk": true, "gov.uk": true, "me.uk": true, "net.uk": true,
+	"com.cn": true, "net.cn": true, "org.cn": true, "gov.cn": true, "edu.cn": true, "ac.cn": true,
+	"com.hk": true, "org.hk": true, "com.tw": true, "org.tw": true, "com.sg": true, "com.my": true,
+	"co.jp": true, "ne.jp": true, "or.jp": true, "ac.jp": true, "go.jp": true,
+	"co.kr": true, "or.kr": true, "go.kr": true,
+	"com.au": true, "net.au": true, "org.au": true, "edu.au": true, "gov.au": true,
+	"co.nz": true, "org.nz": true, "co.in": true, "net.in": true, "org.in": true,
+	"com.br": true, "net.br": true, "org.br": true, "com.mx": true, "com.ar": true,
+	"co.za": true, "com.tr": true, "com.ru": true, "com.ua": true, "co.il": true,
+	"github.io": true, "herokuapp.com": true, "appspot.com": true, "blogspot.com": true,
+	"cloudfront.net": true, "azurewebsites.net": true, "vercel.app": true, "netlify.app": true,
+}
+
+// Save 导出Cookie到JSON文件
+//
+// 艹！先写临时文件再改名，写一半挂了也不会把旧文件弄坏
+func (j *CookieJar) Save(path string) error {
+	return writeJSONFile(path, j.All())
+}
+
+// Load 从JSON文件导入Cookie
+//
+// 艹！文件不存在不算错误，第一次运行时就是这样
+func (j *CookieJar) Load(path string) error {
+	var cookies []SavedCookie
+	if err := readJSONFile(path, &cookies); err != nil {
+		if os.IsNotExist(err) {
+			return nil
+		}
+		return err
+	}
+	j.Add(cookies...)
+	return nil
+}
+
+// canonicalHost 去掉端口并转小写
+func canonicalHost(host string) string {
+	if h, _, err := net.SplitHostPort(host); err == nil {
+		host = h
+	}
+	return strings.ToLower(strings.TrimSuffix(host, "."))
+}
+
+// defaultCookiePath 没有Path属性时的默认路径（RFC 6265 5.1.4）
+func defaultCookiePath(path string) string {
+	if path == "" || path[0] != '/' {
+		return "/"
+	}
+	i := strings.LastIndex(path, "/")
+	if i == 0 {
+		return "/"
+	}
+	return path[:i]
+}
+
+// cookieDomainMatch 判断Cookie能不能发给host
+func cookieDomainMatch(c *SavedCookie, host string) bool {
+	if c.Domain == host {
+		return true
+	}
+	return !c.HostOnly && strings.HasSuffix(host, "."+c.Domain)
+}
+
+// cookiePathMatch 判断Cookie路径是否匹配请求路径（RFC 6265 5.1.4）
+func cookiePathMatch(cookiePath, path string) bool {
+	if cookiePath == path {
+		return true
+	}
+	if !strings.HasPrefix(path, cookiePath) {
+		return false
+	}
+	return strings.HasSuffix(cookiePath, "/") || path[len(cookiePath)] == '/'
+}
+
+// writeJSONFile 把v写成JSON文件，先写临时文件再改名
+func writeJSONFile(path string, v interface{}) error {
+	data, err := json.MarshalIndent(v, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to marshal %s: %w", path, err)
+	}
+
+	if dir := filepath.Dir(path); dir != "" {
+		if err := os.MkdirAll(dir, 0755); err != nil {
+			return fmt.Errorf("failed to create directory %s: %w", dir, err)
+		}
+	}
+
+	tmp := path + ".tmp"
+	if err := os.WriteFile(tmp, data, 0600); err != nil {
+		return fmt.Errorf("failed to write %s: %w", tmp, err)
+	}
+	if err := os.Rename(tmp, path); err != nil {
+		os.Remove(tmp)
+		return fmt.Errorf("failed to rename %s: %w", tmp, err)
+	}
+	return nil
+}
+
+// readJSONFile 读取JSON文件到v，文件不存在时返回的错误可以用os.IsNotExist判断
+func readJSONFile(path string, v interface{}) error {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return err
+	}
+	if err := json.Unmarshal(data, v); err != nil {
+		return fmt.Errorf("failed to parse %s: %w", path, err)
+	}
+	return nil
+}
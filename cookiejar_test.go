@@ -0,0 +1,67 @@
+package crawlab
+
+import (
+	"net/http"
+	"net/url"
+	"testing"
+)
+
+func TestCookieJarSetCookies(t *testing.T) {
+	tests := []struct {
+		name   string
+		set    string
+		cookie *http.Cookie
+		get    string
+		want   bool
+	}{
+		{"host only", "https://www.example.com/", &http.Cookie{Name: "a", Value: "1"}, "https://www.example.com/x", true},
+		{"host only not sent to subdomain", "https://example.com/", &http.Cookie{Name: "a", Value: "1"}, "https://www.example.com/", false},
+		{"parent domain", "https://www.example.com/", &http.Cookie{Name: "a", Value: "1", Domain: ".example.com"}, "https://api.example.com/", true},
+		{"single label suffix", "https://www.example.com/", &http.Cookie{Name: "a", Value: "1", Domain: "com"}, "https://other.com/", false},
+		{"multi label public suffix", "https://shop.example.co.uk/", &http.Cookie{Name: "a", Value: "1", Domain: "co.uk"}, "https://victim.co.uk/", false},
+		{"under multi label suffix", "https://shop.example.co.uk/", &http.Cookie{Name: "a", Value: "1", Domain: "example.co.uk"}, "https://www.example.co.uk/", true},
+		{"foreign domain", "https://www.example.com/", &http.Cookie{Name: "a", Value: "1", Domain: "evil.com"}, "https://evil.com/", false},
+		{"secure over https", "https://example.com/", &http.Cookie{Name: "a", Value: "1", Secure: true}, "https://example.com/", true},
+		{"secure over http rejected", "http://example.com/", &http.Cookie{Name: "a", Value: "1", Secure: true}, "https://example.com/", false},
+		{"secure not sent over http", "https://example.com/", &http.Cookie{Name: "a", Value: "1", Secure: true}, "http://example.com/", false},
+		{"path scoped", "https://example.com/a/b", &http.Cookie{Name: "a", Value: "1"}, "https://example.com/c", false},
+		{"expired", "https://example.com/", &http.Cookie{Name: "a", Value: "1", MaxAge: -1}, "https://example.com/", false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			jar := NewCookieJar()
+			setURL, _ := url.Parse(tt.set)
+			getURL, _ := url.Parse(tt.get)
+
+			jar.SetCookies(setURL, []*http.Cookie{tt.cookie})
+			got := len(jar.Cookies(getURL)) > 0
+			if got != tt.want {
+				t.Errorf("cookie sent = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+// suffixList 测试用的公共后缀列表
+type suffixList map[string]bool
+
+func (l suffixList) PublicSuffix(domain string) string {
+	if l[domain] {
+		return domain
+	}
+	return ""
+}
+
+func (l suffixList) String() string { return "test" }
+
+func TestCookieJarCustomPublicSuffixList(t *testing.T) {
+	jar := NewCookieJar()
+	jar.PublicSuffixList = suffixList{"example.com": true}
+
+	u, _ := url.Parse("https://a.example.com/")
+	jar.SetCookies(u, []*http.Cookie{{Name: "a", Value: "1", Domain: "example.com"}})
+	if jar.Len() != 0 {
+		t.Errorf("cookie for custom public suffix accepted")
+	}
+}
@@ -0,0 +1,390 @@
+package crawlab
+
+import (
+	"bufio"
+	"bytes"
+	"container/list"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+	"sync"
+	"sync/atomic"
+)
+
+// DedupStore 去重键存储
+//
+// 艹！Deduper自己加锁保证"检查+标记"的原子性，存储只管查和存
+// 数据发送成功之后才会Add，发送失败的数据下次还能再保存
+type DedupStore interface {
+	Contains(key string) (bool, error)
+	Add(key string) error
+	Close() error
+}
+
+// MemoryStore 内存去重存储（无上限）
+type MemoryStore struct {
+	mu   sync.Mutex
+	keys map[string]struct{}
+}
+
+// NewMemoryStore 创建内存去重存储
+func NewMemoryStore() *MemoryStore {
+	return &MemoryStore{keys: make(map[string]struct{})}
+}
+
+// Contains 是否已经有这个key
+func (s *MemoryStore) Contains(key string) (bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	_, ok := s.keys[key]
+	return ok, nil
+}
+
+// Add 记下key
+func (s *MemoryStore) Add(key string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.keys[key] = struct{}{}
+	return nil
+}
+
+// Close 内存存储无需关闭
+func (s *MemoryStore) Close() error {
+	return nil
+}
+
+// LRUStore 有容量上限的去重存储
+//
+// 艹！超过容量淘汰最久没碰过的key，数据量大时用它防止内存爆掉
+type LRUStore struct {
+	mu       sync.Mutex
+	capacity int
+	order    *list.List
+	keys     map[string]*list.Element
+}
+
+// NewLRUStore 创建LRU去重存储
+func NewLRUStore(capacity int) *LRUStore {
+	if capacity < 1 {
+		capacity = 1
+	}
+	return &LRUStore{
+		capacity: capacity,
+		order:    list.New(),
+		keys:     make(map[string]*list.Element),
+	}
+}
+
+// Contains 是否已经有这个key，命中会刷新它的位置
+func (s *LRUStore) Contains(key string) (bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	el, ok := s.keys[key]
+	if ok {
+		s.order.MoveToFront(el)
+	}
+	return ok, nil
+}
+
+// Add 记下key，超过容量淘汰最久没碰过的
+func (s *LRUStore) Add(key string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if el, ok := s.keys[key]; ok {
+		s.order.MoveToFront(el)
+		return nil
+	}
+	s.keys[key] = s.order.PushFront(key)
+	if s.order.Len() > s.capacity {
+		oldest := s.order.Back()
+		s.order.Remove(oldest)
+		delete(s.keys, oldest.Value.(string))
+	}
+	return nil
+}
+
+// Close LRU存储无需关闭
+func (s *LRUStore) Close() error {
+	return nil
+}
+
+// FileStore 磁盘去重存储
+//
+// 艹！启动时加载已有key，新key追加写入，任务重启后照样能去重
+type FileStore struct {
+	mu   sync.Mutex
+	keys map[string]struct{}
+	file *os.File
+}
+
+// NewFileStore 打开（或创建）磁盘去重存储
+func NewFileStore(path string) (*FileStore, error) {
+	f, err := os.OpenFile(path, os.O_CREATE|os.O_RDWR|os.O_APPEND, 0644)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open dedup file %s: %w", path, err)
+	}
+
+	s := &FileStore{keys: make(map[string]struct{}), file: f}
+
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		if key := strings.TrimSpace(scanner.Text()); key != "" {
+			s.keys[key] = struct{}{}
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		f.Close()
+		return nil, fmt.Errorf("failed to load dedup file %s: %w", path, err)
+	}
+
+	return s, nil
+}
+
+// Contains 是否已经有这个key
+func (s *FileStore) Contains(key string) (bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	_, ok := s.keys[key]
+	return ok, nil
+}
+
+// Add 记下key并立即落盘
+func (s *FileStore) Add(key string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, ok := s.keys[key]; ok {
+		return nil
+	}
+	if _, err := s.file.WriteString(key + "\n"); err != nil {
+		return fmt.Errorf("failed to persist dedup key: %w", err)
+	}
+	s.keys[key] = struct{}{}
+	return nil
+}
+
+// Close 关闭文件
+func (s *FileStore) Close() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.file.Close()
+}
+
+// ErrNoDedupKey 数据里一个去重字段都没有，没法去重
+var ErrNoDedupKey = errors.New("item has none of the dedup fields")
+
+// Deduper 数据去重器
+//
+// 艹！指定了Fields就按这些字段的值去重，否则按整条数据的规范化JSON哈希去重
+// 一个去重字段都没有的数据不去重，照常保存
+type Deduper struct {
+	Fields []string // 去重键字段（json字段名），为空则用整条数据
+
+	store      DedupStore
+	duplicates int64
+
+	mu      sync.Mutex
+	pending map[string]struct{} // 已预留、还没发送完的key
+}
+
+// NewDeduper 创建去重器
+//
+// 艹！store为nil时用内存存储
+func NewDeduper(store DedupStore, fields ...string) *Deduper {
+	if store == nil {
+		store = NewMemoryStore()
+	}
+	return &Deduper{Fields: fields, store: store, pending: make(map[string]struct{})}
+}
+
+// Key 计算数据的去重键
+//
+// 艹！数字按原样保留（UseNumber），超过2^53的int64 ID也不会撞成同一个key
+// 指定了Fields但数据里一个都没有时返回ErrNoDedupKey
+func (d *Deduper) Key(item interface{}) (string, error) {
+	// 先转成通用结构，struct和map统一处理
+	data, err := json.Marshal(item)
+	if err != nil {
+		return "", fmt.Errorf("failed to marshal item for dedup: %w", err)
+	}
+	dec := json.NewDecoder(bytes.NewReader(data))
+	dec.UseNumber()
+	var generic interface{}
+	if err := dec.Decode(&generic); err != nil {
+		return "", fmt.Errorf("failed to normalize item for dedup: %w", err)
+	}
+
+	if len(d.Fields) > 0 {
+		m, ok := generic.(map[string]interface{})
+		if !ok {
+			return "", fmt.Errorf("dedup fields require an object item, got %T", item)
+		}
+		values := make([]interface{}, len(d.Fields))
+		found := false
+		for i, field := range d.Fields {
+			values[i] = m[field]
+			if values[i] != nil {
+				found = true
+			}
+		}
+		if !found {
+			return "", ErrNoDedupKey
+		}
+		generic = values
+	}
+
+	// encoding/json输出map时key有序，得到的就是规范化JSON
+	canonical, err := json.Marshal(generic)
+	if err != nil {
+		return "", fmt.Errorf("failed to marshal dedup key: %w", err)
+	}
+	sum := sha256.Sum256(canonical)
+	return hex.EncodeToString(sum[:]), nil
+}
+
+// Reserve 检查数据是否重复，不重复就预留它的key
+//
+// 艹！预留的key发送成功后调Commit落到存储里，发送失败调Release放掉，
+// 这样发送失败的数据下次还能保存；正在发送的相同数据也算重复
+// 没有去重字段的数据返回空key，不算重复
+func (d *Deduper) Reserve(item interface{}) (key string, dup bool, err error) {
+	key, err = d.Key(item)
+	if errors.Is(err, ErrNoDedupKey) {
+		LogDebug("Item has none of the dedup fields %v, saving without dedup", d.Fields)
+		return "", false, nil
+	}
+	if err != nil {
+		return "", false, err
+	}
+
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	if _, ok := d.pending[key]; ok {
+		atomic.AddInt64(&d.duplicates, 1)
+		return key, true, nil
+	}
+	seen, err := d.store.Contains(key)
+	if err != nil {
+		return "", false, err
+	}
+	if seen {
+		atomic.AddInt64(&d.duplicates, 1)
+		return key, true, nil
+	}
+	if d.pending == nil {
+		d.pending = make(map[string]struct{})
+	}
+	d.pending[key] = struct{}{}
+	return key, false, nil
+}
+
+// Commit 数据发送成功，把预留的key写进存储
+func (d *Deduper) Commit(key string) error {
+	if key == "" {
+		return nil
+	}
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	delete(d.pending, key)
+	return d.store.Add(key)
+}
+
+// Release 数据没发出去，放掉预留的key
+func (d *Deduper) Release(key string) {
+	if key == "" {
+		return
+	}
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	delete(d.pending, key)
+}
+
+// IsDuplicate 判断数据是否重复，不重复的立即记下来
+//
+// 艹！等于Reserve+Commit，自己控制发送的话用Reserve/Commit/Release
+func (d *Deduper) IsDuplicate(item interface{}) (bool, error) {
+	key, dup, err := d.Reserve(item)
+	if err != nil || dup {
+		return dup, err
+	}
+	return false, d.Commit(key)
+}
+
+// reserve 预留key，包装成发送结束时提交或放掉的dedupTicket
+func (d *Deduper) reserve(item interface{}) (dedupTicket, bool, error) {
+	if d == nil {
+		return dedupTicket{}, false, nil
+	}
+	key, dup, err := d.Reserve(item)
+	if err != nil || dup {
+		return dedupTicket{}, dup, err
+	}
+	return dedupTicket{d: d, key: key}, false, nil
+}
+
+// dedupTicket 发送前预留的去重键
+type dedupTicket struct {
+	d   *Deduper
+	key string
+}
+
+// done 发送结束：成功就提交，失败就放掉
+func (t dedupTicket) done(err error) {
+	if t.d == nil || t.key == "" {
+		return
+	}
+	if err != nil {
+		t.d.Release(t.key)
+		return
+	}
+	if cerr := t.d.Commit(t.key); cerr != nil {
+		LogError("Failed to commit dedup key: %v", cerr)
+	}
+}
+
+// Duplicates 返回已拦截的重复条数
+func (d *Deduper) Duplicates() int64 {
+	return atomic.LoadInt64(&d.duplicates)
+}
+
+// Close 关闭底层存储
+func (d *Deduper) Close() error {
+	return d.store.Close()
+}
+
+var (
+	dedupMu       sync.RWMutex
+	globalDeduper *Deduper
+)
+
+// SetDeduper 设置SaveItem/SaveItems/SaveBatch使用的全局去重器
+//
+// 艹！传nil关闭去重，返回旧的去重器
+func SetDeduper(d *Deduper) *Deduper {
+	dedupMu.Lock()
+	defer dedupMu.Unlock()
+
+	old := globalDeduper
+	globalDeduper = d
+	return old
+}
+
+// getDeduper 获取全局去重器
+func getDeduper() *Deduper {
+	dedupMu.RLock()
+	defer dedupMu.RUnlock()
+	return globalDeduper
+}
+
+// reserveGlobal 用全局去重器预留数据的key，没设置时总是不重复
+func reserveGlobal(item interface{}) (dedupTicket, bool, error) {
+	return getDeduper().reserve(item)
+}
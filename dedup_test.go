@@ -0,0 +1,186 @@
+package crawlab
+
+import (
+	"errors"
+	"path/filepath"
+	"testing"
+)
+
+// failingTransport 发送总是失败的传输通道
+type failingTransport struct{}
+
+func (failingTransport) Send(IPCMessage) error { return errors.New("pipe closed") }
+func (failingTransport) Close() error          { return nil }
+
+// discardTransport 发送总是成功的传输通道
+type discardTransport struct{}
+
+func (discardTransport) Send(IPCMessage) error { return nil }
+func (discardTransport) Close() error          { return nil }
+
+// useTransport 测试期间替换全局传输通道
+func useTransport(t *testing.T, tr Transport) {
+	t.Helper()
+	old := SetTransport(tr)
+	t.Cleanup(func() { SetTransport(old) })
+}
+
+func TestDeduperKey(t *testing.T) {
+	tests := []struct {
+		name   string
+		fields []string
+		a, b   interface{}
+		same   bool
+	}{
+		{"same map", nil, map[string]interface{}{"a": 1, "b": "x"}, map[string]interface{}{"b": "x", "a": 1}, true},
+		{"different map", nil, map[string]interface{}{"a": 1}, map[string]interface{}{"a": 2}, false},
+		{"large int64 ids", []string{"id"}, map[string]interface{}{"id": int64(9007199254740993)}, map[string]interface{}{"id": int64(9007199254740992)}, false},
+		{"fields only", []string{"url"}, map[string]interface{}{"url": "u", "t": 1}, map[string]interface{}{"url": "u", "t": 2}, true},
+		{"struct and map", []string{"url"}, struct {
+			URL string `json:"url"`
+		}{"u"}, map[string]interface{}{"url": "u"}, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			d := NewDeduper(nil, tt.fields...)
+			ka, err := d.Key(tt.a)
+			if err != nil {
+				t.Fatalf("Key(a): %v", err)
+			}
+			kb, err := d.Key(tt.b)
+			if err != nil {
+				t.Fatalf("Key(b): %v", err)
+			}
+			if (ka == kb) != tt.same {
+				t.Errorf("same key = %v, want %v", ka == kb, tt.same)
+			}
+		})
+	}
+}
+
+func TestDeduperMissingFields(t *testing.T) {
+	d := NewDeduper(nil, "id", "url")
+
+	if _, err := d.Key(map[string]interface{}{"title": "x"}); !errors.Is(err, ErrNoDedupKey) {
+		t.Fatalf("Key error = %v, want ErrNoDedupKey", err)
+	}
+
+	// 没有去重字段的数据不去重，两条都要保存
+	for i := 0; i < 2; i++ {
+		dup, err := d.IsDuplicate(map[string]interface{}{"title": "x"})
+		if err != nil || dup {
+			t.Fatalf("IsDuplicate #%d = %v, %v; want false, nil", i, dup, err)
+		}
+	}
+}
+
+func TestDeduperReserve(t *testing.T) {
+	item := map[string]interface{}{"id": 1}
+
+	tests := []struct {
+		name    string
+		finish  func(d *Deduper, key string)
+		wantDup bool
+	}{
+		{"commit", func(d *Deduper, key string) { d.Commit(key) }, true},
+		{"release", func(d *Deduper, key string) { d.Release(key) }, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			d := NewDeduper(nil, "id")
+
+			key, dup, err := d.Reserve(item)
+			if err != nil || dup {
+				t.Fatalf("first Reserve = %v, %v", dup, err)
+			}
+			// 还在发送中的相同数据也算重复
+			if _, dup, _ := d.Reserve(item); !dup {
+				t.Fatal("pending key not reported as duplicate")
+			}
+
+			tt.finish(d, key)
+
+			_, dup, err = d.Reserve(item)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if dup != tt.wantDup {
+				t.Errorf("Reserve after %s dup = %v, want %v", tt.name, dup, tt.wantDup)
+			}
+		})
+	}
+}
+
+func TestSaveItemsCommitsAfterSend(t *testing.T) {
+	d := NewDeduper(nil, "id")
+	old := SetDeduper(d)
+	defer SetDeduper(old)
+
+	item := map[string]interface{}{"id": 1}
+
+	useTransport(t, failingTransport{})
+	if err := SaveItems(item); err == nil {
+		t.Fatal("SaveItems succeeded on a failing transport")
+	}
+
+	// 发送失败的数据不能被记成已见过
+	useTransport(t, discardTransport{})
+	if err := SaveItems(item); err != nil {
+		t.Fatalf("SaveItems retry: %v", err)
+	}
+	if d.Duplicates() != 0 {
+		t.Fatalf("Duplicates = %d after retry, want 0", d.Duplicates())
+	}
+
+	if err := SaveBatch([]interface{}{item}); err != nil {
+		t.Fatal(err)
+	}
+	if d.Duplicates() != 1 {
+		t.Errorf("Duplicates = %d, want 1", d.Duplicates())
+	}
+}
+
+func TestFileStorePersists(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "keys.txt")
+
+	s, err := NewFileStore(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := s.Add("k1"); err != nil {
+		t.Fatal(err)
+	}
+	s.Close()
+
+	s, err = NewFileStore(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer s.Close()
+
+	for key, want := range map[string]bool{"k1": true, "k2": false} {
+		got, err := s.Contains(key)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got != want {
+			t.Errorf("Contains(%q) = %v, want %v", key, got, want)
+		}
+	}
+}
+
+func TestLRUStoreEvicts(t *testing.T) {
+	s := NewLRUStore(2)
+	s.Add("a")
+	s.Add("b")
+	s.Contains("a") // 刷新a
+	s.Add("c")      // 淘汰b
+
+	for key, want := range map[string]bool{"a": true, "b": false, "c": true} {
+		if got, _ := s.Contains(key); got != want {
+			t.Errorf("Contains(%q) = %v, want %v", key, got, want)
+		}
+	}
+}
@@ -2,6 +2,7 @@ package main
 
 import (
 	"fmt"
+	"time"
 
 	"github.com/arschlochnop/cl-sdk-go"
 )
@@ -33,35 +34,32 @@ func main() {
 
 	crawlab.LogInfo("✅ 批量保存完成")
 
-	// 方式2: 分批保存大量数据
+	// 方式2: 用BatchWriter自动分批保存大量数据
 	totalItems := 1000
-	batchSize = 100
 
 	crawlab.LogInfo("开始分批保存 %d 条数据，每批 %d 条", totalItems, batchSize)
 
-	for start := 0; start < totalItems; start += batchSize {
-		end := start + batchSize
-		if end > totalItems {
-			end = totalItems
-		}
-
-		// 创建当前批次数据
-		batch := make([]interface{}, end-start)
-		for i := 0; i < len(batch); i++ {
-			batch[i] = map[string]interface{}{
-				"id":    start + i + 1,
-				"title": fmt.Sprintf("Item %d", start+i+1),
-				"batch": start / batchSize,
-			}
+	w := crawlab.NewBatchWriter(batchSize, 5*time.Second)
+	w.OnFlush = func(r crawlab.BatchResult) {
+		if r.Err != nil {
+			crawlab.LogError("批次保存失败: %v", r.Err)
+			return
 		}
+		crawlab.LogInfo("✅ 批次完成（%d 条，%d 字节）", r.Items, r.Bytes)
+	}
 
-		// 保存当前批次
-		if err := crawlab.SaveBatch(batch); err != nil {
-			crawlab.LogError("批次 %d 保存失败: %v", start/batchSize, err)
-			continue
+	for i := 0; i < totalItems; i++ {
+		if err := w.Add(map[string]interface{}{
+			"id":    i + 1,
+			"title": fmt.Sprintf("Item %d", i+1),
+		}); err != nil {
+			crawlab.LogError("添加数据失败: %v", err)
 		}
+	}
 
-		crawlab.LogInfo("✅ 批次 %d 完成（%d-%d/%d）", start/batchSize, start+1, end, totalItems)
+	// 发送剩余数据
+	if err := w.Close(); err != nil {
+		crawlab.LogError("保存剩余数据失败: %v", err)
 	}
 
 	crawlab.Log("所有数据保存完成")
@@ -0,0 +1,177 @@
+package crawlab
+
+import (
+	"math/rand"
+	"sync"
+	"time"
+)
+
+// HeaderProfile 一组互相匹配的请求头
+//
+// 艹！UA说自己是Firefox却带着sec-ch-ua，傻子都知道是爬虫，所以请求头要整套换
+type HeaderProfile struct {
+	Name    string            // 名称，日志里用
+	Headers map[string]string // 请求头
+}
+
+// RotationMode 请求头轮换方式
+type RotationMode int
+
+const (
+	RotatePerRequest RotationMode = iota // 每个请求换一套（同一个请求的重试不换）
+	RotatePerSession                     // 每个HTTPClient/会话固定一套
+)
+
+const (
+	chromeAccept  = "text/html,application/xhtml+xml,application/xml;q=0.9,image/avif,image/webp,image/apng,*/*;q=0.8,application/signed-exchange;v=b3;q=0.7"
+	firefoxAccept = "text/html,application/xhtml+xml,application/xml;q=0.9,image/avif,image/webp,*/*;q=0.8"
+	safariAccept  = "text/html,application/xhtml+xml,application/xml;q=0.9,*/*;q=0.8"
+)
+
+// DefaultHeaderProfiles 内置的浏览器请求头
+//
+// 艹！Chrome/Edge带sec-ch-ua，Firefox/Safari不带，和真浏览器一致
+func DefaultHeaderProfiles() []HeaderProfile {
+	return []HeaderProfile{
+		{
+			Name: "chrome-windows",
+			Headers: map[string]string{
+				"User-Agent":                "Mozilla/5.0 (Windows NT 10.0; Win64; x64) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/124.0.0.0 Safari/537.36",
+				"Accept":                    chromeAccept,
+				"Accept-Language":           "en-US,en;q=0.9",
+				"Sec-Ch-Ua":                 `"Chromium";v="124", "Google Chrome";v="124", "Not-A.Brand";v="99"`,
+				"Sec-Ch-Ua-Mobile":          "?0",
+				"Sec-Ch-Ua-Platform":        `"Windows"`,
+				"Upgrade-Insecure-Requests": "1",
+			},
+		},
+		{
+			Name: "chrome-macos",
+			Headers: map[string]string{
+				"User-Agent":                "Mozilla/5.0 (Macintosh; Intel Mac OS X 10_15_7) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/124.0.0.0 Safari/537.36",
+				"Accept":                    chromeAccept,
+				"Accept-Language":           "zh-CN,zh;q=0.9,en;q=0.8",
+				"Sec-Ch-Ua":                 `"Chromium";v="124", "Google Chrome";v="124", "Not-A.Brand";v="99"`,
+				"Sec-Ch-Ua-Mobile":          "?0",
+				"Sec-Ch-Ua-Platform":        `"macOS"`,
+				"Upgrade-Insecure-Requests": "1",
+			},
+		},
+		{
+			Name: "edge-windows",
+			Headers: map[string]string{
+				"User-Agent":                "Mozilla/5.0 (Windows NT 10.0; Win64; x64) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/124.0.0.0 Safari/537.36 Edg/124.0.0.0",
+				"Accept":                    chromeAccept,
+				"Accept-Language":           "en-US,en;q=0.9",
+				"Sec-Ch-Ua":                 `"Chromium";v="124", "Microsoft Edge";v="124", "Not-A.Brand";v="99"`,
+				"Sec-Ch-Ua-Mobile":          "?0",
+				"Sec-Ch-Ua-Platform":        `"Windows"`,
+				"Upgrade-Insecure-Requests": "1",
+			},
+		},
+		{
+			Name: "firefox-windows",
+			Headers: map[string]string{
+				"User-Agent":                "Mozilla/5.0 (Windows NT 10.0; Win64; x64; rv:125.0) Gecko/20100101 Firefox/125.0",
+				"Accept":                    firefoxAccept,
+				"Accept-Language":           "en-US,en;q=0.5",
+				"Upgrade-Insecure-Requests": "1",
+			},
+		},
+		{
+			Name: "firefox-linux",
+			Headers: map[string]string{
+				"User-Agent":                "Mozilla/5.0 (X11; Linux x86_64; rv:125.0) Gecko/20100101 Firefox/125.0",
+				"Accept":                    firefoxAccept,
+				"Accept-Language":           "en-US,en;q=0.5",
+				"Upgrade-Insecure-Requests": "1",
+			},
+		},
+		{
+			Name: "safari-macos",
+			Headers: map[string]string{
+				"User-Agent":      "Mozilla/5.0 (Macintosh; Intel Mac OS X 10_15_7) AppleWebKit/605.1.15 (KHTML, like Gecko) Version/17.4.1 Safari/605.1.15",
+				"Accept":          safariAccept,
+				"Accept-Language": "en-US,en;q=0.9",
+			},
+		},
+	}
+}
+
+// HeaderRotator 请求头轮换器
+//
+// 艹！同一个seed每次运行选出来的顺序都一样，测试能复现
+//
+//	client.SetHeaderRotator(crawlab.NewHeaderRotator(crawlab.RotatePerSession, 42))
+type HeaderRotator struct {
+	Mode     RotationMode    // 轮换方式
+	Profiles []HeaderProfile // 候选请求头（默认DefaultHeaderProfiles）
+
+	mu   sync.Mutex
+	rand *rand.Rand
+}
+
+// NewHeaderRotator 创建请求头轮换器
+//
+// 艹！seed为0时用当前时间，每次运行都不一样
+func NewHeaderRotator(mode RotationMode, seed int64) *HeaderRotator {
+	if seed == 0 {
+		seed = time.Now().UnixNano()
+	}
+	return &HeaderRotator{
+		Mode:     mode,
+		Profiles: DefaultHeaderProfiles(),
+		rand:     rand.New(rand.NewSource(seed)),
+	}
+}
+
+// Next 随机选一套请求头
+func (r *HeaderRotator) Next() HeaderProfile {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if len(r.Profiles) == 0 {
+		return HeaderProfile{}
+	}
+	if r.rand == nil {
+		r.rand = rand.New(rand.NewSource(time.Now().UnixNano()))
+	}
+	return r.Profiles[r.rand.Intn(len(r.Profiles))]
+}
+
+// SetHeaderRotator 设置请求头轮换
+//
+// 艹！轮换出来的请求头优先级最低，SetHeader设置的和单次请求的请求头会覆盖它
+// RotatePerSession模式下每个Session（见session.go）各自固定一套
+func (c *HTTPClient) SetHeaderRotator(r *HeaderRotator) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.Rotator = r
+	c.profile = nil
+}
+
+// Profile 返回当前会话固定的请求头，没有则返回nil
+func (c *HTTPClient) Profile() *HeaderProfile {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.profile
+}
+
+// nextProfile 为一次请求选请求头
+func (c *HTTPClient) nextProfile() map[string]string {
+	if c.Rotator == nil {
+		return nil
+	}
+	if c.Rotator.Mode != RotatePerSession {
+		return c.Rotator.Next().Headers
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.profile == nil {
+		p := c.Rotator.Next()
+		c.profile = &p
+		LogDebug("Using header profile %s", p.Name)
+	}
+	return c.profile.Headers
+}
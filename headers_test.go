@@ -0,0 +1,127 @@
+package crawlab
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// profileNames 按seed连续选n次的名称
+func profileNames(mode RotationMode, seed int64, n int) []string {
+	r := NewHeaderRotator(mode, seed)
+	names := make([]string, n)
+	for i := range names {
+		names[i] = r.Next().Name
+	}
+	return names
+}
+
+func TestHeaderRotatorSeed(t *testing.T) {
+	tests := []struct {
+		name  string
+		a, b  int64
+		equal bool
+	}{
+		{"same seed repeats", 42, 42, true},
+		{"another seed repeats", 7, 7, true},
+		{"different seeds differ", 42, 43, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			a := profileNames(RotatePerRequest, tt.a, 20)
+			b := profileNames(RotatePerRequest, tt.b, 20)
+			if equalStrings(a, b) != tt.equal {
+				t.Errorf("seed %d: %v\nseed %d: %v", tt.a, a, tt.b, b)
+			}
+		})
+	}
+
+	t.Run("no profiles", func(t *testing.T) {
+		r := NewHeaderRotator(RotatePerRequest, 1)
+		r.Profiles = nil
+		if p := r.Next(); p.Name != "" || p.Headers != nil {
+			t.Errorf("Next = %+v, want empty", p)
+		}
+	})
+}
+
+func TestDefaultHeaderProfiles(t *testing.T) {
+	for _, p := range DefaultHeaderProfiles() {
+		t.Run(p.Name, func(t *testing.T) {
+			ua := p.Headers["User-Agent"]
+			chromium := strings.Contains(ua, "Chrome/")
+			if _, ok := p.Headers["Sec-Ch-Ua"]; ok != chromium {
+				t.Errorf("Sec-Ch-Ua present = %v for UA %q", ok, ua)
+			}
+			if p.Headers["Accept"] == "" || p.Headers["Accept-Language"] == "" {
+				t.Errorf("incomplete profile: %v", p.Headers)
+			}
+		})
+	}
+}
+
+func TestHTTPClientHeaderRotation(t *testing.T) {
+	var mu sync.Mutex
+	var seen []string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		seen = append(seen, r.Header.Get("User-Agent"))
+		n := len(seen)
+		mu.Unlock()
+		// 第一次503，验证同一个请求的重试不换请求头
+		if n == 1 {
+			w.WriteHeader(http.StatusServiceUnavailable)
+		}
+	}))
+	defer srv.Close()
+
+	uaOf := func(mode RotationMode, seed int64, n int) []string {
+		r := NewHeaderRotator(mode, seed)
+		uas := make([]string, n)
+		for i := range uas {
+			uas[i] = r.Next().Headers["User-Agent"]
+		}
+		return uas
+	}
+	perRequest := uaOf(RotatePerRequest, 42, 3)
+	perSession := uaOf(RotatePerSession, 42, 1)[0]
+
+	tests := []struct {
+		name     string
+		mode     RotationMode
+		override string // SetHeader设置的User-Agent
+		want     []string
+	}{
+		{"per request", RotatePerRequest, "", []string{perRequest[0], perRequest[0], perRequest[1], perRequest[2]}},
+		{"per session", RotatePerSession, "", []string{perSession, perSession, perSession, perSession}},
+		{"static header wins", RotatePerRequest, "my-bot/1.0", []string{"my-bot/1.0", "my-bot/1.0", "my-bot/1.0", "my-bot/1.0"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			seen = nil
+			client := NewHTTPClient(5 * time.Second)
+			client.SetRetry(1, time.Millisecond)
+			client.SetHeaderRotator(NewHeaderRotator(tt.mode, 42))
+			if tt.override != "" {
+				client.SetHeader("User-Agent", tt.override)
+			}
+
+			for i := 0; i < 3; i++ {
+				resp, err := client.Get(context.Background(), srv.URL)
+				if err != nil {
+					t.Fatal(err)
+				}
+				resp.Body.Close()
+			}
+			if !equalStrings(seen, tt.want) {
+				t.Errorf("server saw %q\nwant %q", seen, tt.want)
+			}
+		})
+	}
+}
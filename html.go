@@ -0,0 +1,616 @@
+package crawlab
+
+import (
+	"context"
+	"html"
+	"net/url"
+	"strings"
+)
+
+// NodeType 节点类型
+type NodeType int
+
+const (
+	DocumentNode NodeType = iota // 文档根节点
+	ElementNode                  // 元素
+	TextNode                     // 文本
+	CommentNode                  // 注释
+)
+
+// Attribute 元素属性
+type Attribute struct {
+	Key string // 属性名，小写
+	Val string // 属性值，实体已经解码
+}
+
+// Node HTML节点
+//
+// 艹！不是完整的HTML5解析器，但常见的不闭合标签（p、li、td、option……）都能处理，
+// 抓数据够用了，别再对着响应体写正则
+type Node struct {
+	Type     NodeType    // 节点类型
+	Tag      string      // 标签名，小写（元素节点）
+	Attrs    []Attribute // 属性（元素节点）
+	Data     string      // 文本或注释内容，实体已经解码
+	Parent   *Node       // 父节点
+	Children []*Node     // 子节点
+
+	doc *Document // 所属文档，解析相对URL用
+}
+
+// Document HTML文档
+//
+//	doc, err := client.GetDocument(ctx, "https://example.com/list")
+//	if err != nil {
+//		return err
+//	}
+//	for _, item := range doc.Find("ul.items > li") {
+//		title := item.First("a").Text()
+//		link := item.First("a").AbsAttr("href")
+//	}
+type Document struct {
+	*Node
+
+	// URL 页面地址，相对链接按它解析；页面里有<base href>的话已经换成base
+	URL *url.URL
+}
+
+// voidTags 没有结束标签的元素
+var voidTags = map[string]bool{
+	"area": true, "base": true, "br": true, "col": true, "embed": true, "hr": true, "img": true,
+	"input": true, "link": true, "meta": true, "param": true, "source": true, "track": true, "wbr": true,
+}
+
+// rawTextTags 内容不解析标签的元素，textarea和title的内容还要解码实体
+var rawTextTags = map[string]bool{
+	"script": true, "style": true, "textarea": true, "title": true, "xmp": true, "iframe": true, "noembed": true,
+}
+
+// blockTags 块级元素，取文本时前后加空格，遇到它们时隐式关闭<p>
+var blockTags = map[string]bool{
+	"address": true, "article": true, "aside": true, "blockquote": true, "dd": true, "details": true,
+	"div": true, "dl": true, "dt": true, "fieldset": true, "figcaption": true, "figure": true,
+	"footer": true, "form": true, "h1": true, "h2": true, "h3": true, "h4": true, "h5": true, "h6": true,
+	"header": true, "hr": true, "li": true, "main": true, "nav": true, "ol": true, "p": true,
+	"pre": true, "section": true, "table": true, "td": true, "th": true, "tr": true, "ul": true,
+	"br": true,
+}
+
+// autoCloseRule 打开某个标签时要隐式关闭的元素
+type autoCloseRule struct {
+	closes map[string]bool // 遇到这些就关闭
+	scope  map[string]bool // 往上找到这些就停
+}
+
+var (
+	buttonScope = tagSet("applet", "caption", "html", "table", "td", "th", "marquee", "object", "template", "button")
+	closeP      = autoCloseRule{tagSet("p"), buttonScope}
+
+	autoCloseRules = map[string]autoCloseRule{
+		"li":       {tagSet("li"), tagSet("ul", "ol", "menu", "table")},
+		"dt":       {tagSet("dt", "dd"), tagSet("dl", "table")},
+		"dd":       {tagSet("dt", "dd"), tagSet("dl", "table")},
+		"tr":       {tagSet("tr", "td", "th"), tagSet("table", "thead", "tbody", "tfoot")},
+		"td":       {tagSet("td", "th"), tagSet("tr", "table")},
+		"th":       {tagSet("td", "th"), tagSet("tr", "table")},
+		"thead":    {tagSet("thead", "tbody", "tfoot", "tr", "td", "th"), tagSet("table")},
+		"tbody":    {tagSet("thead", "tbody", "tfoot", "tr", "td", "th"), tagSet("table")},
+		"tfoot":    {tagSet("thead", "tbody", "tfoot", "tr", "td", "th"), tagSet("table")},
+		"option":   {tagSet("option"), tagSet("select", "datalist", "optgroup")},
+		"optgroup": {tagSet("option", "optgroup"), tagSet("select")},
+	}
+)
+
+// tagSet 构造标签集合
+func tagSet(tags ...string) map[string]bool {
+	m := make(map[string]bool, len(tags))
+	for _, t := range tags {
+		m[t] = true
+	}
+	return m
+}
+
+// ParseHTML 解析HTML
+//
+// 艹！不会报错，再烂的HTML也能解析出一棵树；不知道页面地址的话相对链接没法解析
+func ParseHTML(text string) *Document {
+	return NewDocument(text, nil)
+}
+
+// NewDocument 解析HTML，相对链接按pageURL解析
+func NewDocument(text string, pageURL *url.URL) *Document {
+	doc := &Document{URL: pageURL}
+	doc.Node = &Node{Type: DocumentNode, doc: doc}
+	(&htmlParser{doc: doc, stack: []*Node{doc.Node}}).parse(text)
+
+	if base := doc.First("base[href]"); base != nil {
+		if ref, err := url.Parse(strings.TrimSpace(base.Attr("href"))); err == nil {
+			if doc.URL != nil {
+				ref = doc.URL.ResolveReference(ref)
+			}
+			if ref.IsAbs() {
+				doc.URL = ref
+			}
+		}
+	}
+	return doc
+}
+
+// Document 把响应体解析成HTML文档
+//
+// 艹！按检测到的编码解码，相对链接按跳转之后的最终URL解析
+func (r *Response) Document() *Document {
+	var pageURL *url.URL
+	if r.Request != nil {
+		pageURL = r.Request.URL
+	}
+	return NewDocument(r.Text(), pageURL)
+}
+
+// GetDocument 发送GET请求并解析成HTML文档
+func (c *HTTPClient) GetDocument(ctx context.Context, url string) (*Document, error) {
+	resp, err := c.Fetch(ctx, url)
+	if err != nil {
+		return nil, err
+	}
+	return resp.Document(), nil
+}
+
+// Title 页面标题
+func (d *Document) Title() string {
+	if n := d.First("title"); n != nil {
+		return n.Text()
+	}
+	return ""
+}
+
+// AbsURL 把相对链接转成绝对地址，解析失败返回空字符串
+func (d *Document) AbsURL(ref string) string {
+	u, err := url.Parse(strings.TrimSpace(ref))
+	if err != nil {
+		return ""
+	}
+	if d.URL != nil {
+		u = d.URL.ResolveReference(u)
+	}
+	return u.String()
+}
+
+// Links 取匹配元素的href（没有就取src），转成绝对地址
+//
+// 艹！去掉#片段、去重，只保留http/https链接，javascript:和mailto:这种直接扔掉
+//
+//	for _, link := range doc.Links("a.next, .pagination a") {
+//		queue.Push(link)
+//	}
+func (d *Document) Links(selector string) []string {
+	var links []string
+	seen := make(map[string]bool)
+	for _, n := range d.Find(selector) {
+		ref, ok := n.attr("href")
+		if !ok {
+			ref, ok = n.attr("src")
+		}
+		if !ok {
+			continue
+		}
+
+		u, err := url.Parse(strings.TrimSpace(ref))
+		if err != nil {
+			continue
+		}
+		if d.URL != nil {
+			u = d.URL.ResolveReference(u)
+		}
+		if u.Scheme != "http" && u.Scheme != "https" {
+			continue
+		}
+		u.Fragment = ""
+		u.RawFragment = ""
+
+		link := u.String()
+		if !seen[link] {
+			seen[link] = true
+			links = append(links, link)
+		}
+	}
+	return links
+}
+
+// attr 取属性
+func (n *Node) attr(name string) (string, bool) {
+	if n == nil {
+		return "", false
+	}
+	name = strings.ToLower(name)
+	for _, a := range n.Attrs {
+		if a.Key == name {
+			return a.Val, true
+		}
+	}
+	return "", false
+}
+
+// Attr 取属性值，没有返回空字符串；n为nil也能调
+func (n *Node) Attr(name string) string {
+	v, _ := n.attr(name)
+	return v
+}
+
+// HasAttr 是否有这个属性
+func (n *Node) HasAttr(name string) bool {
+	_, ok := n.attr(name)
+	return ok
+}
+
+// AbsAttr 取属性值并按页面地址转成绝对URL，适合href、src
+func (n *Node) AbsAttr(name string) string {
+	v, ok := n.attr(name)
+	if !ok {
+		return ""
+	}
+	if n.doc == nil {
+		return v
+	}
+	return n.doc.AbsURL(v)
+}
+
+// HasClass 是否有这个class
+func (n *Node) HasClass(class string) bool {
+	for _, c := range strings.Fields(n.Attr("class")) {
+		if c == class {
+			return true
+		}
+	}
+	return false
+}
+
+// Text 元素里的文本
+//
+// 艹！跳过script和style，连续空白合并成一个空格，块级元素之间自动隔开；n为nil返回空字符串
+func (n *Node) Text() string {
+	if n == nil {
+		return ""
+	}
+	var b strings.Builder
+	n.collectText(&b)
+	return strings.Join(strings.Fields(b.String()), " ")
+}
+
+// collectText 收集文本
+func (n *Node) collectText(b *strings.Builder) {
+	switch n.Type {
+	case TextNode:
+		b.WriteString(n.Data)
+		return
+	case CommentNode:
+		return
+	case ElementNode:
+		if n.Tag == "script" || n.Tag == "style" {
+			return
+		}
+	}
+
+	block := n.Type == ElementNode && blockTags[n.Tag]
+	if block {
+		b.WriteByte(' ')
+	}
+	for _, c := range n.Children {
+		c.collectText(b)
+	}
+	if block {
+		b.WriteByte(' ')
+	}
+}
+
+// HTML 元素本身的HTML
+func (n *Node) HTML() string {
+	if n == nil {
+		return ""
+	}
+	var b strings.Builder
+	n.render(&b)
+	return b.String()
+}
+
+// InnerHTML 元素内部的HTML
+func (n *Node) InnerHTML() string {
+	if n == nil {
+		return ""
+	}
+	var b strings.Builder
+	for _, c := range n.Children {
+		c.render(&b)
+	}
+	return b.String()
+}
+
+// render 输出HTML
+func (n *Node) render(b *strings.Builder) {
+	switch n.Type {
+	case TextNode:
+		if n.Parent != nil && (n.Parent.Tag == "script" || n.Parent.Tag == "style") {
+			b.WriteString(n.Data)
+		} else {
+			b.WriteString(html.EscapeString(n.Data))
+		}
+		return
+	case CommentNode:
+		b.WriteString("<!--" + n.Data + "-->")
+		return
+	case DocumentNode:
+		for _, c := range n.Children {
+			c.render(b)
+		}
+		return
+	}
+
+	b.WriteString("<" + n.Tag)
+	for _, a := range n.Attrs {
+		b.WriteString(" " + a.Key + `="` + html.EscapeString(a.Val) + `"`)
+	}
+	b.WriteByte('>')
+	if voidTags[n.Tag] {
+		return
+	}
+	for _, c := range n.Children {
+		c.render(b)
+	}
+	b.WriteString("</" + n.Tag + ">")
+}
+
+// Elements 子元素（不含文本和注释）
+func (n *Node) Elements() []*Node {
+	if n == nil {
+		return nil
+	}
+	var elems []*Node
+	for _, c := range n.Children {
+		if c.Type == ElementNode {
+			elems = append(elems, c)
+		}
+	}
+	return elems
+}
+
+// htmlParser 简单的HTML解析器
+type htmlParser struct {
+	doc   *Document
+	stack []*Node // 打开的元素，stack[0]是文档根节点
+}
+
+// parse 解析整个文档
+func (p *htmlParser) parse(s string) {
+	for i := 0; i < len(s); {
+		if s[i] != '<' {
+			end := strings.IndexByte(s[i:], '<')
+			if end < 0 {
+				end = len(s) - i
+			}
+			p.text(html.UnescapeString(s[i : i+end]))
+			i += end
+			continue
+		}
+
+		rest := s[i:]
+		switch {
+		case strings.HasPrefix(rest, "<!--"):
+			end := strings.Index(rest[4:], "-->")
+			if end < 0 {
+				p.appendChild(&Node{Type: CommentNode, Data: rest[4:]})
+				return
+			}
+			p.appendChild(&Node{Type: CommentNode, Data: rest[4 : 4+end]})
+			i += 4 + end + 3
+		case strings.HasPrefix(rest, "<!") || strings.HasPrefix(rest, "<?"):
+			// doctype、CDATA、处理指令，直接跳过
+			end := strings.IndexByte(rest, '>')
+			if end < 0 {
+				return
+			}
+			i += end + 1
+		case strings.HasPrefix(rest, "</") && len(rest) > 2 && isASCIILetter(rest[2]):
+			name, n := scanTagName(rest[2:])
+			end := strings.IndexByte(rest[2+n:], '>')
+			if end < 0 {
+				return
+			}
+			p.closeTag(name)
+			i += 2 + n + end + 1
+		case len(rest) > 1 && isASCIILetter(rest[1]):
+			n, consumed := p.startTag(rest)
+			i += consumed
+			if n != nil && rawTextTags[n.Tag] {
+				i += p.rawText(n, s[i:])
+			}
+		default:
+			p.text("<")
+			i++
+		}
+	}
+}
+
+// text 添加文本，和前一个文本节点合并
+func (p *htmlParser) text(data string) {
+	if data == "" {
+		return
+	}
+	top := p.stack[len(p.stack)-1]
+	if k := len(top.Children); k > 0 && top.Children[k-1].Type == TextNode {
+		top.Children[k-1].Data += data
+		return
+	}
+	p.appendChild(&Node{Type: TextNode, Data: data})
+}
+
+// appendChild 添加到当前打开的元素下
+func (p *htmlParser) appendChild(n *Node) {
+	top := p.stack[len(p.stack)-1]
+	n.Parent = top
+	n.doc = p.doc
+	top.Children = append(top.Children, n)
+}
+
+// startTag 解析开始标签，返回元素和消耗的字节数
+func (p *htmlParser) startTag(s string) (*Node, int) {
+	name, i := scanTagName(s[1:])
+	i++
+	n := &Node{Type: ElementNode, Tag: name}
+	selfClosing := false
+
+	for i < len(s) {
+		i += skipSpace(s[i:])
+		if i >= len(s) {
+			break
+		}
+		if s[i] == '>' {
+			i++
+			break
+		}
+		if s[i] == '/' {
+			if i+1 < len(s) && s[i+1] == '>' {
+				selfClosing = true
+				i += 2
+				break
+			}
+			i++
+			continue
+		}
+
+		start := i
+		for i < len(s) && !isSpace(s[i]) && s[i] != '=' && s[i] != '>' && s[i] != '/' {
+			i++
+		}
+		key := strings.ToLower(s[start:i])
+		i += skipSpace(s[i:])
+
+		val := ""
+		if i < len(s) && s[i] == '=' {
+			i++
+			i += skipSpace(s[i:])
+			if i < len(s) && (s[i] == '"' || s[i] == '\'') {
+				q := s[i]
+				end := strings.IndexByte(s[i+1:], q)
+				if end < 0 {
+					end = len(s) - i - 1
+				}
+				val = s[i+1 : i+1+end]
+				i += end + 2
+			} else {
+				start := i
+				for i < len(s) && !isSpace(s[i]) && s[i] != '>' {
+					i++
+				}
+				val = s[start:i]
+			}
+		}
+		if _, dup := n.attr(key); !dup && key != "" {
+			n.Attrs = append(n.Attrs, Attribute{Key: key, Val: html.UnescapeString(val)})
+		}
+	}
+	if i > len(s) {
+		i = len(s)
+	}
+
+	p.autoClose(name)
+	p.appendChild(n)
+	if !voidTags[name] && !selfClosing {
+		p.stack = append(p.stack, n)
+	}
+	return n, i
+}
+
+// rawText 读取script、style这类元素的内容直到结束标签，返回消耗的字节数
+func (p *htmlParser) rawText(n *Node, s string) int {
+	if p.stack[len(p.stack)-1] != n {
+		return 0 // 自闭合了
+	}
+
+	end := indexFold(s, "</"+n.Tag)
+	if end < 0 {
+		end = len(s)
+	}
+	data := s[:end]
+	if n.Tag == "textarea" || n.Tag == "title" {
+		data = html.UnescapeString(data)
+	}
+	p.text(data)
+
+	p.stack = p.stack[:len(p.stack)-1]
+	if close := strings.IndexByte(s[end:], '>'); close >= 0 {
+		return end + close + 1
+	}
+	return len(s)
+}
+
+// autoClose 打开新元素前隐式关闭不能嵌套的元素
+func (p *htmlParser) autoClose(name string) {
+	if blockTags[name] && name != "br" {
+		p.closeMatching(closeP)
+	}
+	if rule, ok := autoCloseRules[name]; ok {
+		p.closeMatching(rule)
+	}
+}
+
+// closeMatching 往上找要关闭的元素，找到就连同它里面的一起关掉，一直找到scope为止
+//
+// 艹！<tr><td>1<tr>这种，新的tr要先关td再关tr
+func (p *htmlParser) closeMatching(rule autoCloseRule) {
+	for k := len(p.stack) - 1; k > 0; k-- {
+		tag := p.stack[k].Tag
+		if rule.closes[tag] {
+			p.stack = p.stack[:k]
+			continue
+		}
+		if rule.scope[tag] {
+			return
+		}
+	}
+}
+
+// closeTag 处理结束标签，没有对应的开始标签就忽略
+func (p *htmlParser) closeTag(name string) {
+	for k := len(p.stack) - 1; k > 0; k-- {
+		if p.stack[k].Tag == name {
+			p.stack = p.stack[:k]
+			return
+		}
+	}
+}
+
+// scanTagName 读取标签名，返回小写名字和长度
+func scanTagName(s string) (string, int) {
+	i := 0
+	for i < len(s) && !isSpace(s[i]) && s[i] != '>' && s[i] != '/' {
+		i++
+	}
+	return strings.ToLower(s[:i]), i
+}
+
+// skipSpace 返回开头空白的长度
+func skipSpace(s string) int {
+	i := 0
+	for i < len(s) && isSpace(s[i]) {
+		i++
+	}
+	return i
+}
+
+func isSpace(c byte) bool {
+	return c == ' ' || c == '\t' || c == '\n' || c == '\r' || c == '\f'
+}
+
+func isASCIILetter(c byte) bool {
+	return (c >= 'a' && c <= 'z') || (c >= 'A' && c <= 'Z')
+}
+
+// indexFold 不区分大小写查找（substr必须是小写ASCII）
+func indexFold(s, substr string) int {
+	for i := 0; i+len(substr) <= len(s); i++ {
+		if strings.EqualFold(s[i:i+len(substr)], substr) {
+			return i
+		}
+	}
+	return -1
+}
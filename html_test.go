@@ -0,0 +1,106 @@
+package crawlab
+
+import (
+	"net/url"
+	"reflect"
+	"testing"
+)
+
+func TestParseHTML(t *testing.T) {
+	tests := []struct {
+		name     string
+		html     string
+		selector string
+		want     string
+	}{
+		{"unclosed p", "<p>one<p>two<div>three</div>", "p", "one,two"},
+		{"unclosed li", "<ul><li>a<li>b</ul><li>c", "ul > li", "a,b"},
+		{"unclosed td", "<table><tr><td>1<td>2<tr><td>3</table>", "tr > td", "1,2,3"},
+		{"unclosed option", "<select><option>x<option>y</select>", "option", "x,y"},
+		{"dt dd", "<dl><dt>k<dd>v<dt>k2</dl>", "dl > *", "k,v,k2"},
+		{"entities", "<p>a &amp; b &lt;c&gt; &#x4e2d;</p>", "p", "a & b <c> 中"},
+		{"whitespace collapse", "<p>  a \n\t b  </p>", "p", "a b"},
+		{"script is raw text", `<div><script>if (a<b) { x = "</div>" }</script>ok</div>`, "div", "ok"},
+		{"style skipped", "<div><style>p{}</style>text</div>", "div", "text"},
+		{"comment skipped", "<div>a<!-- <p>b</p> -->c</div>", "div", "ac"},
+		{"void tags", "<div>a<br>b<img src=x>c</div>", "div", "a bc"},
+		{"uppercase tags", "<DIV CLASS=x>a</DIV>", "div.x", "a"},
+		{"block separation", "<div><p>a</p><p>b</p></div>", "div", "a b"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := texts(ParseHTML(tt.html).Find(tt.selector)); got != tt.want {
+				t.Errorf("Find(%q) = %q, want %q", tt.selector, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestNodeAttr(t *testing.T) {
+	doc := ParseHTML(`<a HREF="/x?a=1&amp;b=2" class="btn  primary" disabled>go</a>`)
+	a := doc.First("a")
+
+	if got := a.Attr("href"); got != "/x?a=1&b=2" {
+		t.Errorf("Attr(href) = %q", got)
+	}
+	if !a.HasAttr("disabled") || a.HasAttr("title") {
+		t.Errorf("HasAttr mismatch")
+	}
+	if !a.HasClass("primary") || a.HasClass("btn primary") {
+		t.Errorf("HasClass mismatch")
+	}
+
+	// nil节点也能调
+	var missing *Node = doc.First("span")
+	if missing.Attr("href") != "" || missing.Text() != "" || missing.HTML() != "" {
+		t.Errorf("nil node methods should return empty values")
+	}
+}
+
+func TestDocumentLinks(t *testing.T) {
+	page, _ := url.Parse("https://example.com/list/page1.html")
+
+	tests := []struct {
+		name string
+		html string
+		want []string
+	}{
+		{
+			"relative and absolute",
+			`<a href="page2.html">2</a><a href="/about">about</a><a href="https://other.com/x">x</a>`,
+			[]string{"https://example.com/list/page2.html", "https://example.com/about", "https://other.com/x"},
+		},
+		{
+			"fragments and duplicates",
+			`<a href="page2.html#top">2</a><a href="page2.html">2</a><a href="#">self</a>`,
+			[]string{"https://example.com/list/page2.html", "https://example.com/list/page1.html"},
+		},
+		{
+			"non http dropped",
+			`<a href="javascript:void(0)">js</a><a href="mailto:a@b.com">mail</a><a>none</a>`,
+			nil,
+		},
+		{
+			"base href",
+			`<head><base href="https://cdn.example.com/root/"></head><a href="x.html">x</a>`,
+			[]string{"https://cdn.example.com/root/x.html"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			doc := NewDocument(tt.html, page)
+			if got := doc.Links("a"); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("Links = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestDocumentTitle(t *testing.T) {
+	doc := ParseHTML("<html><head><title>A &amp; <b>B</b></title></head></html>")
+	if got := doc.Title(); got != "A & <b>B</b>" {
+		t.Errorf("Title = %q", got)
+	}
+}
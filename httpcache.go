@@ -0,0 +1,560 @@
+package crawlab
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// CacheHeader 缓存响应里标记缓存状态的响应头：HIT、REVALIDATED、MISS
+const CacheHeader = "X-Crawlab-Cache"
+
+// ErrCacheMiss 只读模式下缓存里没有这个请求
+var ErrCacheMiss = errors.New("response not in cache")
+
+// CacheMode 缓存模式
+type CacheMode int
+
+const (
+	CacheOff       CacheMode = iota // 不用缓存
+	CacheReadWrite                  // 新鲜的直接用，过期的带条件请求重新验证，新响应写入缓存
+	CacheReadOnly                   // 离线模式：只读缓存，不管是否过期，没有就返回ErrCacheMiss
+	CacheRefresh                    // 总是重新下载并覆盖缓存
+)
+
+// String 返回模式名称
+func (m CacheMode) String() string {
+	switch m {
+	case CacheOff:
+		return "off"
+	case CacheReadWrite:
+		return "read-write"
+	case CacheReadOnly:
+		return "read-only"
+	case CacheRefresh:
+		return "refresh"
+	default:
+		return fmt.Sprintf("mode(%d)", int(m))
+	}
+}
+
+// ParseCacheMode 解析缓存模式：off、read-write、read-only（或offline）、refresh
+func ParseCacheMode(s string) (CacheMode, error) {
+	switch strings.ToLower(strings.TrimSpace(s)) {
+	case "", "off":
+		return CacheOff, nil
+	case "read-write", "rw", "on":
+		return CacheReadWrite, nil
+	case "read-only", "ro", "offline":
+		return CacheReadOnly, nil
+	case "refresh":
+		return CacheRefresh, nil
+	default:
+		return CacheOff, fmt.Errorf("unknown cache mode %q (expected off, read-write, read-only or refresh)", s)
+	}
+}
+
+// cacheMeta 缓存文件头部的元数据
+type cacheMeta struct {
+	Method     string      `json:"method"`
+	URL        string      `json:"url"`
+	StatusCode int         `json:"status_code"`
+	Status     string      `json:"status"`
+	Header     http.Header `json:"header"`
+	StoredAt   time.Time   `json:"stored_at"`
+}
+
+// HTTPCache 磁盘HTTP响应缓存
+//
+// 艹！开发爬虫时同一个页面别下载几百遍：
+//   - 按方法、URL和VaryHeaders里的请求头区分缓存
+//   - 带Cookie/Authorization的请求不读也不写缓存，响应有Set-Cookie或Cache-Control: private的不缓存，
+//     不然一个会话登录后的页面会被别的会话拿到
+//   - 按Cache-Control/Expires判断新鲜度，都没有就用DefaultTTL
+//   - 过期了带If-None-Match/If-Modified-Since重新验证，304直接用缓存
+//   - MaxAge和MaxSize控制缓存目录的大小
+//
+// 用法：
+//
+//	cache, _ := crawlab.NewHTTPCache(".cache/http", crawlab.CacheReadWrite)
+//	client.SetCache(cache)
+type HTTPCache struct {
+	Dir         string        // 缓存目录
+	Mode        CacheMode     // 缓存模式
+	VaryHeaders []string      // 参与缓存键的请求头（例如Accept-Language、User-Agent）
+	DefaultTTL  time.Duration // 响应没有新鲜度信息时的有效期（默认1小时）
+	MaxAge      time.Duration // 超过这个时间的缓存文件会被清理（0不限制）
+	MaxSize     int64         // 缓存目录总大小上限，超过时先删最旧的（0不限制）
+	MaxBodySize int64         // 超过这个大小的响应体不缓存（默认10MB，<=0不限制）
+
+	hits        int64
+	misses      int64
+	revalidated int64
+	stores      int64
+	pruneMu     sync.Mutex
+}
+
+// NewHTTPCache 创建磁盘缓存
+func NewHTTPCache(dir string, mode CacheMode) (*HTTPCache, error) {
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return nil, fmt.Errorf("failed to create cache directory: %w", err)
+	}
+	return &HTTPCache{
+		Dir:         dir,
+		Mode:        mode,
+		DefaultTTL:  time.Hour,
+		MaxBodySize: DefaultMaxBodySize,
+	}, nil
+}
+
+// NewHTTPCacheFromConfig 按配置创建磁盘缓存
+//
+// 艹！HTTPCache为off时返回nil, nil
+func NewHTTPCacheFromConfig(cfg *Config) (*HTTPCache, error) {
+	mode, err := ParseCacheMode(cfg.HTTPCache)
+	if err != nil || mode == CacheOff {
+		return nil, err
+	}
+	return NewHTTPCache(cfg.HTTPCacheDir, mode)
+}
+
+// SetCache 设置磁盘缓存
+//
+// 艹！缓存命中时不走熔断、限流和代理；只读模式下也不检查robots.txt
+func (c *HTTPClient) SetCache(cache *HTTPCache) {
+	c.Cache = cache
+}
+
+// Key 计算请求的缓存键
+func (h *HTTPCache) Key(req *http.Request) string {
+	var b strings.Builder
+	b.WriteString(req.Method)
+	b.WriteByte(' ')
+	b.WriteString(req.URL.String())
+	for _, name := range h.VaryHeaders {
+		b.WriteByte('\n')
+		b.WriteString(http.CanonicalHeaderKey(name))
+		b.WriteByte(':')
+		b.WriteString(strings.Join(req.Header.Values(name), ","))
+	}
+	sum := sha256.Sum256([]byte(b.String()))
+	return hex.EncodeToString(sum[:])
+}
+
+// Stats 返回命中、未命中、重新验证和写入次数
+func (h *HTTPCache) Stats() (hits, misses, revalidated, stores int64) {
+	return atomic.LoadInt64(&h.hits), atomic.LoadInt64(&h.misses),
+		atomic.LoadInt64(&h.revalidated), atomic.LoadInt64(&h.stores)
+}
+
+// Clear 清空缓存目录
+func (h *HTTPCache) Clear() error {
+	entries, err := h.entries()
+	if err != nil {
+		return err
+	}
+	for _, e := range entries {
+		os.Remove(e.path)
+	}
+	return nil
+}
+
+// cacheEntry 读出来的一条缓存和当时的新鲜度
+//
+// 艹！doRequest判断能不能走缓存时读一次，通过请求的context交给wrap，
+// 两次读之间缓存刚好过期的话请求就会绕过熔断、限流和代理直接联网
+type cacheEntry struct {
+	key   string
+	meta  *cacheMeta
+	body  []byte
+	err   error
+	fresh bool
+}
+
+// cacheEntryKey 请求context里cacheEntry的键
+type cacheEntryKey struct{}
+
+// cacheBypassKey 请求context里标记不走缓存的键
+type cacheBypassKey struct{}
+
+// bypass 标记请求不读也不写缓存
+//
+// 艹！CookieJar里的Cookie是http.Client在缓存下面才加上的，wrap看不到，
+// 只能由doRequest提前查好了挂在请求上
+func (h *HTTPCache) bypass(req *http.Request) *http.Request {
+	if h == nil {
+		return req
+	}
+	return req.WithContext(context.WithValue(req.Context(), cacheBypassKey{}, true))
+}
+
+// lookup 读出请求对应的缓存挂到请求上，返回能不能不联网直接从缓存返回
+func (h *HTTPCache) lookup(req *http.Request) (*http.Request, bool) {
+	if h == nil || !cacheableRequest(req) {
+		return req, false
+	}
+	switch h.Mode {
+	case CacheReadOnly, CacheReadWrite:
+	default:
+		return req, false
+	}
+
+	e := h.read(h.Key(req))
+	req = req.WithContext(context.WithValue(req.Context(), cacheEntryKey{}, e))
+	return req, h.Mode == CacheReadOnly || e.fresh
+}
+
+// entry 优先用lookup挂在请求上的缓存，没有（或者中间件改了缓存键）才读文件
+func (h *HTTPCache) entry(req *http.Request, key string) *cacheEntry {
+	if e, ok := req.Context().Value(cacheEntryKey{}).(*cacheEntry); ok && e.key == key {
+		return e
+	}
+	return h.read(key)
+}
+
+// read 读缓存文件并判断新鲜度
+func (h *HTTPCache) read(key string) *cacheEntry {
+	e := &cacheEntry{key: key}
+	e.meta, e.body, e.err = h.load(key)
+	e.fresh = e.err == nil && h.fresh(e.meta, time.Now())
+	return e
+}
+
+// offline 是否离线模式
+func (h *HTTPCache) offline() bool {
+	return h != nil && h.Mode == CacheReadOnly
+}
+
+// wrap 把缓存包在next外面
+func (h *HTTPCache) wrap(next RoundTripFunc) RoundTripFunc {
+	return func(req *http.Request) (*http.Response, error) {
+		if h.Mode == CacheOff || !cacheableRequest(req) {
+			return next(req)
+		}
+
+		key := h.Key(req)
+		if h.Mode == CacheRefresh {
+			return h.fetch(next, req, key)
+		}
+
+		e := h.entry(req, key)
+		meta, body := e.meta, e.body
+		if e.err != nil {
+			if h.Mode == CacheReadOnly {
+				atomic.AddInt64(&h.misses, 1)
+				return nil, fmt.Errorf("%w: %s %s", ErrCacheMiss, req.Method, req.URL.Redacted())
+			}
+			return h.fetch(next, req, key)
+		}
+
+		if h.Mode == CacheReadOnly || e.fresh {
+			atomic.AddInt64(&h.hits, 1)
+			return meta.response(req, body, "HIT"), nil
+		}
+
+		// 过期了：有验证器就带条件请求，304直接用缓存
+		etag, lastModified := meta.Header.Get("ETag"), meta.Header.Get("Last-Modified")
+		if etag == "" && lastModified == "" {
+			return h.fetch(next, req, key)
+		}
+
+		cond := req.Clone(req.Context())
+		if etag != "" && cond.Header.Get("If-None-Match") == "" {
+			cond.Header.Set("If-None-Match", etag)
+		}
+		if lastModified != "" && cond.Header.Get("If-Modified-Since") == "" {
+			cond.Header.Set("If-Modified-Since", lastModified)
+		}
+
+		resp, err := next(cond)
+		if err != nil || resp.StatusCode != http.StatusNotModified {
+			return h.store(req, key, resp, err)
+		}
+		resp.Body.Close()
+
+		// 用304的响应头更新缓存（新的Date、Cache-Control、ETag等）
+		for k, v := range resp.Header {
+			if k != "Content-Length" {
+				meta.Header[k] = v
+			}
+		}
+		meta.StoredAt = time.Now()
+		if err := h.save(key, meta, body); err != nil {
+			LogWarn("Failed to update cache for %s: %v", req.URL.Redacted(), err)
+		}
+		atomic.AddInt64(&h.revalidated, 1)
+		return meta.response(req, body, "REVALIDATED"), nil
+	}
+}
+
+// fetch 联网下载并写入缓存
+func (h *HTTPCache) fetch(next RoundTripFunc, req *http.Request, key string) (*http.Response, error) {
+	resp, err := next(req)
+	return h.store(req, key, resp, err)
+}
+
+// store 可以缓存的响应写入缓存，响应体读到内存里重新包一层返回
+func (h *HTTPCache) store(req *http.Request, key string, resp *http.Response, err error) (*http.Response, error) {
+	atomic.AddInt64(&h.misses, 1)
+	if err != nil || !cacheableResponse(resp) {
+		if resp != nil {
+			resp.Header.Set(CacheHeader, "MISS")
+		}
+		return resp, err
+	}
+
+	resp.Header.Set(CacheHeader, "MISS")
+	body, ok, err := bufferBody(resp, h.MaxBodySize)
+	if err != nil {
+		return nil, err
+	}
+	if !ok {
+		LogDebug("Response for %s exceeds %d bytes, not cached", req.URL.Redacted(), h.MaxBodySize)
+		return resp, nil
+	}
+
+	meta := &cacheMeta{
+		Method:     req.Method,
+		URL:        req.URL.String(),
+		StatusCode: resp.StatusCode,
+		Status:     resp.Status,
+		Header:     resp.Header.Clone(),
+		StoredAt:   time.Now(),
+	}
+	meta.Header.Del(CacheHeader)
+	if err := h.save(key, meta, body); err != nil {
+		LogWarn("Failed to write cache for %s: %v", req.URL.Redacted(), err)
+		return resp, nil
+	}
+
+	// 每写50次清理一次，别每次都扫目录
+	if n := atomic.AddInt64(&h.stores, 1); n%50 == 0 && (h.MaxAge > 0 || h.MaxSize > 0) {
+		go h.Prune()
+	}
+	return resp, nil
+}
+
+// fresh 按Cache-Control、Expires、DefaultTTL判断是否新鲜
+func (h *HTTPCache) fresh(meta *cacheMeta, now time.Time) bool {
+	cc := parseCacheControl(meta.Header.Get("Cache-Control"))
+	if _, ok := cc["no-cache"]; ok {
+		return false
+	}
+
+	age := now.Sub(meta.StoredAt)
+	if v, err := strconv.Atoi(meta.Header.Get("Age")); err == nil && v > 0 {
+		age += time.Duration(v) * time.Second
+	}
+
+	lifetime := h.DefaultTTL
+	if v, ok := cc["max-age"]; ok {
+		if secs, err := strconv.Atoi(v); err == nil {
+			lifetime = time.Duration(secs) * time.Second
+		}
+	} else if expires := meta.Header.Get("Expires"); expires != "" {
+		lifetime = 0
+		if t, err := http.ParseTime(expires); err == nil {
+			date, err := http.ParseTime(meta.Header.Get("Date"))
+			if err != nil {
+				date = meta.StoredAt
+			}
+			lifetime = t.Sub(date)
+		}
+	}
+	return age < lifetime
+}
+
+// load 读取缓存文件：第一行是JSON元数据，后面是响应体
+func (h *HTTPCache) load(key string) (*cacheMeta, []byte, error) {
+	data, err := os.ReadFile(h.path(key))
+	if err != nil {
+		return nil, nil, err
+	}
+	line, body, ok := bytes.Cut(data, []byte("\n"))
+	if !ok {
+		return nil, nil, fmt.Errorf("corrupt cache entry %s", key)
+	}
+	var meta cacheMeta
+	if err := json.Unmarshal(line, &meta); err != nil {
+		return nil, nil, fmt.Errorf("corrupt cache entry %s: %w", key, err)
+	}
+	if meta.Header == nil {
+		meta.Header = http.Header{}
+	}
+	return &meta, body, nil
+}
+
+// save 写缓存文件，先写临时文件再改名
+func (h *HTTPCache) save(key string, meta *cacheMeta, body []byte) error {
+	line, err := json.Marshal(meta)
+	if err != nil {
+		return err
+	}
+
+	path := h.path(key)
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return err
+	}
+	tmp, err := os.CreateTemp(filepath.Dir(path), ".tmp-*")
+	if err != nil {
+		return err
+	}
+	w := bufio.NewWriter(tmp)
+	w.Write(line)
+	w.WriteByte('\n')
+	w.Write(body)
+	if err := w.Flush(); err != nil {
+		tmp.Close()
+		os.Remove(tmp.Name())
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		os.Remove(tmp.Name())
+		return err
+	}
+	return os.Rename(tmp.Name(), path)
+}
+
+// path 缓存文件路径，按键的前两位分子目录
+func (h *HTTPCache) path(key string) string {
+	return filepath.Join(h.Dir, key[:2], key+".cache")
+}
+
+// cacheFile 一个缓存文件
+type cacheFile struct {
+	path    string
+	size    int64
+	modTime time.Time
+}
+
+// entries 列出所有缓存文件
+func (h *HTTPCache) entries() ([]cacheFile, error) {
+	var files []cacheFile
+	err := filepath.Walk(h.Dir, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			if os.IsNotExist(err) {
+				return nil
+			}
+			return err
+		}
+		if !info.IsDir() && strings.HasSuffix(path, ".cache") {
+			files = append(files, cacheFile{path: path, size: info.Size(), modTime: info.ModTime()})
+		}
+		return nil
+	})
+	return files, err
+}
+
+// Prune 按MaxAge和MaxSize清理缓存，返回删除的文件数
+func (h *HTTPCache) Prune() (int, error) {
+	h.pruneMu.Lock()
+	defer h.pruneMu.Unlock()
+
+	files, err := h.entries()
+	if err != nil {
+		return 0, fmt.Errorf("failed to scan cache directory: %w", err)
+	}
+
+	// 从旧到新
+	sort.Slice(files, func(i, j int) bool {
+		return files[i].modTime.Before(files[j].modTime)
+	})
+
+	var total int64
+	for _, f := range files {
+		total += f.size
+	}
+
+	removed := 0
+	cutoff := time.Now().Add(-h.MaxAge)
+	for _, f := range files {
+		expired := h.MaxAge > 0 && f.modTime.Before(cutoff)
+		oversize := h.MaxSize > 0 && total > h.MaxSize
+		if !expired && !oversize {
+			break
+		}
+		if err := os.Remove(f.path); err == nil {
+			removed++
+			total -= f.size
+		}
+	}
+	if removed > 0 {
+		LogDebug("Pruned %d cache entries from %s", removed, h.Dir)
+	}
+	return removed, nil
+}
+
+// response 从缓存构造响应
+func (m *cacheMeta) response(req *http.Request, body []byte, state string) *http.Response {
+	header := m.Header.Clone()
+	header.Set(CacheHeader, state)
+	return &http.Response{
+		Status:        m.Status,
+		StatusCode:    m.StatusCode,
+		Proto:         "HTTP/1.1",
+		ProtoMajor:    1,
+		ProtoMinor:    1,
+		Header:        header,
+		Body:          io.NopCloser(bytes.NewReader(body)),
+		ContentLength: int64(len(body)),
+		Request:       req,
+	}
+}
+
+// cacheableRequest 只缓存不带身份的GET和HEAD
+func cacheableRequest(req *http.Request) bool {
+	switch req.Method {
+	case "", http.MethodGet, http.MethodHead:
+	default:
+		return false
+	}
+	if bypass, _ := req.Context().Value(cacheBypassKey{}).(bool); bypass {
+		return false
+	}
+	return req.Header.Get("Cookie") == "" && req.Header.Get("Authorization") == ""
+}
+
+// cacheableResponse 状态码可缓存，没有no-store、private，也不设置Cookie
+func cacheableResponse(resp *http.Response) bool {
+	switch resp.StatusCode {
+	case 200, 203, 204, 300, 301, 404, 410:
+	default:
+		return false
+	}
+	if len(resp.Header.Values("Set-Cookie")) > 0 {
+		return false
+	}
+	cc := parseCacheControl(resp.Header.Get("Cache-Control"))
+	_, noStore := cc["no-store"]
+	_, private := cc["private"]
+	return !noStore && !private
+}
+
+// parseCacheControl 解析Cache-Control，指令名转小写
+func parseCacheControl(v string) map[string]string {
+	cc := make(map[string]string)
+	for _, part := range strings.Split(v, ",") {
+		part = strings.TrimSpace(part)
+		if part == "" {
+			continue
+		}
+		name, value, _ := strings.Cut(part, "=")
+		cc[strings.ToLower(strings.TrimSpace(name))] = strings.Trim(strings.TrimSpace(value), `"`)
+	}
+	return cc
+}
@@ -0,0 +1,137 @@
+package crawlab
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+)
+
+// cacheTestServer 返回请求带的session Cookie，响应头由path决定
+func cacheTestServer(t *testing.T) *httptest.Server {
+	t.Helper()
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/private":
+			w.Header().Set("Cache-Control", "private, max-age=60")
+		case "/login":
+			w.Header().Set("Cache-Control", "max-age=60")
+			w.Header().Set("Set-Cookie", "session=new")
+		case "/big":
+			w.Header().Set("Cache-Control", "max-age=60")
+			w.Write([]byte(strings.Repeat("x", 100)))
+			return
+		default:
+			w.Header().Set("Cache-Control", "max-age=60")
+		}
+		user := "anonymous"
+		if c, err := r.Cookie("session"); err == nil {
+			user = c.Value
+		}
+		w.Write([]byte(user))
+	}))
+	t.Cleanup(srv.Close)
+	return srv
+}
+
+// fetchCached 发请求，返回响应体和缓存状态
+func fetchCached(t *testing.T, c *HTTPClient, rawURL string) (string, string) {
+	t.Helper()
+	resp, err := c.Get(context.Background(), rawURL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return string(body), resp.Header.Get(CacheHeader)
+}
+
+func TestHTTPCacheSessions(t *testing.T) {
+	srv := cacheTestServer(t)
+	u, _ := url.Parse(srv.URL)
+
+	cache, err := NewHTTPCache(t.TempDir(), CacheReadWrite)
+	if err != nil {
+		t.Fatal(err)
+	}
+	client := NewHTTPClient(5 * time.Second)
+	client.SetCache(cache)
+
+	alice := client.Session("alice")
+	alice.Cookies().Add(SavedCookie{Name: "session", Value: "alice", Domain: u.Hostname(), Path: "/"})
+	bob := client.Session("bob")
+
+	tests := []struct {
+		name      string
+		client    *HTTPClient
+		wantBody  string
+		wantCache string
+	}{
+		{"logged in session bypasses the cache", alice, "alice", ""},
+		{"anonymous session stores", bob, "anonymous", "MISS"},
+		{"anonymous session hits", bob, "anonymous", "HIT"},
+		{"logged in session never sees the shared copy", alice, "alice", ""},
+		{"base client shares anonymous copy", client, "anonymous", "HIT"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			body, state := fetchCached(t, tt.client, srv.URL+"/page")
+			if body != tt.wantBody || state != tt.wantCache {
+				t.Errorf("got (%q, %q), want (%q, %q)", body, state, tt.wantBody, tt.wantCache)
+			}
+		})
+	}
+}
+
+func TestHTTPCacheNotStored(t *testing.T) {
+	srv := cacheTestServer(t)
+
+	tests := []struct {
+		name     string
+		path     string
+		header   string
+		wantBody string
+	}{
+		{"cache-control private", "/private", "", "anonymous"},
+		{"response sets cookie", "/login", "", "anonymous"},
+		{"request has authorization", "/page", "Authorization", "anonymous"},
+		{"body over MaxBodySize", "/big", "", strings.Repeat("x", 100)},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cache, err := NewHTTPCache(t.TempDir(), CacheReadWrite)
+			if err != nil {
+				t.Fatal(err)
+			}
+			cache.MaxBodySize = 50
+			client := NewHTTPClient(5 * time.Second)
+			client.Client.Jar = nil
+			client.SetCache(cache)
+			if tt.header != "" {
+				client.SetHeader(tt.header, "Bearer t")
+			}
+
+			for i := 0; i < 2; i++ {
+				body, state := fetchCached(t, client, srv.URL+tt.path)
+				if body != tt.wantBody {
+					t.Errorf("request %d: body = %q, want %q", i, body, tt.wantBody)
+				}
+				if state == "HIT" {
+					t.Errorf("request %d: served from cache", i)
+				}
+			}
+			if _, _, _, stores := cache.Stats(); stores != 0 {
+				t.Errorf("stores = %d, want 0", stores)
+			}
+		})
+	}
+}
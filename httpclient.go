@@ -1,13 +1,71 @@
 package crawlab
 
 import (
+	"bytes"
 	"context"
+	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
+	"mime"
 	"net/http"
+	"strings"
+	"sync"
 	"time"
 )
 
+const (
+	// DefaultMaxBodySize 响应体默认最大大小（10MB）
+	DefaultMaxBodySize = 10 * 1024 * 1024
+
+	// errorSnippetSize HTTPError里保留的响应体长度
+	errorSnippetSize = 1024
+)
+
+// ErrBodyTooLarge 响应体超过大小限制
+var ErrBodyTooLarge = errors.New("response body too large")
+
+// HTTPError HTTP状态码错误
+//
+// 艹！用errors.As拿到它，别再去解析错误字符串了
+//
+//	var httpErr *crawlab.HTTPError
+//	if errors.As(err, &httpErr) && httpErr.StatusCode == 404 { ... }
+type HTTPError struct {
+	Method     string      // 请求方法
+	URL        string      // 请求URL
+	StatusCode int         // 状态码
+	Status     string      // 状态行，例如"404 Not Found"
+	Header     http.Header // 响应头
+	Body       []byte      // 响应体片段（最多1KB）
+}
+
+// Error 实现error接口
+func (e *HTTPError) Error() string {
+	msg := fmt.Sprintf("HTTP %s: %s %s", e.Status, e.Method, e.URL)
+	if len(e.Body) > 0 {
+		msg += ": " + strings.TrimSpace(string(e.Body))
+	}
+	return msg
+}
+
+// newHTTPError 从响应构造HTTPError，会读取一段响应体但不关闭
+func newHTTPError(resp *http.Response) *HTTPError {
+	e := &HTTPError{
+		StatusCode: resp.StatusCode,
+		Status:     resp.Status,
+		Header:     resp.Header,
+	}
+	if resp.Request != nil {
+		e.Method = resp.Request.Method
+		e.URL = resp.Request.URL.String()
+	}
+	if resp.Body != nil {
+		e.Body, _ = io.ReadAll(io.LimitReader(resp.Body, errorSnippetSize))
+	}
+	return e
+}
+
 // HTTPClient HTTP客户端
 //
 // 艹！封装http.Client，自动重试、设置Header
@@ -16,20 +74,82 @@ type HTTPClient struct {
 	Headers    map[string]string // 默认请求头
 	MaxRetries int               // 最大重试次数
 	RetryDelay time.Duration     // 重试延迟
+
+	// MaxBodySize GetJSON/PostJSON/Fetch读取响应体的最大字节数（默认10MB，<=0不限制）
+	MaxBodySize int64
+
+	// MaxReplayBodySize 不可Seek的请求体为重试缓冲的最大字节数（默认8MB）
+	// 超过这个大小又需要重试时返回ErrBodyNotRewindable
+	MaxReplayBodySize int64
+
+	// RetryPolicy 重试策略，为nil时由MaxRetries/RetryDelay生成默认策略
+	RetryPolicy *RetryPolicy
+
+	// Breakers 按host的熔断器，为nil时不熔断
+	Breakers *HostBreakers
+
+	// Limiter 限流器，为nil时不限流
+	Limiter *RateLimiter
+
+	// Robots robots.txt检查器，为nil时不检查
+	Robots RobotsChecker
+
+	// Proxies 代理池，为nil时不走代理池
+	Proxies *ProxyPool
+
+	// Rotator 请求头轮换器，为nil时不轮换
+	Rotator *HeaderRotator
+
+	// Middlewares 请求中间件，见middleware.go
+	Middlewares []Middleware
+
+	// Cache 磁盘响应缓存，为nil时不缓存
+	Cache *HTTPCache
+
+	mu       sync.Mutex             // 保护sessions和profile
+	sessions map[string]*HTTPClient // 命名会话，见session.go
+	profile  *HeaderProfile         // RotatePerSession模式下固定的请求头
 }
 
 // NewHTTPClient 创建HTTP客户端
 //
-// 艹！设置超时时间，默认不重试
+// 艹！设置超时时间，默认不重试，自带CookieJar
 func NewHTTPClient(timeout time.Duration) *HTTPClient {
 	return &HTTPClient{
 		Client: &http.Client{
 			Timeout: timeout,
+			Jar:     NewCookieJar(),
 		},
-		Headers:    make(map[string]string),
-		MaxRetries: 0,         // 默认不重试
-		RetryDelay: 2 * time.Second,
+		Headers:           make(map[string]string),
+		MaxRetries:        0, // 默认不重试
+		RetryDelay:        2 * time.Second,
+		MaxBodySize:       DefaultMaxBodySize,
+		MaxReplayBodySize: DefaultMaxReplayBodySize,
+	}
+}
+
+// NewHTTPClientFromConfig 按配置创建HTTP客户端
+//
+// 艹！超时、重试、限流都从Config来，MaxConcurrency终于管用了
+func NewHTTPClientFromConfig(cfg *Config) *HTTPClient {
+	c := NewHTTPClient(cfg.RequestTimeout)
+	c.SetRetry(cfg.MaxRetries, cfg.RetryDelay)
+	c.SetRateLimiter(NewRateLimiterFromConfig(cfg))
+
+	pool, err := NewProxyPoolFromConfig(cfg)
+	if err != nil {
+		LogWarn("Failed to load proxies: %v, connecting directly", err)
+	} else if pool != nil {
+		c.SetProxyPool(pool)
+	}
+
+	cache, err := NewHTTPCacheFromConfig(cfg)
+	if err != nil {
+		LogWarn("Failed to set up HTTP cache: %v, caching disabled", err)
+	} else if cache != nil {
+		c.SetCache(cache)
 	}
+	return c
 }
 
 // SetHeader 设置请求头
@@ -49,21 +169,96 @@ func (c *HTTPClient) SetHeaders(headers map[string]string) {
 // SetRetry 设置重试参数
 //
 // 艹！maxRetries: 最大重试次数，delay: 重试延迟
+// 设置过RetryPolicy的话，同时更新它的次数和退避
 func (c *HTTPClient) SetRetry(maxRetries int, delay time.Duration) {
 	c.MaxRetries = maxRetries
 	c.RetryDelay = delay
+	if c.RetryPolicy != nil {
+		c.RetryPolicy.MaxRetries = maxRetries
+		c.RetryPolicy.Backoff = ConstantBackoff(delay)
+	}
+}
+
+// SetRetryPolicy 设置重试策略
+func (c *HTTPClient) SetRetryPolicy(policy *RetryPolicy) {
+	c.RetryPolicy = policy
+}
+
+// SetCircuitBreaker 设置按host的熔断器
+//
+// 艹！某个host失败率太高就直接返回ErrCircuitOpen，不再发请求也不再重试
+// 连接错误和5xx算失败，多个HTTPClient可以共享同一个HostBreakers
+func (c *HTTPClient) SetCircuitBreaker(breakers *HostBreakers) {
+	c.Breakers = breakers
+}
+
+// SetRateLimiter 设置限流器
+//
+// 艹！每次尝试（包括重试）都要先拿到令牌和连接名额，429/503会让对应host自动减速
+func (c *HTTPClient) SetRateLimiter(limiter *RateLimiter) {
+	c.Limiter = limiter
+}
+
+// RobotsChecker robots.txt检查钩子
+//
+// 艹！robots子包的robots.Checker实现了它，Check返回错误时请求不会发出去
+type RobotsChecker interface {
+	Check(ctx context.Context, rawURL string) error
+}
+
+// SetRobots 开启robots.txt检查，checker为nil时关闭
+//
+//	client.SetRobots(robots.NewChecker(client, ""))
+func (c *HTTPClient) SetRobots(checker RobotsChecker) {
+	c.Robots = checker
+}
+
+// SetProxyPool 设置代理池
+//
+// 艹！每次尝试（包括重试）都重新选代理，失败和封禁状态码会报告给代理池
+// 会给底层Client换一个独立的Transport，不影响http.DefaultTransport
+func (c *HTTPClient) SetProxyPool(pool *ProxyPool) {
+	c.Proxies = pool
+
+	// 装了磁带的话代理装在磁带后面，和SetCassette的先后顺序无关
+	if cassette, ok := c.Client.Transport.(*CassetteTransport); ok {
+		if transport := proxyTransport(cassette.Next, pool); transport != nil {
+			cassette.Next = transport
+		}
+		return
+	}
+	if transport := proxyTransport(c.Client.Transport, pool); transport != nil {
+		c.Client.Transport = transport
+	}
+}
+
+// proxyTransport 复制rt并装上代理池，rt不是*http.Transport时返回nil
+func proxyTransport(rt http.RoundTripper, pool *ProxyPool) *http.Transport {
+	var transport *http.Transport
+	switch t := rt.(type) {
+	case nil:
+		transport = http.DefaultTransport.(*http.Transport).Clone()
+	case *http.Transport:
+		transport = t.Clone()
+	default:
+		LogWarn("HTTPClient transport is not *http.Transport, proxy pool not installed")
+		return nil
+	}
+	transport.Proxy = pool.ProxyFunc
+	return transport
 }
 
 // Get 发送GET请求
 //
-// 艹！自动重试、自动设置Header
+// 艹！自动重试、自动设置Header；返回的resp.Body必须Close（或者读到EOF），
+// 设置了限流器时并发名额要等这时候才归还，忘了关会把别的请求全卡住
 func (c *HTTPClient) Get(ctx context.Context, url string) (*http.Response, error) {
 	return c.DoRequest(ctx, "GET", url, nil)
 }
 
 // Post 发送POST请求
 //
-// 艹！body可以是nil、string、[]byte、io.Reader等
+// 艹！body是io.Reader，重试时会自动重新发送（见MaxReplayBodySize）
 func (c *HTTPClient) Post(ctx context.Context, url string, body io.Reader) (*http.Response, error) {
 	return c.DoRequest(ctx, "POST", url, body)
 }
@@ -80,76 +275,279 @@ func (c *HTTPClient) Delete(ctx context.Context, url string) (*http.Response, er
 
 // DoRequest 执行HTTP请求
 //
-// 艹！核心方法，支持重试和自定义Header
+// 艹！核心方法，支持重试和自定义Header；和Get一样，resp.Body用完必须Close
 func (c *HTTPClient) DoRequest(ctx context.Context, method, url string, body io.Reader) (*http.Response, error) {
-	var resp *http.Response
+	return c.doRequest(ctx, method, url, body, nil)
+}
+
+// doRequest 执行HTTP请求，header是本次请求额外的请求头（覆盖默认Header）
+func (c *HTTPClient) doRequest(ctx context.Context, method, url string, body io.Reader, header http.Header) (*http.Response, error) {
+	// robots.txt检查，离线模式没法抓robots.txt
+	if c.Robots != nil && !c.Cache.offline() {
+		if err := c.Robots.Check(ctx, url); err != nil {
+			return nil, err
+		}
+	}
+
+	// 包装请求体，每次重试都能重新发送
+	rb, err := newRequestBody(body, c.MaxReplayBodySize)
+	if err != nil {
+		return nil, err
+	}
+
+	policy := c.retryPolicy()
+	profile := c.nextProfile()
+	send := c.roundTripper()
+	var lastErr error
+
+	// 熔断器放行之后、报告结果之前提前返回的话，半开的试探名额要还回去，
+	// 不然这个host会被永远拒绝
+	var unreported *CircuitBreaker
+	defer func() {
+		if unreported != nil {
+			unreported.release()
+		}
+	}()
+
+	// 重试循环交给Retrier，等多久由RetryPolicy决定（Delayed），不重试的用Permanent结束
+	var result *http.Response
+	attempt := 0
+	retrier := NewRetrier(WithMaxRetries(policy.MaxRetries))
+	err = retrier.Do(ctx, func() error {
+		defer func() { attempt++ }()
 
-	// 重试执行
-	err := Retry(func() error {
 		// 创建请求
-		req, err := http.NewRequestWithContext(ctx, method, url, body)
+		req, err := http.NewRequestWithContext(ctx, method, url, nil)
 		if err != nil {
-			return fmt.Errorf("failed to create request: %w", err)
+			return Permanent(fmt.Errorf("failed to create request: %w", err))
+		}
+		if rb != nil {
+			if req.Body, err = rb.open(attempt); err != nil {
+				if lastErr != nil {
+					err = fmt.Errorf("%w (previous attempt: %v)", err, lastErr)
+				}
+				return Permanent(err)
+			}
+			req.ContentLength = rb.size
+			if rb.size == 0 {
+				req.Body = http.NoBody
+			}
+			// 307/308重定向时http.Client也要能重新拿到请求体
+			next := attempt + 1
+			req.GetBody = func() (io.ReadCloser, error) {
+				return rb.open(next)
+			}
 		}
 
-		// 设置默认Header
+		// 设置默认Header，轮换的请求头优先级最低
+		for k, v := range profile {
+			req.Header.Set(k, v)
+		}
 		for k, v := range c.Headers {
 			req.Header.Set(k, v)
 		}
+		for k, v := range header {
+			req.Header[k] = v
+		}
 
-		// 发送请求
-		resp, err = c.Client.Do(req)
-		if err != nil {
-			return fmt.Errorf("request failed: %w", err)
+		// 带着登录态的请求不走缓存，缓存是所有会话共用的
+		if c.Cache != nil && c.Client.Jar != nil && len(c.Client.Jar.Cookies(req.URL)) > 0 {
+			req = c.Cache.bypass(req)
 		}
 
-		// 检查状态码（5xx需要重试）
-		if resp.StatusCode >= 500 {
-			resp.Body.Close()
-			return fmt.Errorf("server error: %d %s", resp.StatusCode, resp.Status)
+		// 缓存能直接返回的话不用熔断、限流和代理
+		req, cached := c.Cache.lookup(req)
+		network := !cached
+
+		// 熔断检查
+		var breaker *CircuitBreaker
+		if network && c.Breakers != nil {
+			breaker = c.Breakers.Get(req.URL.Host)
+			if err := breaker.Allow(); err != nil {
+				if req.Body != nil {
+					req.Body.Close()
+				}
+				if lastErr != nil {
+					err = fmt.Errorf("%w (previous attempt: %v)", err, lastErr)
+				}
+				return Permanent(err)
+			}
+			unreported = breaker
 		}
 
-		return nil
-	}, c.MaxRetries, c.RetryDelay)
+		// 限流
+		var release func()
+		if network && c.Limiter != nil {
+			if release, err = c.Limiter.Wait(ctx, req.URL.Host); err != nil {
+				if req.Body != nil {
+					req.Body.Close()
+				}
+				return Permanent(fmt.Errorf("rate limiter wait cancelled: %w", err))
+			}
+		}
+
+		// 选代理
+		if network && c.Proxies != nil {
+			if req, err = c.withProxy(req); err != nil {
+				if release != nil {
+					release()
+				}
+				if req.Body != nil {
+					req.Body.Close()
+				}
+				return Permanent(err)
+			}
+		}
 
+		// 发送请求
+		resp, err := send(req)
+		if network && c.Proxies != nil {
+			c.Proxies.Report(proxyFromContext(req.Context()), resp, err)
+		}
+		if breaker != nil {
+			breaker.report(err, resp)
+			unreported = nil
+		}
+		if release != nil {
+			c.Limiter.Feedback(req.URL.Host, resp, err)
+			if err != nil {
+				release()
+			} else {
+				resp.Body = &releaseOnClose{ReadCloser: resp.Body, release: release}
+			}
+		}
+
+		retry, delay := policy.Decide(req, attempt, resp, err)
+		if !retry {
+			result, err = c.finish(resp, err, attempt)
+			return Permanent(err)
+		}
+
+		if err != nil {
+			lastErr = fmt.Errorf("request failed: %w", err)
+		} else {
+			lastErr = newHTTPError(resp)
+			resp.Body.Close()
+		}
+		return Delayed(lastErr, delay)
+	})
 	if err != nil {
 		return nil, err
 	}
+	return result, nil
+}
+
+// finish 处理最后一次尝试的结果
+//
+// 艹！5xx和重试列表里的状态码（比如429）返回*HTTPError，其他状态码原样返回响应
+func (c *HTTPClient) finish(resp *http.Response, err error, attempt int) (*http.Response, error) {
+	if err != nil {
+		err = fmt.Errorf("request failed: %w", err)
+	} else if resp.StatusCode >= 500 || c.retryPolicy().IsRetryableStatus(resp.StatusCode) {
+		err = newHTTPError(resp)
+		resp.Body.Close()
+	} else {
+		return resp, nil
+	}
+
+	if attempt > 0 {
+		return nil, fmt.Errorf("all %d attempts failed, last error: %w", attempt+1, err)
+	}
+	return nil, err
+}
 
-	return resp, nil
+// retryPolicy 返回生效的重试策略
+//
+// 艹！没设置RetryPolicy时按MaxRetries/RetryDelay生成默认策略
+func (c *HTTPClient) retryPolicy() *RetryPolicy {
+	if c.RetryPolicy != nil {
+		return c.RetryPolicy
+	}
+	return DefaultRetryPolicy(c.MaxRetries, ConstantBackoff(c.RetryDelay))
 }
 
 // GetJSON 发送GET请求并解析JSON响应
 //
 // 艹！自动解析JSON到结构体
+// 状态码>=400返回*HTTPError
 func (c *HTTPClient) GetJSON(ctx context.Context, url string, v interface{}) error {
-	resp, err := c.Get(ctx, url)
+	return c.DoJSON(ctx, "GET", url, nil, v)
+}
+
+// PostJSON 发送POST请求（JSON body）并解析JSON响应
+//
+// 艹！reqBody会被编码成JSON，respBody为nil时丢弃响应体
+func (c *HTTPClient) PostJSON(ctx context.Context, url string, reqBody, respBody interface{}) error {
+	return c.DoJSON(ctx, "POST", url, reqBody, respBody)
+}
+
+// DoJSON 发送JSON请求并解析JSON响应
+//
+// 艹！reqBody为nil时不带请求体；respBody为nil时丢弃响应体
+func (c *HTTPClient) DoJSON(ctx context.Context, method, url string, reqBody, respBody interface{}) error {
+	header := http.Header{}
+	header.Set("Accept", "application/json")
+
+	var body io.Reader
+	if reqBody != nil {
+		data, err := json.Marshal(reqBody)
+		if err != nil {
+			return fmt.Errorf("failed to marshal request body: %w", err)
+		}
+		body = bytes.NewReader(data)
+		header.Set("Content-Type", "application/json")
+	}
+
+	resp, err := c.doRequest(ctx, method, url, body, header)
 	if err != nil {
 		return err
 	}
 	defer resp.Body.Close()
 
 	if resp.StatusCode >= 400 {
-		return fmt.Errorf("HTTP error: %d %s", resp.StatusCode, resp.Status)
+		return newHTTPError(resp)
 	}
 
-	body, err := io.ReadAll(resp.Body)
+	data, err := c.readBody(resp)
 	if err != nil {
-		return fmt.Errorf("failed to read response: %w", err)
+		return err
 	}
+	LogDebug("Response body: %s", data)
 
-	// 解析JSON（需要import "encoding/json"）
-	// 这里简化处理，实际使用时需要import json包
-	LogDebug("Response body: %s", string(body))
+	if respBody == nil || len(bytes.TrimSpace(data)) == 0 {
+		return nil
+	}
 
+	if err := json.Unmarshal(data, respBody); err != nil {
+		// 不是JSON类型的响应解析失败，把类型和片段带上方便排查
+		if ct := resp.Header.Get("Content-Type"); !isJSONContentType(ct) {
+			return fmt.Errorf("failed to decode JSON response (content type %q): %w: %s", ct, err, snippet(data))
+		}
+		return fmt.Errorf("failed to decode JSON response: %w", err)
+	}
 	return nil
 }
 
-// PostJSON 发送POST请求（JSON body）并解析JSON响应
-func (c *HTTPClient) PostJSON(ctx context.Context, url string, reqBody, respBody interface{}) error {
-	// TODO: 实现JSON编码和解码
-	// 简化版本，实际使用需要encoding/json
-	return fmt.Errorf("PostJSON not implemented yet")
+// readBody 按MaxBodySize读取响应体，gzip/deflate自动解压
+func (c *HTTPClient) readBody(resp *http.Response) ([]byte, error) {
+	return readResponseBody(resp, c.MaxBodySize)
+}
+
+// isJSONContentType 判断Content-Type是不是JSON
+func isJSONContentType(ct string) bool {
+	mediaType, _, err := mime.ParseMediaType(ct)
+	if err != nil {
+		return false
+	}
+	return mediaType == "application/json" || mediaType == "text/json" || strings.HasSuffix(mediaType, "+json")
+}
+
+// snippet 截取一段内容用于错误信息
+func snippet(data []byte) string {
+	if len(data) > errorSnippetSize {
+		data = data[:errorSnippetSize]
+	}
+	return strings.TrimSpace(string(data))
 }
 
 // MustGet GET请求，失败直接panic
@@ -165,17 +563,33 @@ func (c *HTTPClient) MustGet(ctx context.Context, url string) *http.Response {
 
 // Clone 克隆一个新的HTTPClient
 //
-// 艹！共享底层Client，但Header独立
+// 艹！共享连接池（Transport）、限流器、熔断器，但Header和Cookie独立
+// Cookie是复制过去的，克隆之后两边互不影响；不会复制命名会话
 func (c *HTTPClient) Clone() *HTTPClient {
 	headers := make(map[string]string)
 	for k, v := range c.Headers {
 		headers[k] = v
 	}
 
+	client := *c.Client
+	if jar, ok := client.Jar.(*CookieJar); ok {
+		client.Jar = jar.Clone()
+	}
+
 	return &HTTPClient{
-		Client:     c.Client, // 共享底层Client
-		Headers:    headers,
-		MaxRetries: c.MaxRetries,
-		RetryDelay: c.RetryDelay,
+		Client:            &client,
+		Headers:           headers,
+		MaxRetries:        c.MaxRetries,
+		RetryDelay:        c.RetryDelay,
+		MaxBodySize:       c.MaxBodySize,
+		MaxReplayBodySize: c.MaxReplayBodySize,
+		RetryPolicy:       c.RetryPolicy,
+		Breakers:          c.Breakers,
+		Limiter:           c.Limiter,
+		Robots:            c.Robots,
+		Proxies:           c.Proxies,
+		Rotator:           c.Rotator,
+		Middlewares:       append([]Middleware(nil), c.Middlewares...),
+		Cache:             c.Cache,
 	}
 }
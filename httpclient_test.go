@@ -0,0 +1,130 @@
+package crawlab
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+// echoRequest 测试服务器回显的请求信息
+type echoRequest struct {
+	Method      string `json:"method"`
+	ContentType string `json:"content_type"`
+	Accept      string `json:"accept"`
+	Body        string `json:"body"`
+}
+
+func TestHTTPClientJSON(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/echo":
+			body, _ := io.ReadAll(r.Body)
+			w.Header().Set("Content-Type", "application/json; charset=utf-8")
+			json.NewEncoder(w).Encode(echoRequest{r.Method, r.Header.Get("Content-Type"), r.Header.Get("Accept"), string(body)})
+		case "/missing":
+			w.Header().Set("X-Request-Id", "42")
+			w.WriteHeader(http.StatusNotFound)
+			w.Write([]byte(`{"error":"no such item"}`))
+		case "/html":
+			w.Header().Set("Content-Type", "text/html")
+			w.Write([]byte("<html>login required</html>"))
+		case "/empty":
+			w.WriteHeader(http.StatusNoContent)
+		case "/big":
+			w.Header().Set("Content-Type", "application/json")
+			w.Write([]byte(`"` + strings.Repeat("x", 300) + `"`))
+		}
+	}))
+	defer srv.Close()
+
+	tests := []struct {
+		name    string
+		method  string
+		path    string
+		reqBody interface{}
+		want    echoRequest
+		wantErr string // 错误信息里要有的内容
+		check   func(t *testing.T, err error)
+	}{
+		{
+			name: "get decodes the response", method: "GET", path: "/echo",
+			want: echoRequest{Method: "GET", Accept: "application/json"},
+		},
+		{
+			name: "post encodes the request", method: "POST", path: "/echo", reqBody: map[string]int{"page": 2},
+			want: echoRequest{Method: "POST", ContentType: "application/json", Accept: "application/json", Body: `{"page":2}`},
+		},
+		{
+			name: "error status is an HTTPError", method: "GET", path: "/missing",
+			wantErr: "404",
+			check: func(t *testing.T, err error) {
+				var httpErr *HTTPError
+				if !errors.As(err, &httpErr) {
+					t.Fatalf("err = %T, want *HTTPError", err)
+				}
+				if httpErr.StatusCode != 404 || httpErr.Method != "GET" || httpErr.Header.Get("X-Request-Id") != "42" ||
+					string(httpErr.Body) != `{"error":"no such item"}` {
+					t.Errorf("HTTPError = %+v", httpErr)
+				}
+			},
+		},
+		{
+			name: "non-JSON response names the content type", method: "GET", path: "/html",
+			wantErr: `content type "text/html"`,
+		},
+		{name: "empty response is not an error", method: "DELETE", path: "/empty"},
+		{
+			name: "response over MaxBodySize", method: "GET", path: "/big",
+			check: func(t *testing.T, err error) {
+				if !errors.Is(err, ErrBodyTooLarge) {
+					t.Errorf("err = %v, want ErrBodyTooLarge", err)
+				}
+			},
+		},
+		{
+			name: "unencodable request body", method: "POST", path: "/echo", reqBody: make(chan int),
+			wantErr: "failed to marshal request body",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			client := NewHTTPClient(5 * time.Second)
+			client.MaxBodySize = 256
+
+			var got echoRequest
+			err := client.DoJSON(context.Background(), tt.method, srv.URL+tt.path, tt.reqBody, &got)
+			if tt.check != nil {
+				tt.check(t, err)
+			}
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Errorf("err = %v, want it to contain %q", err, tt.wantErr)
+				}
+				return
+			}
+			if tt.check != nil {
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got != tt.want {
+				t.Errorf("server saw %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+
+	t.Run("nil response target discards the body", func(t *testing.T) {
+		client := NewHTTPClient(5 * time.Second)
+		if err := client.PostJSON(context.Background(), srv.URL+"/echo", map[string]string{"a": "b"}, nil); err != nil {
+			t.Errorf("PostJSON = %v", err)
+		}
+	})
+}
@@ -0,0 +1,209 @@
+package crawlab
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+	"syscall"
+	"time"
+)
+
+// RetryPolicy HTTP重试策略
+//
+// 艹！决定什么情况下重试、等多久：
+//   - 只重试RetryStatuses里的状态码和选中的错误类别
+//   - 默认只重试幂等方法（GET/HEAD/OPTIONS/TRACE/PUT/DELETE，或带Idempotency-Key头的请求）
+//   - 遵守Retry-After和限流头，等待时间取它和退避策略的较大值
+type RetryPolicy struct {
+	MaxRetries    int     // 最大重试次数
+	Backoff       Backoff // 退避策略（见retry.go）
+	RetryStatuses []int   // 需要重试的状态码
+
+	RetryOnTimeout         bool // 超时是否重试
+	RetryOnConnectionError bool // 连接失败、连接重置、DNS失败等是否重试
+	RetryNonIdempotent     bool // POST/PATCH等非幂等请求是否也重试
+
+	RespectRetryAfter bool          // 是否遵守Retry-After/限流头
+	MaxRetryAfter     time.Duration // 服务端要求等待超过这个时间就不再重试（0不限制）
+
+	// ShouldRetry 自定义判断，非nil时优先于上面的规则
+	// 返回值：retry是否重试，handled=false表示交给默认规则判断
+	ShouldRetry func(resp *http.Response, err error) (retry bool, handled bool)
+}
+
+// DefaultRetryPolicy 默认重试策略
+//
+// 艹！重试408/429/500/502/503/504、超时和连接错误，只重试幂等请求，遵守Retry-After（最多等2分钟）
+func DefaultRetryPolicy(maxRetries int, backoff Backoff) *RetryPolicy {
+	return &RetryPolicy{
+		MaxRetries:             maxRetries,
+		Backoff:                backoff,
+		RetryStatuses:          []int{408, 429, 500, 502, 503, 504},
+		RetryOnTimeout:         true,
+		RetryOnConnectionError: true,
+		RespectRetryAfter:      true,
+		MaxRetryAfter:          2 * time.Minute,
+	}
+}
+
+// IsRetryableStatus 状态码是否在重试列表里
+func (p *RetryPolicy) IsRetryableStatus(code int) bool {
+	for _, s := range p.RetryStatuses {
+		if s == code {
+			return true
+		}
+	}
+	return false
+}
+
+// IsIdempotent 判断请求是否幂等
+func IsIdempotent(req *http.Request) bool {
+	switch req.Method {
+	case "", http.MethodGet, http.MethodHead, http.MethodOptions, http.MethodTrace, http.MethodPut, http.MethodDelete:
+		return true
+	}
+	return req.Header.Get("Idempotency-Key") != "" || req.Header.Get("X-Idempotency-Key") != ""
+}
+
+// Decide 判断第attempt次尝试（从0开始）之后是否重试，以及等待多久
+//
+// 艹！resp和err只会有一个非nil
+func (p *RetryPolicy) Decide(req *http.Request, attempt int, resp *http.Response, err error) (bool, time.Duration) {
+	if attempt >= p.MaxRetries {
+		return false, 0
+	}
+	if req.Context().Err() != nil {
+		return false, 0
+	}
+	if !p.RetryNonIdempotent && !IsIdempotent(req) {
+		return false, 0
+	}
+
+	retry, handled := false, false
+	if p.ShouldRetry != nil {
+		retry, handled = p.ShouldRetry(resp, err)
+	}
+	if !handled {
+		if err != nil {
+			retry = p.retryableError(err)
+		} else {
+			retry = p.IsRetryableStatus(resp.StatusCode)
+		}
+	}
+	if !retry {
+		return false, 0
+	}
+
+	var delay time.Duration
+	if p.Backoff != nil {
+		delay = p.Backoff(attempt)
+	}
+
+	if p.RespectRetryAfter && resp != nil {
+		if wait, ok := RetryAfter(resp); ok {
+			if p.MaxRetryAfter > 0 && wait > p.MaxRetryAfter {
+				LogWarn("Server asked to wait %v (limit %v), giving up", wait, p.MaxRetryAfter)
+				return false, 0
+			}
+			if wait > delay {
+				delay = wait
+			}
+		}
+	}
+
+	return true, delay
+}
+
+// retryableError 按错误类别判断是否重试
+func (p *RetryPolicy) retryableError(err error) bool {
+	if errors.Is(err, context.Canceled) {
+		return false
+	}
+	if isTimeoutError(err) {
+		return p.RetryOnTimeout
+	}
+	if IsConnectionError(err) {
+		return p.RetryOnConnectionError
+	}
+	// 证书错误之类的重试也没用
+	return false
+}
+
+// isTimeoutError 判断是否超时错误
+func isTimeoutError(err error) bool {
+	if errors.Is(err, context.DeadlineExceeded) {
+		return true
+	}
+	var netErr net.Error
+	return errors.As(err, &netErr) && netErr.Timeout()
+}
+
+// IsConnectionError 判断是否连接类错误（拒绝、重置、DNS、连接被提前关闭）
+func IsConnectionError(err error) bool {
+	var dnsErr *net.DNSError
+	var opErr *net.OpError
+	return errors.As(err, &dnsErr) ||
+		errors.As(err, &opErr) ||
+		errors.Is(err, syscall.ECONNREFUSED) ||
+		errors.Is(err, syscall.ECONNRESET) ||
+		errors.Is(err, io.ErrUnexpectedEOF) ||
+		errors.Is(err, io.EOF)
+}
+
+// RetryAfter 从响应头解析服务端要求的等待时间
+//
+// 艹！支持：
+//   - Retry-After: 秒数 或 HTTP日期
+//   - RateLimit-Reset / X-RateLimit-Reset: 秒数，或Unix时间戳（仅在剩余额度为0时生效）
+func RetryAfter(resp *http.Response) (time.Duration, bool) {
+	if v := strings.TrimSpace(resp.Header.Get("Retry-After")); v != "" {
+		if secs, err := strconv.Atoi(v); err == nil {
+			if secs < 0 {
+				secs = 0
+			}
+			return time.Duration(secs) * time.Second, true
+		}
+		if t, err := http.ParseTime(v); err == nil {
+			d := time.Until(t)
+			if d < 0 {
+				d = 0
+			}
+			return d, true
+		}
+	}
+
+	// 限流头：还有剩余额度就不用等
+	remaining := resp.Header.Get("RateLimit-Remaining")
+	if remaining == "" {
+		remaining = resp.Header.Get("X-RateLimit-Remaining")
+	}
+	if remaining != "" && strings.TrimSpace(remaining) != "0" {
+		return 0, false
+	}
+
+	reset := resp.Header.Get("RateLimit-Reset")
+	if reset == "" {
+		reset = resp.Header.Get("X-RateLimit-Reset")
+	}
+	if reset == "" {
+		return 0, false
+	}
+	n, err := strconv.ParseInt(strings.TrimSpace(reset), 10, 64)
+	if err != nil || n < 0 {
+		return 0, false
+	}
+
+	// 大于一年的秒数当作Unix时间戳
+	if n > 365*24*3600 {
+		d := time.Until(time.Unix(n, 0))
+		if d < 0 {
+			d = 0
+		}
+		return d, true
+	}
+	return time.Duration(n) * time.Second, true
+}
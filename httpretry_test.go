@@ -0,0 +1,159 @@
+package crawlab
+
+import (
+	"context"
+	"errors"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestRetryPolicyDecide(t *testing.T) {
+	status := func(code int, kv ...string) *http.Response {
+		resp := &http.Response{StatusCode: code, Header: http.Header{}}
+		for i := 0; i+1 < len(kv); i += 2 {
+			resp.Header.Set(kv[i], kv[i+1])
+		}
+		return resp
+	}
+	connRefused := &net.OpError{Op: "dial", Err: errors.New("connection refused")}
+
+	tests := []struct {
+		name      string
+		method    string
+		header    string // 请求的Idempotency-Key
+		policy    func(p *RetryPolicy)
+		attempt   int
+		resp      *http.Response
+		err       error
+		wantRetry bool
+		wantDelay time.Duration
+	}{
+		{"503 is retried", "GET", "", nil, 0, status(503), nil, true, time.Second},
+		{"404 is not retried", "GET", "", nil, 0, status(404), nil, false, 0},
+		{"out of retries", "GET", "", nil, 3, status(503), nil, false, 0},
+		{"post is not retried", "POST", "", nil, 0, status(503), nil, false, 0},
+		{"post with idempotency key", "POST", "abc", nil, 0, status(503), nil, true, time.Second},
+		{"post when opted in", "POST", "", func(p *RetryPolicy) { p.RetryNonIdempotent = true }, 0, status(503), nil, true, time.Second},
+		{"connection error", "GET", "", nil, 0, nil, connRefused, true, time.Second},
+		{"connection error when disabled", "GET", "", func(p *RetryPolicy) { p.RetryOnConnectionError = false }, 0, nil, connRefused, false, 0},
+		{"timeout", "GET", "", nil, 0, nil, context.DeadlineExceeded, true, time.Second},
+		{"cancelled", "GET", "", nil, 0, nil, context.Canceled, false, 0},
+		{"retry-after longer than backoff", "GET", "", nil, 0, status(429, "Retry-After", "5"), nil, true, 5 * time.Second},
+		{"retry-after shorter than backoff", "GET", "", nil, 0, status(429, "Retry-After", "0"), nil, true, time.Second},
+		{"retry-after over the limit", "GET", "", nil, 0, status(429, "Retry-After", "600"), nil, false, 0},
+		{"retry-after ignored", "GET", "", func(p *RetryPolicy) { p.RespectRetryAfter = false }, 0, status(429, "Retry-After", "600"), nil, true, time.Second},
+		{"rate limit reset", "GET", "", nil, 0, status(429, "X-RateLimit-Remaining", "0", "X-RateLimit-Reset", "3"), nil, true, 3 * time.Second},
+		{"custom rule wins", "GET", "", func(p *RetryPolicy) {
+			p.ShouldRetry = func(resp *http.Response, err error) (bool, bool) { return resp.StatusCode == 404, true }
+		}, 0, status(404), nil, true, time.Second},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			p := DefaultRetryPolicy(3, ConstantBackoff(time.Second))
+			if tt.policy != nil {
+				tt.policy(p)
+			}
+			req, _ := http.NewRequest(tt.method, "http://a.com/", nil)
+			if tt.header != "" {
+				req.Header.Set("Idempotency-Key", tt.header)
+			}
+
+			retry, delay := p.Decide(req, tt.attempt, tt.resp, tt.err)
+			if retry != tt.wantRetry || delay != tt.wantDelay {
+				t.Errorf("Decide = %v, %v, want %v, %v", retry, delay, tt.wantRetry, tt.wantDelay)
+			}
+		})
+	}
+}
+
+func TestRetryAfter(t *testing.T) {
+	future := time.Now().Add(time.Hour)
+
+	tests := []struct {
+		name   string
+		header map[string]string
+		want   time.Duration
+		wantOK bool
+	}{
+		{"seconds", map[string]string{"Retry-After": "7"}, 7 * time.Second, true},
+		{"negative seconds", map[string]string{"Retry-After": "-3"}, 0, true},
+		{"http date in the past", map[string]string{"Retry-After": "Mon, 02 Jan 2006 15:04:05 GMT"}, 0, true},
+		{"quota left", map[string]string{"RateLimit-Remaining": "5", "RateLimit-Reset": "10"}, 0, false},
+		{"reset in seconds", map[string]string{"RateLimit-Remaining": "0", "RateLimit-Reset": "10"}, 10 * time.Second, true},
+		{"reset without remaining", map[string]string{"X-RateLimit-Reset": "2"}, 2 * time.Second, true},
+		{"garbage", map[string]string{"Retry-After": "soon"}, 0, false},
+		{"nothing", nil, 0, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			resp := &http.Response{Header: http.Header{}}
+			for k, v := range tt.header {
+				resp.Header.Set(k, v)
+			}
+			got, ok := RetryAfter(resp)
+			if got != tt.want || ok != tt.wantOK {
+				t.Errorf("RetryAfter = %v, %v, want %v, %v", got, ok, tt.want, tt.wantOK)
+			}
+		})
+	}
+
+	t.Run("unix timestamp", func(t *testing.T) {
+		resp := &http.Response{Header: http.Header{}}
+		resp.Header.Set("X-RateLimit-Remaining", "0")
+		resp.Header.Set("X-RateLimit-Reset", strconv.FormatInt(future.Unix(), 10))
+		got, ok := RetryAfter(resp)
+		if !ok || got < 59*time.Minute || got > time.Hour {
+			t.Errorf("RetryAfter = %v, %v, want about an hour", got, ok)
+		}
+	})
+}
+
+func TestHTTPClientRetryPolicy(t *testing.T) {
+	tests := []struct {
+		name      string
+		method    string
+		status    int
+		wantCalls int64
+		wantErr   bool
+	}{
+		{"get retries 429", "GET", 429, 3, true},
+		{"post is sent once", "POST", 503, 1, true},
+		{"404 is returned as is", "GET", 404, 1, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var calls int64
+			srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				atomic.AddInt64(&calls, 1)
+				w.Header().Set("Retry-After", "0")
+				w.WriteHeader(tt.status)
+			}))
+			defer srv.Close()
+
+			client := NewHTTPClient(5 * time.Second)
+			client.SetRetryPolicy(DefaultRetryPolicy(2, ConstantBackoff(time.Millisecond)))
+
+			resp, err := client.DoRequest(context.Background(), tt.method, srv.URL, nil)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("err = %v, wantErr %v", err, tt.wantErr)
+			}
+			var httpErr *HTTPError
+			if err == nil {
+				resp.Body.Close()
+			} else if !errors.As(err, &httpErr) || httpErr.StatusCode != tt.status {
+				t.Errorf("err = %v, want *HTTPError with status %d", err, tt.status)
+			}
+			if calls != tt.wantCalls {
+				t.Errorf("server got %d calls, want %d", calls, tt.wantCalls)
+			}
+		})
+	}
+}
@@ -0,0 +1,369 @@
+package crawlab
+
+import (
+	"bytes"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"text/tabwriter"
+)
+
+const (
+	// EnvLocalMode 本地模式开关（true/false），不设置时没有CRAWLAB_TASK_ID就自动开启
+	EnvLocalMode = "CRAWLAB_LOCAL_MODE"
+	// EnvLocalFormat 本地模式输出格式：jsonl（默认）、csv、table
+	EnvLocalFormat = "CRAWLAB_LOCAL_FORMAT"
+	// EnvLocalOutput 本地模式输出目录（默认./output）
+	EnvLocalOutput = "CRAWLAB_LOCAL_OUTPUT"
+)
+
+// IsLocalMode 判断是否运行在本地开发模式
+//
+// 艹！优先看CRAWLAB_LOCAL_MODE，没设置就看是不是在Crawlab里跑（有没有任务ID）
+func IsLocalMode() bool {
+	if os.Getenv(EnvLocalMode) != "" {
+		return new(Config).GetEnvBool(EnvLocalMode, false)
+	}
+	return GetTaskID() == ""
+}
+
+// LocalTransport 本地模式传输通道
+//
+// 艹！不往stdout刷IPC JSON，数据写到输出目录：
+//   - items.jsonl / items.csv / items.txt（table格式）保存数据
+//   - messages.jsonl 保存非data类型的IPC消息
+//
+// 文件在第一次写入时才创建（覆盖上次运行的），Close之后再写会接着追加
+type LocalTransport struct {
+	Dir    string // 输出目录
+	Format string // jsonl、csv、table
+
+	mu        sync.Mutex
+	itemsFile *os.File
+	csvWriter *csv.Writer
+	csvHeader []string
+	csvDrop   map[string]bool          // 不在CSV表头里、已经警告过的字段
+	created   map[string]bool          // 本次运行已经创建过的文件
+	rows      []map[string]interface{} // table格式需要全部数据才能对齐
+	msgFile   *os.File
+	items     int64
+	messages  int64
+}
+
+// NewLocalTransport 创建本地模式传输通道
+func NewLocalTransport(dir, format string) *LocalTransport {
+	format = strings.ToLower(strings.TrimSpace(format))
+	switch format {
+	case "jsonl", "csv", "table":
+	default:
+		if format != "" {
+			LogWarn("Unknown local output format %s, using jsonl", format)
+		}
+		format = "jsonl"
+	}
+	if dir == "" {
+		dir = "output"
+	}
+	return &LocalTransport{Dir: dir, Format: format}
+}
+
+// newLocalTransportFromEnv 按环境变量创建本地模式传输通道
+func newLocalTransportFromEnv() *LocalTransport {
+	return NewLocalTransport(GetEnv(EnvLocalOutput, "output"), GetEnv(EnvLocalFormat, "jsonl"))
+}
+
+// ItemsPath 返回数据文件路径
+func (t *LocalTransport) ItemsPath() string {
+	ext := t.Format
+	if ext == "table" {
+		ext = "txt"
+	}
+	return filepath.Join(t.Dir, "items."+ext)
+}
+
+// Send 写入一条IPC消息
+//
+// 艹！data消息的payload是数组时拆成多条分别写
+func (t *LocalTransport) Send(msg IPCMessage) error {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	if msg.Type != "data" {
+		return t.writeMessage(msg)
+	}
+
+	// 统一转成通用结构，BatchWriter发来的json.RawMessage也能处理
+	// 数字保留成json.Number，超过2^53的int64 ID不会被float64弄坏
+	data, err := json.Marshal(msg.Payload)
+	if err != nil {
+		return fmt.Errorf("failed to marshal payload: %w", err)
+	}
+	dec := json.NewDecoder(bytes.NewReader(data))
+	dec.UseNumber()
+	var payload interface{}
+	if err := dec.Decode(&payload); err != nil {
+		return fmt.Errorf("failed to decode payload: %w", err)
+	}
+
+	items, ok := payload.([]interface{})
+	if !ok {
+		items = []interface{}{payload}
+	}
+	for _, item := range items {
+		if err := t.writeItem(item); err != nil {
+			return err
+		}
+		t.items++
+	}
+	return nil
+}
+
+// writeItem 按格式写一条数据，调用方必须持有锁
+func (t *LocalTransport) writeItem(item interface{}) error {
+	if t.Format == "table" {
+		t.rows = append(t.rows, toRow(item))
+		return nil
+	}
+
+	if t.itemsFile == nil {
+		f, err := t.open(t.ItemsPath())
+		if err != nil {
+			return err
+		}
+		t.itemsFile = f
+		if t.Format == "csv" {
+			t.csvWriter = csv.NewWriter(f)
+		}
+	}
+
+	if t.Format == "jsonl" {
+		line, err := json.Marshal(item)
+		if err != nil {
+			return fmt.Errorf("failed to marshal item: %w", err)
+		}
+		_, err = t.itemsFile.Write(append(line, '\n'))
+		return err
+	}
+
+	// CSV表头以第一条数据为准，后面多出来的字段写不进去，每个字段警告一次
+	row := toRow(item)
+	if t.csvHeader == nil {
+		t.csvHeader = sortedKeys(row)
+		if err := t.csvWriter.Write(t.csvHeader); err != nil {
+			return err
+		}
+	}
+	t.warnDroppedColumns(row)
+	record := make([]string, len(t.csvHeader))
+	for i, key := range t.csvHeader {
+		record[i] = cellString(row[key])
+	}
+	if err := t.csvWriter.Write(record); err != nil {
+		return err
+	}
+	t.csvWriter.Flush()
+	return t.csvWriter.Error()
+}
+
+// warnDroppedColumns 警告不在CSV表头里的字段，调用方必须持有锁
+func (t *LocalTransport) warnDroppedColumns(row map[string]interface{}) {
+	for key := range row {
+		if t.csvDrop[key] || containsString(t.csvHeader, key) {
+			continue
+		}
+		if t.csvDrop == nil {
+			t.csvDrop = make(map[string]bool)
+		}
+		t.csvDrop[key] = true
+		LogWarn("CSV column %q is not in the header (taken from the first item), dropping it; use jsonl to keep all fields", key)
+	}
+}
+
+// writeMessage 写入非data类型的消息，调用方必须持有锁
+func (t *LocalTransport) writeMessage(msg IPCMessage) error {
+	if t.msgFile == nil {
+		f, err := t.open(filepath.Join(t.Dir, "messages.jsonl"))
+		if err != nil {
+			return err
+		}
+		t.msgFile = f
+	}
+
+	line, err := json.Marshal(msg)
+	if err != nil {
+		return fmt.Errorf("failed to marshal IPC message: %w", err)
+	}
+	if _, err := t.msgFile.Write(append(line, '\n')); err != nil {
+		return err
+	}
+	t.messages++
+	return nil
+}
+
+// open 打开jsonl/csv输出文件：本次运行第一次打开时覆盖旧文件，之后追加
+func (t *LocalTransport) open(path string) (*os.File, error) {
+	if !t.created[path] {
+		f, err := t.create(path)
+		if err != nil {
+			return nil, err
+		}
+		if t.created == nil {
+			t.created = make(map[string]bool)
+		}
+		t.created[path] = true
+		return f, nil
+	}
+	f, err := os.OpenFile(path, os.O_WRONLY|os.O_APPEND, 0644)
+	if err != nil {
+		return nil, fmt.Errorf("failed to reopen output file %s: %w", path, err)
+	}
+	return f, nil
+}
+
+// create 创建输出文件（覆盖旧文件）
+func (t *LocalTransport) create(path string) (*os.File, error) {
+	if err := os.MkdirAll(t.Dir, 0755); err != nil {
+		return nil, fmt.Errorf("failed to create output dir %s: %w", t.Dir, err)
+	}
+	f, err := os.Create(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create output file %s: %w", path, err)
+	}
+	return f, nil
+}
+
+// Flush 把table格式的数据写到磁盘
+//
+// 艹！jsonl和csv是实时写入的，只有table需要这一步
+func (t *LocalTransport) Flush() error {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return t.flushTable()
+}
+
+// flushTable 重写整张表，调用方必须持有锁
+func (t *LocalTransport) flushTable() error {
+	if t.Format != "table" || len(t.rows) == 0 {
+		return nil
+	}
+
+	f, err := t.create(t.ItemsPath())
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	// 表头取所有数据字段的并集
+	keySet := make(map[string]interface{})
+	for _, row := range t.rows {
+		for k := range row {
+			keySet[k] = nil
+		}
+	}
+	header := sortedKeys(keySet)
+
+	tw := tabwriter.NewWriter(f, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(tw, strings.Join(header, "\t"))
+	for _, row := range t.rows {
+		cells := make([]string, len(header))
+		for i, key := range header {
+			cells[i] = tableCellReplacer.Replace(cellString(row[key]))
+		}
+		fmt.Fprintln(tw, strings.Join(cells, "\t"))
+	}
+	return tw.Flush()
+}
+
+// Close 写完剩余数据并关闭文件
+func (t *LocalTransport) Close() error {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	err := t.flushTable()
+	if t.itemsFile != nil {
+		if cerr := t.itemsFile.Close(); err == nil {
+			err = cerr
+		}
+		t.itemsFile = nil
+		t.csvWriter = nil
+	}
+	if t.msgFile != nil {
+		if cerr := t.msgFile.Close(); err == nil {
+			err = cerr
+		}
+		t.msgFile = nil
+	}
+	return err
+}
+
+// PrintSummary 打印本地模式输出汇总
+func (t *LocalTransport) PrintSummary() {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	LogInfo("========== 本地模式 ==========")
+	LogInfo("数据条数: %d", t.items)
+	if t.items > 0 {
+		LogInfo("数据文件: %s", t.ItemsPath())
+	}
+	if t.messages > 0 {
+		LogInfo("其他消息: %d 条 -> %s", t.messages, filepath.Join(t.Dir, "messages.jsonl"))
+	}
+	LogInfo("=============================")
+}
+
+// tableCellReplacer 制表符和换行会把表格撑乱，替换成空格
+var tableCellReplacer = strings.NewReplacer("\t", " ", "\n", " ", "\r", "")
+
+// toRow 把数据转成字段map，非对象数据放到value列
+func toRow(item interface{}) map[string]interface{} {
+	if m, ok := item.(map[string]interface{}); ok {
+		return m
+	}
+	return map[string]interface{}{"value": item}
+}
+
+// containsString 切片里有没有s
+func containsString(list []string, s string) bool {
+	for _, v := range list {
+		if v == s {
+			return true
+		}
+	}
+	return false
+}
+
+// sortedKeys 返回排好序的key列表
+func sortedKeys(m map[string]interface{}) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// cellString 把单元格的值转成字符串，嵌套结构用JSON表示
+func cellString(v interface{}) string {
+	switch val := v.(type) {
+	case nil:
+		return ""
+	case string:
+		return val
+	case json.Number:
+		return val.String()
+	case float64:
+		return strconv.FormatFloat(val, 'f', -1, 64)
+	case map[string]interface{}, []interface{}:
+		data, _ := json.Marshal(val)
+		return string(data)
+	default:
+		return fmt.Sprint(val)
+	}
+}
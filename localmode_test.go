@@ -0,0 +1,48 @@
+package crawlab
+
+import (
+	"encoding/json"
+	"os"
+	"strings"
+	"testing"
+)
+
+func TestLocalTransportBigNumbers(t *testing.T) {
+	const id = int64(1<<62 + 1) // float64表示不了
+
+	type item struct {
+		ID    int64   `json:"id"`
+		Price float64 `json:"price"`
+	}
+
+	tests := []struct {
+		format  string
+		payload interface{}
+		want    string
+	}{
+		{"jsonl", item{ID: id, Price: 9.5}, `{"id":4611686018427387905,"price":9.5}` + "\n"},
+		{"jsonl", []item{{ID: id}, {ID: 2}}, `{"id":4611686018427387905,"price":0}` + "\n" + `{"id":2,"price":0}` + "\n"},
+		{"jsonl", json.RawMessage(`[{"id":4611686018427387905}]`), `{"id":4611686018427387905}` + "\n"},
+		{"csv", []item{{ID: id, Price: 1e-7}}, "id,price\n4611686018427387905,1e-7\n"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.format, func(t *testing.T) {
+			lt := NewLocalTransport(t.TempDir(), tt.format)
+			if err := lt.Send(IPCMessage{Type: "data", Payload: tt.payload}); err != nil {
+				t.Fatal(err)
+			}
+			if err := lt.Close(); err != nil {
+				t.Fatal(err)
+			}
+
+			data, err := os.ReadFile(lt.ItemsPath())
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got := strings.ReplaceAll(string(data), "\r\n", "\n"); got != tt.want {
+				t.Errorf("output = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,365 @@
+package crawlab
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	// EnvLogLevel 最低日志级别：debug、info（默认）、warn、error
+	EnvLogLevel = "CRAWLAB_LOG_LEVEL"
+	// EnvLogFormat 日志格式：text（默认）、json
+	EnvLogFormat = "CRAWLAB_LOG_FORMAT"
+)
+
+// Level 日志级别
+type Level int
+
+const (
+	LevelDebug Level = iota // 调试
+	LevelInfo               // 信息
+	LevelWarn               // 警告
+	LevelError              // 错误
+)
+
+// String 返回级别名称
+func (l Level) String() string {
+	switch l {
+	case LevelDebug:
+		return "DEBUG"
+	case LevelInfo:
+		return "INFO"
+	case LevelWarn:
+		return "WARN"
+	case LevelError:
+		return "ERROR"
+	default:
+		return "LEVEL(" + strconv.Itoa(int(l)) + ")"
+	}
+}
+
+// ParseLevel 解析日志级别，大小写不敏感
+func ParseLevel(s string) (Level, error) {
+	switch strings.ToLower(strings.TrimSpace(s)) {
+	case "debug":
+		return LevelDebug, nil
+	case "info", "":
+		return LevelInfo, nil
+	case "warn", "warning":
+		return LevelWarn, nil
+	case "error":
+		return LevelError, nil
+	}
+	return LevelInfo, fmt.Errorf("unknown log level: %s", s)
+}
+
+// loggerOutput 同一个输出目标共享一把锁，With出来的子Logger写日志也不会交错
+type loggerOutput struct {
+	mu sync.Mutex
+	w  io.Writer
+}
+
+// Logger 结构化分级日志
+//
+// 艹！支持最低级别过滤、key/value字段、text和json两种格式
+// 输出到stderr，会被Runner捕获为任务日志
+type Logger struct {
+	out    *loggerOutput
+	level  Level
+	json   bool
+	fields []interface{} // With附加的key/value
+}
+
+// NewLogger 创建日志器
+//
+// 艹！format为json时每行输出一个JSON对象，其他值都按text处理
+func NewLogger(w io.Writer, level Level, format string) *Logger {
+	return &Logger{
+		out:   &loggerOutput{w: w},
+		level: level,
+		json:  strings.EqualFold(format, "json"),
+	}
+}
+
+// NewLoggerFromEnv 按环境变量创建输出到stderr的日志器
+func NewLoggerFromEnv() *Logger {
+	level, err := ParseLevel(os.Getenv(EnvLogLevel))
+	l := NewLogger(os.Stderr, level, os.Getenv(EnvLogFormat))
+	if err != nil {
+		l.Warn("Invalid log level, using INFO", "value", os.Getenv(EnvLogLevel))
+	}
+	return l
+}
+
+// With 返回附加了字段的子Logger
+//
+// 用法：logger.With("url", u).Info("fetched", "status", 200)
+func (l *Logger) With(kv ...interface{}) *Logger {
+	fields := make([]interface{}, 0, len(l.fields)+len(kv))
+	fields = append(fields, l.fields...)
+	fields = append(fields, kv...)
+
+	return &Logger{out: l.out, level: l.level, json: l.json, fields: fields}
+}
+
+// Level 返回最低日志级别
+func (l *Logger) Level() Level {
+	return l.level
+}
+
+// Enabled 判断该级别的日志会不会输出
+func (l *Logger) Enabled(level Level) bool {
+	return level >= l.level
+}
+
+// Debug 输出DEBUG日志
+func (l *Logger) Debug(msg string, kv ...interface{}) {
+	l.log(LevelDebug, true, msg, kv)
+}
+
+// Info 输出INFO日志
+func (l *Logger) Info(msg string, kv ...interface{}) {
+	l.log(LevelInfo, true, msg, kv)
+}
+
+// Warn 输出WARN日志
+func (l *Logger) Warn(msg string, kv ...interface{}) {
+	l.log(LevelWarn, true, msg, kv)
+}
+
+// Error 输出ERROR日志
+func (l *Logger) Error(msg string, kv ...interface{}) {
+	l.log(LevelError, true, msg, kv)
+}
+
+// Logf 按printf格式输出日志
+//
+// 艹！给LogInfo这些老函数用的
+func (l *Logger) Logf(level Level, format string, args ...interface{}) {
+	if !l.Enabled(level) {
+		return
+	}
+	l.log(level, true, fmt.Sprintf(format, args...), nil)
+}
+
+// log 写一行日志
+//
+// 艹！tagged=false时text格式不带级别标签（兼容老的Log函数）
+func (l *Logger) log(level Level, tagged bool, msg string, kv []interface{}) {
+	if !l.Enabled(level) {
+		return
+	}
+
+	now := time.Now()
+	fields := l.fields
+	if len(kv) > 0 {
+		fields = append(append([]interface{}{}, l.fields...), kv...)
+	}
+
+	var line []byte
+	if l.json {
+		line = l.formatJSON(now, level, msg, fields)
+	} else {
+		line = l.formatText(now, level, tagged, msg, fields)
+	}
+
+	l.out.mu.Lock()
+	defer l.out.mu.Unlock()
+	l.out.w.Write(line)
+}
+
+// formatText text格式：时间 [Crawlab] [级别] 消息 key=value...
+func (l *Logger) formatText(now time.Time, level Level, tagged bool, msg string, fields []interface{}) []byte {
+	var b strings.Builder
+	b.WriteString(now.Format("2006-01-02 15:04:05.000"))
+	b.WriteString(" [Crawlab] ")
+	if tagged {
+		b.WriteString("[" + level.String() + "] ")
+	}
+	b.WriteString(msg)
+
+	for i := 0; i < len(fields); i += 2 {
+		key, val := fieldPair(fields, i)
+		b.WriteByte(' ')
+		b.WriteString(key)
+		b.WriteByte('=')
+		b.WriteString(textValue(val))
+	}
+	b.WriteByte('\n')
+	return []byte(b.String())
+}
+
+// formatJSON json格式：每行一个对象
+func (l *Logger) formatJSON(now time.Time, level Level, msg string, fields []interface{}) []byte {
+	entry := make(map[string]interface{}, len(fields)/2+3)
+	for i := 0; i < len(fields); i += 2 {
+		key, val := fieldPair(fields, i)
+		if err, ok := val.(error); ok {
+			val = err.Error()
+		}
+		entry[key] = val
+	}
+	entry["time"] = now.Format(time.RFC3339Nano)
+	entry["level"] = level.String()
+	entry["msg"] = msg
+
+	data, err := json.Marshal(entry)
+	if err != nil {
+		data, _ = json.Marshal(map[string]string{
+			"time":  now.Format(time.RFC3339Nano),
+			"level": level.String(),
+			"msg":   msg,
+			"error": "failed to marshal log fields: " + err.Error(),
+		})
+	}
+	return append(data, '\n')
+}
+
+// fieldPair 取第i个key/value，key不是字符串或缺value时兜底
+func fieldPair(fields []interface{}, i int) (string, interface{}) {
+	key, ok := fields[i].(string)
+	if !ok {
+		key = fmt.Sprint(fields[i])
+	}
+	if i+1 >= len(fields) {
+		return "!BADKEY", key
+	}
+	return key, fields[i+1]
+}
+
+// textValue 带空格或引号的值加引号
+func textValue(v interface{}) string {
+	s := fmt.Sprint(v)
+	if s == "" || strings.ContainsAny(s, " \t\n\"=") {
+		return strconv.Quote(s)
+	}
+	return s
+}
+
+var (
+	loggerMu      sync.RWMutex
+	defaultLogger = NewLoggerFromEnv()
+)
+
+// SetLogger 替换全局日志器，Log*函数都会走它
+//
+// 艹！返回旧的日志器，传nil恢复为按环境变量创建的默认日志器
+func SetLogger(l *Logger) *Logger {
+	if l == nil {
+		l = NewLoggerFromEnv()
+	}
+
+	loggerMu.Lock()
+	defer loggerMu.Unlock()
+
+	old := defaultLogger
+	defaultLogger = l
+	return old
+}
+
+// GetLogger 获取全局日志器
+func GetLogger() *Logger {
+	loggerMu.RLock()
+	defer loggerMu.RUnlock()
+	return defaultLogger
+}
+
+// slogHandler 把slog日志转到Logger
+type slogHandler struct {
+	logger *Logger
+	group  string
+}
+
+// SlogHandler 返回写入该Logger的slog.Handler
+//
+// 艹！第三方库用log/slog的话，slog.SetDefault(slog.New(logger.SlogHandler()))一下就统一了
+func (l *Logger) SlogHandler() slog.Handler {
+	return &slogHandler{logger: l}
+}
+
+// NewSlogLogger 返回写入全局日志器的*slog.Logger
+func NewSlogLogger() *slog.Logger {
+	return slog.New(GetLogger().SlogHandler())
+}
+
+// Enabled 实现slog.Handler
+func (h *slogHandler) Enabled(_ context.Context, level slog.Level) bool {
+	return h.logger.Enabled(fromSlogLevel(level))
+}
+
+// Handle 实现slog.Handler
+func (h *slogHandler) Handle(_ context.Context, r slog.Record) error {
+	kv := make([]interface{}, 0, r.NumAttrs()*2)
+	r.Attrs(func(a slog.Attr) bool {
+		kv = appendAttr(kv, h.group, a)
+		return true
+	})
+	h.logger.log(fromSlogLevel(r.Level), true, r.Message, kv)
+	return nil
+}
+
+// WithAttrs 实现slog.Handler
+func (h *slogHandler) WithAttrs(attrs []slog.Attr) slog.Handler {
+	kv := make([]interface{}, 0, len(attrs)*2)
+	for _, a := range attrs {
+		kv = appendAttr(kv, h.group, a)
+	}
+	return &slogHandler{logger: h.logger.With(kv...), group: h.group}
+}
+
+// WithGroup 实现slog.Handler，分组用点号拼到key前面
+func (h *slogHandler) WithGroup(name string) slog.Handler {
+	if name == "" {
+		return h
+	}
+	group := name
+	if h.group != "" {
+		group = h.group + "." + name
+	}
+	return &slogHandler{logger: h.logger, group: group}
+}
+
+// appendAttr 展开slog属性（包括嵌套分组）
+func appendAttr(kv []interface{}, group string, a slog.Attr) []interface{} {
+	a.Value = a.Value.Resolve()
+	if a.Equal(slog.Attr{}) {
+		return kv
+	}
+
+	key := a.Key
+	if group != "" && key != "" {
+		key = group + "." + key
+	} else if key == "" {
+		key = group
+	}
+
+	if a.Value.Kind() == slog.KindGroup {
+		for _, ga := range a.Value.Group() {
+			kv = appendAttr(kv, key, ga)
+		}
+		return kv
+	}
+	return append(kv, key, a.Value.Any())
+}
+
+// fromSlogLevel slog级别转换
+func fromSlogLevel(level slog.Level) Level {
+	switch {
+	case level >= slog.LevelError:
+		return LevelError
+	case level >= slog.LevelWarn:
+		return LevelWarn
+	case level >= slog.LevelInfo:
+		return LevelInfo
+	default:
+		return LevelDebug
+	}
+}
@@ -0,0 +1,166 @@
+package crawlab
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"log/slog"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestParseLevel(t *testing.T) {
+	tests := []struct {
+		in      string
+		want    Level
+		wantErr bool
+	}{
+		{"debug", LevelDebug, false},
+		{" INFO ", LevelInfo, false},
+		{"", LevelInfo, false},
+		{"warning", LevelWarn, false},
+		{"Error", LevelError, false},
+		{"verbose", LevelInfo, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.in, func(t *testing.T) {
+			got, err := ParseLevel(tt.in)
+			if got != tt.want || (err != nil) != tt.wantErr {
+				t.Errorf("ParseLevel(%q) = %v, %v, want %v, wantErr %v", tt.in, got, err, tt.want, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestLoggerLevels(t *testing.T) {
+	tests := []struct {
+		level Level
+		want  []string
+	}{
+		{LevelDebug, []string{"DEBUG", "INFO", "WARN", "ERROR"}},
+		{LevelInfo, []string{"INFO", "WARN", "ERROR"}},
+		{LevelWarn, []string{"WARN", "ERROR"}},
+		{LevelError, []string{"ERROR"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.level.String(), func(t *testing.T) {
+			var buf bytes.Buffer
+			l := NewLogger(&buf, tt.level, "json")
+			l.Debug("m")
+			l.Info("m")
+			l.Warn("m")
+			l.Error("m")
+			l.Logf(LevelDebug, "m %d", 1)
+
+			var got []string
+			dec := json.NewDecoder(&buf)
+			for dec.More() {
+				var entry struct{ Level string }
+				if err := dec.Decode(&entry); err != nil {
+					t.Fatal(err)
+				}
+				got = append(got, entry.Level)
+			}
+			// Logf的DEBUG只有在debug级别才会多出一行
+			want := tt.want
+			if tt.level == LevelDebug {
+				want = append(want, "DEBUG")
+			}
+			if !reflect.DeepEqual(got, want) {
+				t.Errorf("levels = %v, want %v", got, want)
+			}
+		})
+	}
+}
+
+func TestLoggerFormat(t *testing.T) {
+	tests := []struct {
+		name     string
+		format   string
+		log      func(l *Logger)
+		wantText string                 // text格式去掉时间戳之后的内容
+		wantJSON map[string]interface{} // json格式除time以外的字段
+	}{
+		{
+			name:     "text with fields",
+			format:   "text",
+			log:      func(l *Logger) { l.With("url", "http://a").Info("fetched", "status", 200) },
+			wantText: "[Crawlab] [INFO] fetched url=http://a status=200",
+		},
+		{
+			name:     "text quotes values with spaces",
+			format:   "text",
+			log:      func(l *Logger) { l.Warn("slow", "reason", "too many", "empty", "") },
+			wantText: `[Crawlab] [WARN] slow reason="too many" empty=""`,
+		},
+		{
+			name:     "text odd key",
+			format:   "text",
+			log:      func(l *Logger) { l.Error("oops", "lonely") },
+			wantText: "[Crawlab] [ERROR] oops !BADKEY=lonely",
+		},
+		{
+			name:   "json with fields",
+			format: "JSON",
+			log: func(l *Logger) {
+				l.With("url", "http://a").Error("failed", "err", errors.New("timeout"), "n", 3)
+			},
+			wantJSON: map[string]interface{}{
+				"level": "ERROR", "msg": "failed", "url": "http://a", "err": "timeout", "n": float64(3),
+			},
+		},
+		{
+			name:   "json unencodable field",
+			format: "json",
+			log:    func(l *Logger) { l.Info("bad", "ch", make(chan int)) },
+			wantJSON: map[string]interface{}{
+				"level": "INFO", "msg": "bad",
+				"error": "failed to marshal log fields: json: unsupported type: chan int",
+			},
+		},
+		{
+			name:   "slog groups",
+			format: "json",
+			log: func(l *Logger) {
+				slog.New(l.SlogHandler()).WithGroup("req").Warn("retry", "attempt", 2, slog.Group("proxy", "host", "p"))
+			},
+			wantJSON: map[string]interface{}{
+				"level": "WARN", "msg": "retry", "req.attempt": float64(2), "req.proxy.host": "p",
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var buf bytes.Buffer
+			tt.log(NewLogger(&buf, LevelDebug, tt.format))
+			line := strings.TrimSuffix(buf.String(), "\n")
+			if strings.Contains(line, "\n") {
+				t.Fatalf("want one line, got %q", buf.String())
+			}
+
+			if tt.wantJSON == nil {
+				// 去掉 "2006-01-02 15:04:05.000 "
+				if len(line) < 24 || line[24:] != tt.wantText {
+					t.Errorf("line = %q, want %q after the timestamp", line, tt.wantText)
+				}
+				return
+			}
+
+			var got map[string]interface{}
+			if err := json.Unmarshal([]byte(line), &got); err != nil {
+				t.Fatalf("not JSON: %q", line)
+			}
+			if _, ok := got["time"]; !ok {
+				t.Error("missing time field")
+			}
+			delete(got, "time")
+			if !reflect.DeepEqual(got, tt.wantJSON) {
+				t.Errorf("entry = %v, want %v", got, tt.wantJSON)
+			}
+		})
+	}
+}
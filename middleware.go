@@ -0,0 +1,115 @@
+package crawlab
+
+import (
+	"errors"
+	"net/http"
+	"sync/atomic"
+	"time"
+)
+
+// RoundTripFunc 发送一次请求
+type RoundTripFunc func(req *http.Request) (*http.Response, error)
+
+// Middleware 请求中间件
+//
+// 艹！包一层next，想改请求、看响应、直接返回假响应都行
+//
+//	sign := func(next crawlab.RoundTripFunc) crawlab.RoundTripFunc {
+//		return func(req *http.Request) (*http.Response, error) {
+//			req.Header.Set("X-Signature", sign(req))
+//			return next(req)
+//		}
+//	}
+//	client.Use(sign)
+type Middleware func(next RoundTripFunc) RoundTripFunc
+
+// Use 添加中间件
+//
+// 艹！先添加的在最外层；每次尝试（包括重试）都会走一遍，
+// robots.txt检查、限流、熔断和代理选择在中间件之前完成
+func (c *HTTPClient) Use(mw ...Middleware) *HTTPClient {
+	c.Middlewares = append(c.Middlewares, mw...)
+	return c
+}
+
+// roundTripper 把中间件串起来，最里层是磁盘缓存和底层Client.Do
+func (c *HTTPClient) roundTripper() RoundTripFunc {
+	rt := RoundTripFunc(c.Client.Do)
+	if c.Cache != nil {
+		rt = c.Cache.wrap(rt)
+	}
+	for i := len(c.Middlewares) - 1; i >= 0; i-- {
+		rt = c.Middlewares[i](rt)
+	}
+	return rt
+}
+
+// LoggingMiddleware 记录每个请求的方法、URL、状态码和耗时
+//
+// 艹！成功的打DEBUG，失败和5xx打WARN；logger为nil时用全局Logger
+func LoggingMiddleware(logger *Logger) Middleware {
+	return func(next RoundTripFunc) RoundTripFunc {
+		return func(req *http.Request) (*http.Response, error) {
+			l := logger
+			if l == nil {
+				l = GetLogger()
+			}
+
+			start := time.Now()
+			resp, err := next(req)
+			elapsed := time.Since(start).Round(time.Millisecond)
+
+			switch {
+			case err != nil:
+				l.Warn("HTTP request failed", "method", req.Method, "url", req.URL.Redacted(), "elapsed", elapsed, "error", err)
+			case resp.StatusCode >= 500:
+				l.Warn("HTTP request", "method", req.Method, "url", req.URL.Redacted(), "status", resp.StatusCode, "elapsed", elapsed)
+			default:
+				// 缓存返回的耗时不是网络耗时，标出来别混进去
+				kv := []interface{}{"method", req.Method, "url", req.URL.Redacted(), "status", resp.StatusCode, "elapsed", elapsed}
+				if state := resp.Header.Get(CacheHeader); state != "" {
+					kv = append(kv, "cache", state)
+				}
+				l.Debug("HTTP request", kv...)
+			}
+			return resp, err
+		}
+	}
+}
+
+// StatsMiddleware 每次尝试计入Stats.Requests
+//
+// 艹！缓存直接返回的没联网，算到Stats.CacheHits里，不然开了缓存请求数和错误率全是错的；
+// 离线模式缓存里没有的（ErrCacheMiss）也没联网，两边都不算
+func StatsMiddleware(stats *Stats) Middleware {
+	return func(next RoundTripFunc) RoundTripFunc {
+		return func(req *http.Request) (*http.Response, error) {
+			resp, err := next(req)
+			switch {
+			case err == nil && resp.Header.Get(CacheHeader) == "HIT":
+				atomic.AddInt64(&stats.CacheHits, 1)
+			case errors.Is(err, ErrCacheMiss):
+			default:
+				atomic.AddInt64(&stats.Requests, 1)
+			}
+			return resp, err
+		}
+	}
+}
+
+// Instrument 给HTTPClient装上统计和日志中间件
+//
+// 艹！请求次数自动计入Stats.Requests，不用再手动IncRequests；
+// 设置过熔断器的话熔断次数也一起统计
+func (s *BaseSpider) Instrument(c *HTTPClient) *HTTPClient {
+	c.Use(StatsMiddleware(s.Stats), LoggingMiddleware(s.Logger()))
+	if c.Breakers != nil && c.Breakers != s.breakers {
+		s.TrackBreakers(c.Breakers)
+	}
+	return c
+}
+
+// NewHTTPClient 创建已经装好统计和日志中间件的HTTPClient
+func (s *BaseSpider) NewHTTPClient(timeout time.Duration) *HTTPClient {
+	return s.Instrument(NewHTTPClient(timeout))
+}
@@ -0,0 +1,99 @@
+package crawlab
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestMiddlewareOrder(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(r.Header.Get("X-Trace")))
+	}))
+	defer srv.Close()
+
+	var calls []string
+	trace := func(name string) Middleware {
+		return func(next RoundTripFunc) RoundTripFunc {
+			return func(req *http.Request) (*http.Response, error) {
+				calls = append(calls, name+" before")
+				req.Header.Add("X-Trace", name)
+				resp, err := next(req)
+				calls = append(calls, name+" after")
+				return resp, err
+			}
+		}
+	}
+
+	client := NewHTTPClient(5 * time.Second)
+	client.SetRetry(1, time.Millisecond)
+	client.Use(trace("outer"), trace("inner"))
+
+	text, err := client.GetText(context.Background(), srv.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if text != "outer" {
+		t.Errorf("server saw X-Trace %q, want the outermost value first", text)
+	}
+	want := []string{"outer before", "inner before", "inner after", "outer after"}
+	if !reflect.DeepEqual(calls, want) {
+		t.Errorf("calls = %v, want %v", calls, want)
+	}
+}
+
+func TestStatsMiddlewareCache(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if strings.HasPrefix(r.URL.Path, "/fail") {
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+		w.Header().Set("Cache-Control", "max-age=60")
+		w.Write([]byte("ok"))
+	}))
+	defer srv.Close()
+
+	tests := []struct {
+		name      string
+		mode      CacheMode
+		paths     []string
+		wantReqs  int64
+		wantHits  int64
+		wantError bool
+	}{
+		{"no cache", CacheOff, []string{"/a", "/a"}, 2, 0, false},
+		{"second request hits", CacheReadWrite, []string{"/a", "/a", "/b"}, 2, 1, false},
+		{"uncacheable responses always count", CacheReadWrite, []string{"/fail", "/fail"}, 2, 0, true},
+		{"offline miss is not a request", CacheReadOnly, []string{"/a"}, 0, 0, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cache, err := NewHTTPCache(t.TempDir(), tt.mode)
+			if err != nil {
+				t.Fatal(err)
+			}
+			stats := &Stats{}
+			client := NewHTTPClient(5 * time.Second)
+			client.SetCache(cache)
+			client.Use(StatsMiddleware(stats))
+
+			for _, p := range tt.paths {
+				resp, err := client.Get(context.Background(), srv.URL+p)
+				if (err != nil) != tt.wantError {
+					t.Fatalf("GET %s: err = %v, wantError %v", p, err, tt.wantError)
+				}
+				if err == nil {
+					resp.Body.Close()
+				}
+			}
+			if stats.Requests != tt.wantReqs || stats.CacheHits != tt.wantHits {
+				t.Errorf("Requests = %d, CacheHits = %d, want %d, %d", stats.Requests, stats.CacheHits, tt.wantReqs, tt.wantHits)
+			}
+		})
+	}
+}
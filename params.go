@@ -0,0 +1,460 @@
+package crawlab
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"reflect"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// ParamTag 参数绑定使用的struct tag名
+//
+// 艹！写法：param:"名字,选项..."，选项有：
+//   - required 必填
+//   - args     接收裸URL列表（整个参数不是JSON也不是key=value时）
+//
+// 配套tag：default:"默认值"、env:"环境变量名"、usage:"说明"
+// 没写param tag时用json tag的名字，再没有就用字段名
+const ParamTag = "param"
+
+// ParamError 参数绑定失败
+//
+// 艹！Error()输出类似命令行usage的说明，直接打到日志里就能看懂缺什么
+type ParamError struct {
+	Missing []string // 缺少的必填参数
+	Invalid []string // 解析失败的参数及原因
+	Usage   string   // 参数说明
+}
+
+// Error 实现error接口
+func (e *ParamError) Error() string {
+	var b strings.Builder
+	b.WriteString("invalid task params")
+	if len(e.Missing) > 0 {
+		b.WriteString("\n  missing: " + strings.Join(e.Missing, ", "))
+	}
+	for _, inv := range e.Invalid {
+		b.WriteString("\n  invalid: " + inv)
+	}
+	if e.Usage != "" {
+		b.WriteString("\nusage:\n" + e.Usage)
+	}
+	return b.String()
+}
+
+// paramField 一个可绑定的字段
+type paramField struct {
+	name     string
+	index    []int
+	typ      reflect.Type
+	required bool
+	args     bool
+	def      string
+	hasDef   bool
+	env      string
+	usage    string
+}
+
+// BindParams 把CRAWLAB_TASK_PARAM绑定到结构体
+//
+// 艹！和ParseParamJSON不同，参数为空也不报错，会走env和default
+// 用法：var p MyParams; if err := BindParams(&p); err != nil { LogError("%v", err) }
+func BindParams(v interface{}) error {
+	return BindParamString(GetParam(), v)
+}
+
+// BindParamString 把参数字符串绑定到结构体
+//
+// 艹！支持的参数格式：
+//   - JSON对象：{"pages": 3, "category": "books"}
+//   - key=value：pages=3&category=books 或者用空格、分号、换行分隔，值里有分隔符也行（title=hello world），
+//     值里带key=的要加引号（url="http://x?a=1&b=2"）
+//   - 裸URL列表（JSON数组、逗号、空格或换行分隔）：绑定到带args选项的字段
+//
+// 取值优先级：参数 > 环境变量 > default tag
+func BindParamString(raw string, v interface{}) error {
+	rv := reflect.ValueOf(v)
+	if rv.Kind() != reflect.Ptr || rv.IsNil() || rv.Elem().Kind() != reflect.Struct {
+		return fmt.Errorf("BindParams requires a non-nil pointer to struct, got %T", v)
+	}
+	rv = rv.Elem()
+
+	fields := paramFields(rv.Type())
+	values, list, err := parseParamString(raw)
+	if err != nil {
+		return &ParamError{Invalid: []string{err.Error()}, Usage: paramUsage(fields)}
+	}
+
+	perr := &ParamError{}
+	if list != nil {
+		argsField := -1
+		for i, f := range fields {
+			if f.args {
+				argsField = i
+				break
+			}
+		}
+		if argsField < 0 {
+			perr.Invalid = append(perr.Invalid, "param is a plain list but no field has the args option")
+		} else {
+			values = map[string]interface{}{fields[argsField].name: list}
+		}
+	}
+
+	for _, f := range fields {
+		fv := rv.FieldByIndex(f.index)
+
+		val, ok := lookupParam(values, f.name)
+		source := "param"
+		if !ok && f.env != "" {
+			if envVal := os.Getenv(f.env); envVal != "" {
+				val, ok, source = envVal, true, "env "+f.env
+			}
+		}
+		if !ok && f.hasDef {
+			val, ok, source = f.def, true, "default"
+		}
+
+		if !ok {
+			if f.required {
+				perr.Missing = append(perr.Missing, f.name)
+			}
+			continue
+		}
+
+		if err := setParamValue(fv, val); err != nil {
+			perr.Invalid = append(perr.Invalid, fmt.Sprintf("%s (from %s): %v", f.name, source, err))
+			continue
+		}
+		if f.required && fv.IsZero() {
+			perr.Missing = append(perr.Missing, f.name)
+		}
+	}
+
+	if len(perr.Missing) > 0 || len(perr.Invalid) > 0 {
+		perr.Usage = paramUsage(fields)
+		return perr
+	}
+	return nil
+}
+
+// paramFields 收集结构体里所有可绑定字段（包括嵌入结构体）
+func paramFields(t reflect.Type) []paramField {
+	var fields []paramField
+	for i := 0; i < t.NumField(); i++ {
+		sf := t.Field(i)
+		if !sf.IsExported() {
+			continue
+		}
+
+		tag, hasTag := sf.Tag.Lookup(ParamTag)
+		if tag == "-" {
+			continue
+		}
+		if sf.Anonymous && !hasTag && sf.Type.Kind() == reflect.Struct {
+			for _, inner := range paramFields(sf.Type) {
+				inner.index = append([]int{i}, inner.index...)
+				fields = append(fields, inner)
+			}
+			continue
+		}
+
+		name, opts, _ := strings.Cut(tag, ",")
+		if name == "" {
+			name = fieldName(sf)
+		}
+
+		f := paramField{
+			name:  name,
+			index: []int{i},
+			typ:   sf.Type,
+			env:   sf.Tag.Get("env"),
+			usage: sf.Tag.Get("usage"),
+		}
+		f.def, f.hasDef = sf.Tag.Lookup("default")
+		for _, opt := range strings.Split(opts, ",") {
+			switch strings.TrimSpace(opt) {
+			case "required":
+				f.required = true
+			case "args":
+				f.args = true
+			}
+		}
+		fields = append(fields, f)
+	}
+	return fields
+}
+
+// parseParamString 识别参数格式
+//
+// 艹！返回key/value（JSON对象或key=value）或者裸列表，二者只有一个非nil
+func parseParamString(raw string) (map[string]interface{}, []string, error) {
+	raw = strings.TrimSpace(raw)
+	if raw == "" {
+		return map[string]interface{}{}, nil, nil
+	}
+
+	switch raw[0] {
+	case '{':
+		var obj map[string]json.RawMessage
+		if err := json.Unmarshal([]byte(raw), &obj); err != nil {
+			return nil, nil, fmt.Errorf("failed to parse param JSON: %w", err)
+		}
+		values := make(map[string]interface{}, len(obj))
+		for k, v := range obj {
+			values[k] = v
+		}
+		return values, nil, nil
+
+	case '[':
+		var list []string
+		if err := json.Unmarshal([]byte(raw), &list); err != nil {
+			return nil, nil, fmt.Errorf("failed to parse param list: %w", err)
+		}
+		return nil, list, nil
+	}
+
+	// 开头就是key=才按key=value解析，URL（http://x?a=b、example.com/p?a=b）的=前面有:或/，不会误判
+	if paramKeyPattern.MatchString(raw) {
+		return parseParamPairs(raw)
+	}
+
+	// URL里可能有&和;，列表只按逗号和空白分隔
+	list := strings.FieldsFunc(raw, func(r rune) bool {
+		return r == ',' || r == ' ' || r == '\t' || r == '\n' || r == '\r'
+	})
+	return nil, list, nil
+}
+
+// paramKeyPattern 参数名后面紧跟=
+var paramKeyPattern = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_.\-]*=`)
+
+// isParamSeparator key=value之间的分隔符
+func isParamSeparator(c byte) bool {
+	return c == '&' || c == ';' || c == ' ' || c == '\t' || c == '\n' || c == '\r'
+}
+
+// parseParamPairs 解析key=value参数
+//
+// 艹！只在"分隔符+下一个key="处切开，所以title=hello world pages=3能拿到"hello world"
+// 值里本身带key=的（比如URL查询串）要加引号：url="http://x?a=1&b=2"
+// 双引号里支持Go的转义，单引号原样保留
+func parseParamPairs(raw string) (map[string]interface{}, []string, error) {
+	values := make(map[string]interface{})
+
+	for raw != "" {
+		loc := paramKeyPattern.FindStringIndex(raw)
+		if loc == nil {
+			return nil, nil, fmt.Errorf("malformed key=value pair %q", raw)
+		}
+		key := raw[:loc[1]-1]
+		raw = raw[loc[1]:]
+
+		var val string
+		if raw != "" && (raw[0] == '"' || raw[0] == '\'') {
+			end := closingQuote(raw)
+			if end < 0 {
+				return nil, nil, fmt.Errorf("unterminated quote in value of %s", key)
+			}
+			if raw[0] == '"' {
+				unquoted, err := strconv.Unquote(raw[:end+1])
+				if err != nil {
+					return nil, nil, fmt.Errorf("invalid quoted value of %s: %w", key, err)
+				}
+				val = unquoted
+			} else {
+				val = raw[1:end]
+			}
+			raw = raw[end+1:]
+			if raw != "" && !isParamSeparator(raw[0]) {
+				return nil, nil, fmt.Errorf("unexpected text after quoted value of %s", key)
+			}
+		} else {
+			end := nextParamBoundary(raw)
+			val = strings.TrimSpace(raw[:end])
+			raw = raw[end:]
+		}
+		values[key] = val
+
+		raw = strings.TrimLeftFunc(raw, func(r rune) bool { return r < 0x80 && isParamSeparator(byte(r)) })
+	}
+	return values, nil, nil
+}
+
+// closingQuote 返回和s[0]配对的引号位置，双引号里跳过反斜杠转义
+func closingQuote(s string) int {
+	quote := s[0]
+	for i := 1; i < len(s); i++ {
+		switch {
+		case quote == '"' && s[i] == '\\':
+			i++
+		case s[i] == quote:
+			return i
+		}
+	}
+	return -1
+}
+
+// nextParamBoundary 找到值的结尾：后面跟着下一个key=的那串分隔符
+func nextParamBoundary(s string) int {
+	for i := 0; i < len(s); i++ {
+		if !isParamSeparator(s[i]) {
+			continue
+		}
+		j := i
+		for j < len(s) && isParamSeparator(s[j]) {
+			j++
+		}
+		if j == len(s) || paramKeyPattern.MatchString(s[j:]) {
+			return i
+		}
+		i = j - 1
+	}
+	return len(s)
+}
+
+// lookupParam 按名字取参数，大小写不敏感
+func lookupParam(values map[string]interface{}, name string) (interface{}, bool) {
+	if v, ok := values[name]; ok {
+		return v, true
+	}
+	for k, v := range values {
+		if strings.EqualFold(k, name) {
+			return v, true
+		}
+	}
+	return nil, false
+}
+
+// setParamValue 把JSON片段、字符串或字符串列表写入字段
+func setParamValue(fv reflect.Value, val interface{}) error {
+	switch v := val.(type) {
+	case json.RawMessage:
+		// JSON里给了字符串但字段不是字符串（比如"3"给int），退回字符串转换
+		if err := json.Unmarshal(v, fv.Addr().Interface()); err != nil {
+			var s string
+			if json.Unmarshal(v, &s) == nil {
+				return setParamString(fv, s)
+			}
+			return err
+		}
+		return nil
+
+	case []string:
+		if fv.Kind() == reflect.Slice {
+			slice := reflect.MakeSlice(fv.Type(), len(v), len(v))
+			for i, s := range v {
+				if err := setParamString(slice.Index(i), s); err != nil {
+					return err
+				}
+			}
+			fv.Set(slice)
+			return nil
+		}
+		return setParamString(fv, strings.Join(v, ","))
+
+	case string:
+		return setParamString(fv, v)
+	}
+	return fmt.Errorf("unsupported value type %T", val)
+}
+
+// setParamString 按字段类型转换字符串
+//
+// 艹！slice用逗号分隔，其余复杂类型按JSON解析
+func setParamString(fv reflect.Value, s string) error {
+	if fv.Kind() == reflect.Ptr {
+		ptr := reflect.New(fv.Type().Elem())
+		if err := setParamString(ptr.Elem(), s); err != nil {
+			return err
+		}
+		fv.Set(ptr)
+		return nil
+	}
+
+	if fv.Type() == reflect.TypeOf(time.Duration(0)) {
+		d, err := time.ParseDuration(s)
+		if err != nil {
+			return err
+		}
+		fv.SetInt(int64(d))
+		return nil
+	}
+
+	switch fv.Kind() {
+	case reflect.String:
+		fv.SetString(s)
+	case reflect.Bool:
+		b, err := strconv.ParseBool(s)
+		if err != nil {
+			return err
+		}
+		fv.SetBool(b)
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		n, err := strconv.ParseInt(s, 10, fv.Type().Bits())
+		if err != nil {
+			return err
+		}
+		fv.SetInt(n)
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		n, err := strconv.ParseUint(s, 10, fv.Type().Bits())
+		if err != nil {
+			return err
+		}
+		fv.SetUint(n)
+	case reflect.Float32, reflect.Float64:
+		n, err := strconv.ParseFloat(s, fv.Type().Bits())
+		if err != nil {
+			return err
+		}
+		fv.SetFloat(n)
+	case reflect.Slice:
+		if strings.HasPrefix(strings.TrimSpace(s), "[") {
+			return json.Unmarshal([]byte(s), fv.Addr().Interface())
+		}
+		var parts []string
+		for _, p := range strings.Split(s, ",") {
+			if p = strings.TrimSpace(p); p != "" {
+				parts = append(parts, p)
+			}
+		}
+		return setParamValue(fv, parts)
+	default:
+		return json.Unmarshal([]byte(s), fv.Addr().Interface())
+	}
+	return nil
+}
+
+// paramUsage 生成参数说明
+func paramUsage(fields []paramField) string {
+	var b strings.Builder
+	for _, f := range fields {
+		var notes []string
+		if f.required {
+			notes = append(notes, "required")
+		}
+		if f.args {
+			notes = append(notes, "accepts plain list")
+		}
+		if f.hasDef {
+			notes = append(notes, "default="+f.def)
+		}
+		if f.env != "" {
+			notes = append(notes, "env="+f.env)
+		}
+
+		line := fmt.Sprintf("  %-16s %-14s", f.name, f.typ.String())
+		if len(notes) > 0 {
+			line += " (" + strings.Join(notes, ", ") + ")"
+		}
+		if f.usage != "" {
+			line += " " + f.usage
+		}
+		b.WriteString(strings.TrimRight(line, " ") + "\n")
+	}
+	return strings.TrimRight(b.String(), "\n")
+}
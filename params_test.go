@@ -0,0 +1,87 @@
+package crawlab
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestParseParamString(t *testing.T) {
+	tests := []struct {
+		name    string
+		raw     string
+		values  map[string]interface{}
+		list    []string
+		wantErr bool
+	}{
+		{"empty", "", map[string]interface{}{}, nil, false},
+		{"ampersand pairs", "pages=3&category=books", map[string]interface{}{"pages": "3", "category": "books"}, nil, false},
+		{"mixed separators", "pages=3; category=books\nsort=asc", map[string]interface{}{"pages": "3", "category": "books", "sort": "asc"}, nil, false},
+		{"value with spaces", "title=hello world", map[string]interface{}{"title": "hello world"}, nil, false},
+		{"value with spaces then key", "title=hello world pages=3", map[string]interface{}{"title": "hello world", "pages": "3"}, nil, false},
+		{"double quoted", `url="http://x.com/?a=1&b=2" pages=3`, map[string]interface{}{"url": "http://x.com/?a=1&b=2", "pages": "3"}, nil, false},
+		{"double quoted escape", `title="say \"hi\""`, map[string]interface{}{"title": `say "hi"`}, nil, false},
+		{"single quoted", `title='a b=c'`, map[string]interface{}{"title": "a b=c"}, nil, false},
+		{"empty value", "title=&pages=2", map[string]interface{}{"title": "", "pages": "2"}, nil, false},
+		{"unterminated quote", `title="abc`, nil, nil, true},
+		{"text after quote", `title="abc"def`, nil, nil, true},
+		{"url with query", "https://example.com/search?q=go&page=2", nil, []string{"https://example.com/search?q=go&page=2"}, false},
+		{"schemeless url with query", "example.com/list?page=2", nil, []string{"example.com/list?page=2"}, false},
+		{"url list", "https://a.com, https://b.com\nhttps://c.com", nil, []string{"https://a.com", "https://b.com", "https://c.com"}, false},
+		{"json list", `["https://a.com","https://b.com"]`, nil, []string{"https://a.com", "https://b.com"}, false},
+		{"bad json", `{"pages":`, nil, nil, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			values, list, err := parseParamString(tt.raw)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("err = %v, wantErr %v", err, tt.wantErr)
+			}
+			if tt.wantErr {
+				return
+			}
+			if !reflect.DeepEqual(values, tt.values) {
+				t.Errorf("values = %#v, want %#v", values, tt.values)
+			}
+			if !reflect.DeepEqual(list, tt.list) {
+				t.Errorf("list = %#v, want %#v", list, tt.list)
+			}
+		})
+	}
+}
+
+func TestBindParamString(t *testing.T) {
+	type params struct {
+		Pages int      `param:"pages" default:"1"`
+		Title string   `param:"title,required"`
+		Tags  []string `param:"tags"`
+		URLs  []string `param:"urls,args"`
+	}
+
+	tests := []struct {
+		name    string
+		raw     string
+		want    params
+		wantErr bool
+	}{
+		{"json", `{"pages": 3, "title": "t", "tags": ["a","b"]}`, params{Pages: 3, Title: "t", Tags: []string{"a", "b"}}, false},
+		{"json string number", `{"pages": "4", "title": "t"}`, params{Pages: 4, Title: "t"}, false},
+		{"pairs with default", "title=hello world&tags=a,b", params{Pages: 1, Title: "hello world", Tags: []string{"a", "b"}}, false},
+		{"missing required", "pages=2", params{}, true},
+		{"invalid int", "title=t pages=x", params{}, true},
+		{"plain list", "https://a.com https://b.com", params{}, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var got params
+			err := BindParamString(tt.raw, &got)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("err = %v, wantErr %v", err, tt.wantErr)
+			}
+			if !tt.wantErr && !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("got %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,155 @@
+package crawlab
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"sync/atomic"
+)
+
+var (
+	// ErrDropItem 阶段返回它表示丢弃这条数据（不算错误）
+	ErrDropItem = errors.New("item dropped")
+	// ErrSkipStages 阶段返回它表示跳过后续阶段，直接保存当前数据
+	ErrSkipStages = errors.New("skip remaining stages")
+)
+
+// StageFunc 数据处理阶段
+//
+// 艹！返回新的item继续往下传；返回ErrDropItem丢弃；返回ErrSkipStages跳过后面的阶段
+// 返回其他错误算处理失败，数据不会被保存
+type StageFunc func(ctx context.Context, item interface{}) (interface{}, error)
+
+// StageStats 单个阶段的统计
+type StageStats struct {
+	Name      string // 阶段名称
+	Processed int64  // 处理条数
+	Dropped   int64  // 丢弃条数
+	Skipped   int64  // 跳过后续阶段的条数
+	Failed    int64  // 失败条数
+}
+
+// stage 已注册的阶段
+type stage struct {
+	name  string
+	fn    StageFunc
+	stats StageStats
+}
+
+// Pipeline 按顺序执行的数据处理流水线
+//
+// 艹！在数据进入IPC之前做校验、清洗、过滤
+type Pipeline struct {
+	mu     sync.RWMutex
+	stages []*stage
+}
+
+// NewPipeline 创建空的流水线
+func NewPipeline() *Pipeline {
+	return &Pipeline{}
+}
+
+// Use 追加一个阶段
+//
+// 艹！按注册顺序执行，返回自身方便链式调用
+func (p *Pipeline) Use(name string, fn StageFunc) *Pipeline {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	p.stages = append(p.stages, &stage{
+		name:  name,
+		fn:    fn,
+		stats: StageStats{Name: name},
+	})
+	return p
+}
+
+// Process 让一条数据依次通过所有阶段
+//
+// 艹！被丢弃时返回的错误满足errors.Is(err, ErrDropItem)
+func (p *Pipeline) Process(ctx context.Context, item interface{}) (interface{}, error) {
+	p.mu.RLock()
+	stages := p.stages
+	p.mu.RUnlock()
+
+	for _, st := range stages {
+		atomic.AddInt64(&st.stats.Processed, 1)
+
+		out, err := st.fn(ctx, item)
+		switch {
+		case err == nil:
+			item = out
+		case errors.Is(err, ErrSkipStages):
+			atomic.AddInt64(&st.stats.Skipped, 1)
+			if out != nil {
+				item = out
+			}
+			return item, nil
+		case errors.Is(err, ErrDropItem):
+			atomic.AddInt64(&st.stats.Dropped, 1)
+			return nil, fmt.Errorf("stage %s: %w", st.name, err)
+		default:
+			atomic.AddInt64(&st.stats.Failed, 1)
+			return nil, fmt.Errorf("stage %s failed: %w", st.name, err)
+		}
+	}
+
+	return item, nil
+}
+
+// Len 返回阶段数量
+func (p *Pipeline) Len() int {
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+	return len(p.stages)
+}
+
+// Stats 返回各阶段统计的快照
+func (p *Pipeline) Stats() []StageStats {
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+
+	result := make([]StageStats, 0, len(p.stages))
+	for _, st := range p.stages {
+		result = append(result, StageStats{
+			Name:      st.name,
+			Processed: atomic.LoadInt64(&st.stats.Processed),
+			Dropped:   atomic.LoadInt64(&st.stats.Dropped),
+			Skipped:   atomic.LoadInt64(&st.stats.Skipped),
+			Failed:    atomic.LoadInt64(&st.stats.Failed),
+		})
+	}
+	return result
+}
+
+// ValidateStage 校验阶段
+//
+// 艹！validate返回错误就算失败，数据原样往下传
+func ValidateStage(validate func(item interface{}) error) StageFunc {
+	return func(ctx context.Context, item interface{}) (interface{}, error) {
+		if err := validate(item); err != nil {
+			return nil, err
+		}
+		return item, nil
+	}
+}
+
+// TransformStage 转换阶段
+func TransformStage(transform func(item interface{}) (interface{}, error)) StageFunc {
+	return func(ctx context.Context, item interface{}) (interface{}, error) {
+		return transform(item)
+	}
+}
+
+// FilterStage 过滤阶段
+//
+// 艹！keep返回false的数据直接丢弃
+func FilterStage(keep func(item interface{}) bool) StageFunc {
+	return func(ctx context.Context, item interface{}) (interface{}, error) {
+		if !keep(item) {
+			return nil, ErrDropItem
+		}
+		return item, nil
+	}
+}
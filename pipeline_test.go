@@ -0,0 +1,125 @@
+package crawlab
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"testing"
+)
+
+// appendStage 把阶段名追加到字符串数据后面
+func appendStage(name string) StageFunc {
+	return func(ctx context.Context, item interface{}) (interface{}, error) {
+		return item.(string) + name, nil
+	}
+}
+
+func TestPipelineOrder(t *testing.T) {
+	errBoom := errors.New("boom")
+
+	tests := []struct {
+		name    string
+		middle  StageFunc // 注册在"a"和"c"之间的"b"阶段
+		want    string
+		wantErr error
+		stats   [3]StageStats // 只比较计数，Name单独检查
+	}{
+		{
+			name:   "stages run in registration order",
+			middle: appendStage("b"),
+			want:   "abc",
+			stats:  [3]StageStats{{Processed: 1}, {Processed: 1}, {Processed: 1}},
+		},
+		{
+			name:    "drop stops the pipeline",
+			middle:  FilterStage(func(interface{}) bool { return false }),
+			wantErr: ErrDropItem,
+			stats:   [3]StageStats{{Processed: 1}, {Processed: 1, Dropped: 1}, {}},
+		},
+		{
+			name: "skip keeps the new item",
+			middle: func(ctx context.Context, item interface{}) (interface{}, error) {
+				return item.(string) + "b", ErrSkipStages
+			},
+			want:  "ab",
+			stats: [3]StageStats{{Processed: 1}, {Processed: 1, Skipped: 1}, {}},
+		},
+		{
+			name: "skip without an item keeps the old one",
+			middle: func(ctx context.Context, item interface{}) (interface{}, error) {
+				return nil, ErrSkipStages
+			},
+			want:  "a",
+			stats: [3]StageStats{{Processed: 1}, {Processed: 1, Skipped: 1}, {}},
+		},
+		{
+			name: "failure stops the pipeline",
+			middle: TransformStage(func(interface{}) (interface{}, error) {
+				return nil, errBoom
+			}),
+			wantErr: errBoom,
+			stats:   [3]StageStats{{Processed: 1}, {Processed: 1, Failed: 1}, {}},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			p := NewPipeline().
+				Use("a", appendStage("a")).
+				Use("b", tt.middle).
+				Use("c", appendStage("c"))
+
+			got, err := p.Process(context.Background(), "")
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("err = %v, want %v", err, tt.wantErr)
+			}
+			if err == nil && got != tt.want {
+				t.Errorf("item = %v, want %q", got, tt.want)
+			}
+
+			stats := p.Stats()
+			for i, name := range []string{"a", "b", "c"} {
+				want := tt.stats[i]
+				want.Name = name
+				if !reflect.DeepEqual(stats[i], want) {
+					t.Errorf("stage %s stats = %+v, want %+v", name, stats[i], want)
+				}
+			}
+		})
+	}
+}
+
+func TestSpiderPipelineStats(t *testing.T) {
+	tests := []struct {
+		name         string
+		stage        StageFunc
+		wantSaved    int64
+		wantFiltered int64
+		wantFailed   int64
+	}{
+		{"kept", appendStage("!"), 1, 0, 0},
+		{"filtered", FilterStage(func(interface{}) bool { return false }), 0, 1, 0},
+		{"failed", ValidateStage(func(interface{}) error { return errors.New("bad") }), 0, 0, 1},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rec := &recordingTransport{}
+			useTransport(t, rec)
+
+			s := NewSpider("test").Use("stage", tt.stage)
+			err := s.Save("item")
+			if (err != nil) != (tt.wantFailed > 0) {
+				t.Fatalf("Save err = %v", err)
+			}
+
+			got := [3]int64{s.Stats.ItemsSaved, s.Stats.ItemsFiltered, s.Stats.ItemsFailed}
+			if want := [3]int64{tt.wantSaved, tt.wantFiltered, tt.wantFailed}; got != want {
+				t.Errorf("saved, filtered, failed = %v, want %v", got, want)
+			}
+			if len(rec.msgs) != int(tt.wantSaved) {
+				t.Errorf("sent %d messages, want %d", len(rec.msgs), tt.wantSaved)
+			}
+		})
+	}
+}
@@ -0,0 +1,170 @@
+package crawlab
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestProxyPoolReport(t *testing.T) {
+	connErr := &net.OpError{Op: "dial", Err: errors.New("connection refused")}
+	ok := &http.Response{StatusCode: 200}
+
+	// 每一步要么是状态码要么是错误
+	type result struct {
+		status int
+		err    error
+	}
+
+	tests := []struct {
+		name        string
+		results     []result
+		wantEjected bool
+	}{
+		{"403 bans at once", []result{{status: 403}}, true},
+		{"407 bans at once", []result{{status: 407}}, true},
+		{"429 is the site, not the proxy", []result{{status: 429}, {status: 429}, {status: 429}}, false},
+		{"server errors are not bans", []result{{status: 500}, {status: 502}, {status: 503}}, false},
+		{"failures below the limit", []result{{err: connErr}, {err: connErr}}, false},
+		{"consecutive failures eject", []result{{err: connErr}, {err: connErr}, {err: connErr}}, true},
+		{"success resets the count", []result{{err: connErr}, {err: connErr}, {status: 200}, {err: connErr}, {err: connErr}}, false},
+		{"cancelled requests are ignored", []result{{err: context.Canceled}, {err: context.Canceled}, {err: context.Canceled}}, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			pool, err := NewProxyPool(ProxyRoundRobin, "http://a:1", "http://b:1")
+			if err != nil {
+				t.Fatal(err)
+			}
+			a, _ := pool.Pick("site.com")
+
+			for _, r := range tt.results {
+				if r.err != nil {
+					pool.Report(a, nil, r.err)
+				} else {
+					pool.Report(a, &http.Response{StatusCode: r.status}, nil)
+				}
+			}
+
+			if got := pool.Stats()[0].Ejected; got != tt.wantEjected {
+				t.Fatalf("Ejected = %v, want %v", got, tt.wantEjected)
+			}
+			if !tt.wantEjected {
+				return
+			}
+
+			// 被踢出的不会再被选中
+			for i := 0; i < 3; i++ {
+				if u, _ := pool.Pick("site.com"); u.Host != "b:1" {
+					t.Fatalf("picked %s while a:1 is ejected", u.Host)
+				}
+			}
+
+			// 全踢光了就没得选
+			b, _ := pool.Pick("site.com")
+			pool.Report(b, &http.Response{StatusCode: 403}, nil)
+			if _, err := pool.Pick("site.com"); !errors.Is(err, ErrNoProxyAvailable) {
+				t.Fatalf("Pick err = %v, want ErrNoProxyAvailable", err)
+			}
+
+			// 冷却结束放回来，连续失败次数清零
+			pool.proxies[0].ejectedUntil = time.Now().Add(-time.Second)
+			if u, err := pool.Pick("site.com"); err != nil || u.Host != "a:1" {
+				t.Fatalf("Pick after cool-down = %v, %v, want a:1", u, err)
+			}
+			pool.Report(a, nil, connErr)
+			pool.Report(a, ok, nil)
+			if pool.Stats()[0].Ejected {
+				t.Error("a:1 ejected again right after re-admission")
+			}
+		})
+	}
+}
+
+func TestProxyPoolModes(t *testing.T) {
+	tests := []struct {
+		mode  ProxyMode
+		hosts []string
+		want  []string
+	}{
+		{ProxyRoundRobin, []string{"x", "x", "x", "y"}, []string{"a:1", "b:1", "c:1", "a:1"}},
+		{ProxySticky, []string{"x", "y", "x", "z", "y"}, []string{"a:1", "b:1", "a:1", "c:1", "b:1"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(string(tt.mode), func(t *testing.T) {
+			pool, err := NewProxyPool(tt.mode, "a:1", "http://b:1", "socks5://user:pass@c:1")
+			if err != nil {
+				t.Fatal(err)
+			}
+			var got []string
+			for _, host := range tt.hosts {
+				u, err := pool.Pick(host)
+				if err != nil {
+					t.Fatal(err)
+				}
+				got = append(got, u.Host)
+			}
+			if !equalStrings(got, tt.want) {
+				t.Errorf("picked %v, want %v", got, tt.want)
+			}
+		})
+	}
+
+	t.Run("invalid proxies", func(t *testing.T) {
+		for _, raw := range []string{"ftp://a:1", "http://"} {
+			if _, err := NewProxyPool(ProxyRandom, raw); err == nil {
+				t.Errorf("NewProxyPool(%q) succeeded", raw)
+			}
+		}
+		if _, err := NewProxyPool("fastest", "a:1"); err == nil {
+			t.Error("unknown mode accepted")
+		}
+	})
+}
+
+func TestHTTPClientProxyBan(t *testing.T) {
+	// 两个假代理：banned总是403，good正常转发
+	banned := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusForbidden)
+	}))
+	defer banned.Close()
+	good := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("via good " + r.URL.Host))
+	}))
+	defer good.Close()
+
+	pool, err := NewProxyPool(ProxyRoundRobin, banned.URL, good.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	client := NewHTTPClient(5 * time.Second)
+	client.SetProxyPool(pool)
+
+	want := []int{403, 200, 200, 200}
+	for i, code := range want {
+		resp, err := client.Get(context.Background(), "http://example.test/")
+		if err != nil {
+			t.Fatalf("request %d: %v", i, err)
+		}
+		body, _ := io.ReadAll(resp.Body)
+		resp.Body.Close()
+		if resp.StatusCode != code {
+			t.Errorf("request %d: status %d, want %d", i, resp.StatusCode, code)
+		}
+		if code == 200 && string(body) != "via good example.test" {
+			t.Errorf("request %d: body %q", i, body)
+		}
+	}
+
+	stats := pool.Stats()
+	if !stats[0].Ejected || stats[0].Requests != 1 || stats[1].Requests != 3 {
+		t.Errorf("stats = %+v", stats)
+	}
+}
@@ -0,0 +1,363 @@
+package crawlab
+
+import (
+	"context"
+	"io"
+	"math/rand"
+	"net/http"
+	"sync"
+	"time"
+)
+
+const (
+	// defaultSlowdownDelay 被限流后每个host请求间隔的基数
+	defaultSlowdownDelay = time.Second
+
+	// defaultMaxSlowdown 最大减速倍数
+	defaultMaxSlowdown = 32
+)
+
+// tokenBucket 令牌桶
+type tokenBucket struct {
+	rate   float64 // 每秒生成的令牌数
+	burst  float64 // 桶容量
+	tokens float64
+	last   time.Time
+}
+
+// newTokenBucket 创建令牌桶，rate<=0返回nil表示不限制
+func newTokenBucket(rate float64, burst int) *tokenBucket {
+	if rate <= 0 {
+		return nil
+	}
+	if burst < 1 {
+		burst = 1
+	}
+	return &tokenBucket{rate: rate, burst: float64(burst), tokens: float64(burst)}
+}
+
+// reserve 预订一个令牌，返回需要等待的时间
+//
+// 艹！令牌可以透支，透支多少就等多久；scale>1时按比例降低速率
+func (b *tokenBucket) reserve(now time.Time, scale float64) time.Duration {
+	if b == nil {
+		return 0
+	}
+	rate := b.rate / scale
+	if !b.last.IsZero() {
+		b.tokens += now.Sub(b.last).Seconds() * rate
+		if b.tokens > b.burst {
+			b.tokens = b.burst
+		}
+	}
+	b.last = now
+	b.tokens--
+	if b.tokens >= 0 {
+		return 0
+	}
+	return time.Duration(-b.tokens / rate * float64(time.Second))
+}
+
+// unreserve 还回reserve预订的令牌，请求没发出去时用
+func (b *tokenBucket) unreserve() {
+	if b == nil {
+		return
+	}
+	b.tokens++
+	if b.tokens > b.burst {
+		b.tokens = b.burst
+	}
+}
+
+// hostLimiter 单个host的限流状态
+type hostLimiter struct {
+	bucket      *tokenBucket
+	conns       chan struct{} // 并发连接数信号量，nil表示不限制
+	slowdown    float64       // 减速倍数，1表示正常
+	nextAllowed time.Time     // 下次允许发请求的时间
+	crawlDelay  time.Duration // 站点要求的最小间隔（例如robots.txt的Crawl-delay）
+}
+
+// RateLimiter 请求限流器
+//
+// 艹！别把人家站打挂了：
+//   - 全局令牌桶：所有host加起来每秒最多Rate个请求
+//   - 每个host的令牌桶：每秒最多HostRate个请求
+//   - 全局和每个host的并发连接数上限
+//   - 同一个host两次请求之间随机等待PolitenessDelay的0.5~1.5倍
+//   - 遇到429/503自动减速，之后每次成功慢慢恢复
+//
+// 只对一个HTTPClient生效的话直接SetRateLimiter，多个HTTPClient可以共享同一个RateLimiter
+type RateLimiter struct {
+	Rate            float64       // 全局每秒请求数（<=0不限制）
+	Burst           int           // 全局突发请求数
+	HostRate        float64       // 每个host每秒请求数（<=0不限制）
+	HostBurst       int           // 每个host突发请求数
+	MaxConcurrency  int           // 全局最大并发连接数（<=0不限制）
+	HostConcurrency int           // 每个host最大并发连接数（<=0不限制）
+	PolitenessDelay time.Duration // 同一个host两次请求的基础间隔（0不等待）
+
+	SlowdownDelay time.Duration // 被限流后请求间隔的基数（默认1秒）
+	MaxSlowdown   float64       // 最大减速倍数（默认32）
+
+	mu     sync.Mutex
+	global *tokenBucket
+	conns  chan struct{}
+	hosts  map[string]*hostLimiter
+	rand   *rand.Rand
+	inited bool
+}
+
+// NewRateLimiter 创建限流器
+//
+// 艹！rate是全局每秒请求数，burst是允许的突发请求数；其他限制直接设置字段
+func NewRateLimiter(rate float64, burst int) *RateLimiter {
+	return &RateLimiter{
+		Rate:          rate,
+		Burst:         burst,
+		SlowdownDelay: defaultSlowdownDelay,
+		MaxSlowdown:   defaultMaxSlowdown,
+	}
+}
+
+// NewRateLimiterFromConfig 按配置创建限流器
+//
+// 艹！MaxConcurrency是全局并发上限，RateLimit/HostRateLimit/HostConcurrency/PolitenessDelay见Config
+func NewRateLimiterFromConfig(cfg *Config) *RateLimiter {
+	l := NewRateLimiter(cfg.RateLimit, int(cfg.RateLimit)+1)
+	l.HostRate = cfg.HostRateLimit
+	l.HostBurst = 1
+	l.MaxConcurrency = cfg.MaxConcurrency
+	l.HostConcurrency = cfg.HostConcurrency
+	l.PolitenessDelay = cfg.PolitenessDelay
+	return l
+}
+
+// SetCrawlDelay 设置host要求的最小请求间隔
+//
+// 艹！robots.txt的Crawl-delay就走这里，和PolitenessDelay取较大值
+func (l *RateLimiter) SetCrawlDelay(host string, d time.Duration) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.host(host).crawlDelay = d
+}
+
+// Slowdown 返回host当前的减速倍数
+func (l *RateLimiter) Slowdown(host string) float64 {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return l.host(host).slowdown
+}
+
+// Wait 等待直到可以向host发请求
+//
+// 艹！成功时返回release，请求结束（响应体关闭）后必须调用它归还连接名额；
+// ctx取消时预订的令牌和间隔会还回去，不会白白占掉别的请求的额度
+func (l *RateLimiter) Wait(ctx context.Context, host string) (release func(), err error) {
+	l.mu.Lock()
+	l.init()
+	h := l.host(host)
+	l.mu.Unlock()
+
+	// 先排队等令牌，再占并发名额，不会占着名额干等令牌
+	l.mu.Lock()
+	now := time.Now()
+	wait := l.global.reserve(now, 1)
+	if w := h.bucket.reserve(now, h.slowdown); w > wait {
+		wait = w
+	}
+	if w := h.nextAllowed.Sub(now); w > wait {
+		wait = w
+	}
+	prevAllowed := h.nextAllowed
+	reserved := now.Add(wait + l.gap(h))
+	h.nextAllowed = reserved
+	l.mu.Unlock()
+
+	cancel := func() {
+		l.mu.Lock()
+		defer l.mu.Unlock()
+		l.global.unreserve()
+		h.bucket.unreserve()
+		// 后面没人再排队的话把间隔也退回去
+		if h.nextAllowed.Equal(reserved) {
+			h.nextAllowed = prevAllowed
+		}
+	}
+
+	if wait > 0 {
+		timer := time.NewTimer(wait)
+		defer timer.Stop()
+		select {
+		case <-timer.C:
+		case <-ctx.Done():
+			cancel()
+			return nil, ctx.Err()
+		}
+	}
+
+	if err := acquire(ctx, l.conns); err != nil {
+		cancel()
+		return nil, err
+	}
+	if err := acquire(ctx, h.conns); err != nil {
+		releaseSlot(l.conns)
+		cancel()
+		return nil, err
+	}
+	return func() {
+		releaseSlot(h.conns)
+		releaseSlot(l.conns)
+	}, nil
+}
+
+// Feedback 根据响应调整host的速度
+//
+// 艹！429/503时减速倍数翻倍，并遵守Retry-After；其他响应每次恢复一点
+func (l *RateLimiter) Feedback(host string, resp *http.Response, err error) {
+	if err != nil || resp == nil {
+		return
+	}
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	h := l.host(host)
+
+	if resp.StatusCode != http.StatusTooManyRequests && resp.StatusCode != http.StatusServiceUnavailable {
+		if h.slowdown > 1 {
+			h.slowdown *= 0.75
+			if h.slowdown < 1 {
+				h.slowdown = 1
+			}
+		}
+		return
+	}
+
+	maxSlowdown := l.MaxSlowdown
+	if maxSlowdown < 1 {
+		maxSlowdown = defaultMaxSlowdown
+	}
+	h.slowdown *= 2
+	if h.slowdown > maxSlowdown {
+		h.slowdown = maxSlowdown
+	}
+
+	pause := time.Duration(float64(l.slowdownDelay()) * h.slowdown)
+	if wait, ok := RetryAfter(resp); ok && wait > pause {
+		pause = wait
+	}
+	if next := time.Now().Add(pause); next.After(h.nextAllowed) {
+		h.nextAllowed = next
+	}
+	LogWarn("Host %s returned %d, slowing down %.1fx (pause %v)", host, resp.StatusCode, h.slowdown, pause.Round(time.Millisecond))
+}
+
+// gap 同一个host两次请求之间的间隔，调用方必须持有锁
+func (l *RateLimiter) gap(h *hostLimiter) time.Duration {
+	base := l.PolitenessDelay
+	if h.crawlDelay > base {
+		base = h.crawlDelay
+	}
+
+	var d time.Duration
+	if base > 0 {
+		// 随机0.5~1.5倍，别像机器一样整整齐齐
+		d = time.Duration((0.5 + l.rand.Float64()) * float64(base))
+	}
+	if h.slowdown > 1 {
+		if base < l.slowdownDelay() {
+			base = l.slowdownDelay()
+		}
+		if slow := time.Duration(float64(base) * (h.slowdown - 1)); slow > d {
+			d = slow
+		}
+	}
+	return d
+}
+
+// slowdownDelay 被限流后请求间隔的基数
+func (l *RateLimiter) slowdownDelay() time.Duration {
+	if l.SlowdownDelay > 0 {
+		return l.SlowdownDelay
+	}
+	return defaultSlowdownDelay
+}
+
+// init 第一次使用时按字段创建令牌桶和信号量，调用方必须持有锁
+func (l *RateLimiter) init() {
+	if l.inited {
+		return
+	}
+	l.inited = true
+	l.global = newTokenBucket(l.Rate, l.Burst)
+	if l.MaxConcurrency > 0 {
+		l.conns = make(chan struct{}, l.MaxConcurrency)
+	}
+	if l.rand == nil {
+		l.rand = rand.New(rand.NewSource(time.Now().UnixNano()))
+	}
+}
+
+// host 获取host的限流状态，不存在则创建，调用方必须持有锁
+func (l *RateLimiter) host(host string) *hostLimiter {
+	if l.hosts == nil {
+		l.hosts = make(map[string]*hostLimiter)
+	}
+	h, ok := l.hosts[host]
+	if !ok {
+		h = &hostLimiter{
+			bucket:   newTokenBucket(l.HostRate, l.HostBurst),
+			slowdown: 1,
+		}
+		if l.HostConcurrency > 0 {
+			h.conns = make(chan struct{}, l.HostConcurrency)
+		}
+		l.hosts[host] = h
+	}
+	return h
+}
+
+// acquire 占用一个名额，sem为nil时不限制
+func acquire(ctx context.Context, sem chan struct{}) error {
+	if sem == nil {
+		return nil
+	}
+	select {
+	case sem <- struct{}{}:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// releaseSlot 归还一个名额
+func releaseSlot(sem chan struct{}) {
+	if sem != nil {
+		<-sem
+	}
+}
+
+// releaseOnClose 响应体读完或关闭时归还连接名额
+//
+// 艹！读到EOF就还，忘了Close的调用方也不会把全局并发名额一直占着
+type releaseOnClose struct {
+	io.ReadCloser
+	once    sync.Once
+	release func()
+}
+
+// Read 读响应体，读到EOF时归还名额
+func (r *releaseOnClose) Read(p []byte) (int, error) {
+	n, err := r.ReadCloser.Read(p)
+	if err == io.EOF {
+		r.once.Do(r.release)
+	}
+	return n, err
+}
+
+// Close 关闭响应体并归还名额
+func (r *releaseOnClose) Close() error {
+	err := r.ReadCloser.Close()
+	r.once.Do(r.release)
+	return err
+}
@@ -0,0 +1,140 @@
+package crawlab
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestRateLimiterConcurrency(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("body"))
+	}))
+	defer srv.Close()
+
+	tests := []struct {
+		name   string
+		finish func(resp *http.Response)
+	}{
+		{"close releases the slot", func(resp *http.Response) { resp.Body.Close() }},
+		{"reading to EOF releases the slot", func(resp *http.Response) { io.ReadAll(resp.Body) }},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			limiter := NewRateLimiter(0, 0)
+			limiter.MaxConcurrency = 1
+			client := NewHTTPClient(5 * time.Second)
+			client.SetRateLimiter(limiter)
+
+			ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+			defer cancel()
+			for i := 0; i < 3; i++ {
+				resp, err := client.Get(ctx, srv.URL)
+				if err != nil {
+					t.Fatalf("request %d: %v", i, err)
+				}
+				tt.finish(resp)
+			}
+		})
+	}
+
+	t.Run("unfinished body holds the slot", func(t *testing.T) {
+		limiter := NewRateLimiter(0, 0)
+		limiter.MaxConcurrency = 1
+		client := NewHTTPClient(5 * time.Second)
+		client.SetRateLimiter(limiter)
+
+		resp, err := client.Get(context.Background(), srv.URL)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer resp.Body.Close()
+
+		ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+		defer cancel()
+		if _, err := client.Get(ctx, srv.URL); !errors.Is(err, context.DeadlineExceeded) {
+			t.Errorf("second request err = %v, want deadline exceeded", err)
+		}
+	})
+}
+
+func TestRateLimiterCancelReturnsToken(t *testing.T) {
+	tests := []struct {
+		name    string
+		limiter func() *RateLimiter
+	}{
+		{"global bucket", func() *RateLimiter { return NewRateLimiter(5, 1) }},
+		{"host bucket", func() *RateLimiter {
+			l := NewRateLimiter(0, 0)
+			l.HostRate, l.HostBurst = 5, 1
+			return l
+		}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			l := tt.limiter()
+
+			// 把唯一的令牌用掉
+			release, err := l.Wait(context.Background(), "a.com")
+			if err != nil {
+				t.Fatal(err)
+			}
+			release()
+
+			// 排队等下一个令牌时取消，令牌要还回去
+			ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+			if _, err := l.Wait(ctx, "a.com"); !errors.Is(err, context.DeadlineExceeded) {
+				t.Fatalf("err = %v, want deadline exceeded", err)
+			}
+			cancel()
+
+			// 每秒5个：还回去了只等200ms，没还的话要等400ms
+			start := time.Now()
+			release, err = l.Wait(context.Background(), "a.com")
+			if err != nil {
+				t.Fatal(err)
+			}
+			release()
+			if elapsed := time.Since(start); elapsed > 300*time.Millisecond {
+				t.Errorf("waited %v after a cancelled reservation, want about 200ms", elapsed)
+			}
+		})
+	}
+}
+
+func TestRateLimiterFeedback(t *testing.T) {
+	tests := []struct {
+		name     string
+		statuses []int
+		want     float64
+	}{
+		{"ok stays at normal speed", []int{200, 200}, 1},
+		{"429 doubles", []int{429}, 2},
+		{"503 doubles again", []int{429, 503}, 4},
+		{"capped at MaxSlowdown", []int{429, 429, 429, 429}, 8},
+		{"success recovers slowly", []int{429, 429, 200}, 3},
+		{"never below normal", []int{429, 200, 200, 200}, 1},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			l := NewRateLimiter(0, 0)
+			l.MaxSlowdown = 8
+			for _, code := range tt.statuses {
+				l.Feedback("a.com", &http.Response{StatusCode: code, Header: http.Header{}}, nil)
+			}
+			if got := l.Slowdown("a.com"); got != tt.want {
+				t.Errorf("Slowdown = %v, want %v", got, tt.want)
+			}
+			if got := l.Slowdown("b.com"); got != 1 {
+				t.Errorf("other host Slowdown = %v, want 1", got)
+			}
+		})
+	}
+}
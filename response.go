@@ -0,0 +1,209 @@
+package crawlab
+
+import (
+	"bufio"
+	"bytes"
+	"compress/flate"
+	"compress/gzip"
+	"compress/zlib"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+)
+
+// Response 读完了的HTTP响应
+//
+// 艹！响应体已经解压、按大小限制读完并关闭，不用再自己io.ReadAll和Close了
+// 嵌入的*http.Response照常能用，Body换成了内存里的副本
+//
+//	resp, err := client.Fetch(ctx, "https://example.com")
+//	if err != nil {
+//		return err
+//	}
+//	text := resp.Text() // GBK、Shift-JIS的页面也能正确转成UTF-8
+type Response struct {
+	*http.Response
+
+	body    []byte
+	charset string
+}
+
+// NewResponse 读取并关闭resp.Body，包装成Response
+//
+// 艹！Content-Encoding是gzip/deflate的自动解压；maxBodySize按解压后的大小算，<=0不限制
+func NewResponse(resp *http.Response, maxBodySize int64) (*Response, error) {
+	defer resp.Body.Close()
+
+	data, err := readResponseBody(resp, maxBodySize)
+	if err != nil {
+		return nil, err
+	}
+
+	if resp.Header.Get("Content-Encoding") != "" {
+		resp.Header.Del("Content-Encoding")
+		resp.Header.Del("Content-Length")
+		resp.Uncompressed = true
+	}
+	resp.ContentLength = int64(len(data))
+	resp.Body = io.NopCloser(bytes.NewReader(data))
+
+	return &Response{
+		Response: resp,
+		body:     data,
+		charset:  DetectCharset(resp.Header.Get("Content-Type"), data),
+	}, nil
+}
+
+// Bytes 返回解压后的原始响应体
+func (r *Response) Bytes() []byte {
+	return r.body
+}
+
+// Charset 返回检测到的编码（规范化之后的名字，见charset.go）
+func (r *Response) Charset() string {
+	return r.charset
+}
+
+// Text 按检测到的编码把响应体转成UTF-8字符串
+func (r *Response) Text() string {
+	text, err := DecodeCharset(r.body, r.charset)
+	if err != nil {
+		return strings.ToValidUTF8(string(r.body), "�")
+	}
+	return text
+}
+
+// JSON 把响应体解析到v
+//
+// 艹！JSON按规定就是UTF-8，不做编码转换
+func (r *Response) JSON(v interface{}) error {
+	if err := json.Unmarshal(r.body, v); err != nil {
+		if ct := r.Header.Get("Content-Type"); !isJSONContentType(ct) {
+			return fmt.Errorf("failed to decode JSON response (content type %q): %w: %s", ct, err, snippet(r.body))
+		}
+		return fmt.Errorf("failed to decode JSON response: %w", err)
+	}
+	return nil
+}
+
+// Fetch 发送GET请求并读取响应
+//
+// 艹！状态码>=400返回*HTTPError；响应体超过MaxBodySize返回ErrBodyTooLarge
+func (c *HTTPClient) Fetch(ctx context.Context, url string) (*Response, error) {
+	return c.FetchRequest(ctx, "GET", url, nil)
+}
+
+// FetchRequest 发送请求并读取响应
+func (c *HTTPClient) FetchRequest(ctx context.Context, method, url string, body io.Reader) (*Response, error) {
+	resp, err := c.doRequest(ctx, method, url, body, nil)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode >= 400 {
+		defer resp.Body.Close()
+		return nil, newHTTPError(resp)
+	}
+	return NewResponse(resp, c.MaxBodySize)
+}
+
+// GetText 发送GET请求，返回转成UTF-8的响应体
+func (c *HTTPClient) GetText(ctx context.Context, url string) (string, error) {
+	resp, err := c.Fetch(ctx, url)
+	if err != nil {
+		return "", err
+	}
+	return resp.Text(), nil
+}
+
+// readResponseBody 解压并按大小限制读取响应体，不关闭
+func readResponseBody(resp *http.Response, maxBodySize int64) ([]byte, error) {
+	body, err := decodeContent(resp.Header.Get("Content-Encoding"), resp.Body)
+	if err != nil {
+		return nil, fmt.Errorf("failed to decode response: %w", err)
+	}
+
+	if maxBodySize <= 0 {
+		data, err := io.ReadAll(body)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read response: %w", err)
+		}
+		return data, nil
+	}
+
+	data, err := io.ReadAll(io.LimitReader(body, maxBodySize+1))
+	if err != nil {
+		return nil, fmt.Errorf("failed to read response: %w", err)
+	}
+	if int64(len(data)) > maxBodySize {
+		return nil, fmt.Errorf("%w: exceeds %d bytes", ErrBodyTooLarge, maxBodySize)
+	}
+	return data, nil
+}
+
+// bufferBody 把resp.Body读进内存换成副本，返回读到的内容
+//
+// 艹！超过limit时不再往下读，已经读出来的部分接回resp.Body，调用方照常能读完整个响应体；
+// limit<=0不限制
+func bufferBody(resp *http.Response, limit int64) ([]byte, bool, error) {
+	r := resp.Body
+	if limit > 0 {
+		r = io.NopCloser(io.LimitReader(resp.Body, limit+1))
+	}
+	data, err := io.ReadAll(r)
+	if err != nil {
+		resp.Body.Close()
+		return nil, false, fmt.Errorf("failed to read response: %w", err)
+	}
+	if limit > 0 && int64(len(data)) > limit {
+		resp.Body = struct {
+			io.Reader
+			io.Closer
+		}{io.MultiReader(bytes.NewReader(data), resp.Body), resp.Body}
+		return nil, false, nil
+	}
+
+	resp.Body.Close()
+	resp.Body = io.NopCloser(bytes.NewReader(data))
+	resp.ContentLength = int64(len(data))
+	return data, true, nil
+}
+
+// decodeContent 按Content-Encoding解压
+//
+// 艹！Go只在自己加Accept-Encoding时才自动解压，请求头里手动写了gzip就得自己来
+// deflate有人发zlib格式有人发裸deflate，看头两个字节判断
+func decodeContent(encoding string, body io.Reader) (io.Reader, error) {
+	encodings := splitList(strings.ToLower(encoding))
+	for i := len(encodings) - 1; i >= 0; i-- {
+		switch encodings[i] {
+		case "", "identity":
+		case "gzip", "x-gzip":
+			zr, err := gzip.NewReader(body)
+			if err == io.EOF {
+				return bytes.NewReader(nil), nil // HEAD、204之类的空响应体
+			}
+			if err != nil {
+				return nil, err
+			}
+			body = zr
+		case "deflate":
+			br := bufio.NewReader(body)
+			head, _ := br.Peek(2)
+			if len(head) == 2 && head[0]&0x0F == 8 && (uint16(head[0])<<8|uint16(head[1]))%31 == 0 {
+				zr, err := zlib.NewReader(br)
+				if err != nil {
+					return nil, err
+				}
+				body = zr
+			} else {
+				body = flate.NewReader(br)
+			}
+		default:
+			return nil, fmt.Errorf("unsupported content encoding %q", encodings[i])
+		}
+	}
+	return body, nil
+}
@@ -0,0 +1,89 @@
+package crawlab
+
+import (
+	"bytes"
+	"compress/flate"
+	"compress/gzip"
+	"compress/zlib"
+	"io"
+	"net/http"
+	"strings"
+	"testing"
+)
+
+// compress 按编码压缩数据
+func compress(t *testing.T, encoding string, data []byte) []byte {
+	t.Helper()
+	var buf bytes.Buffer
+	var w io.WriteCloser
+	switch encoding {
+	case "gzip":
+		w = gzip.NewWriter(&buf)
+	case "zlib":
+		w = zlib.NewWriter(&buf)
+	case "flate":
+		w, _ = flate.NewWriter(&buf, flate.DefaultCompression)
+	default:
+		t.Fatalf("unknown encoding %s", encoding)
+	}
+	w.Write(data)
+	if err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+func TestNewResponse(t *testing.T) {
+	const limit = 16
+	text := []byte("hello, compressed world")
+	atLimit := []byte(strings.Repeat("a", limit))
+	overLimit := []byte(strings.Repeat("a", limit+1))
+
+	tests := []struct {
+		name     string
+		encoding string
+		body     []byte
+		want     []byte
+		wantErr  string
+	}{
+		{"identity", "", []byte("plain"), []byte("plain"), ""},
+		{"gzip", "gzip", compress(t, "gzip", text[:10]), text[:10], ""},
+		{"x-gzip", "x-gzip", compress(t, "gzip", text[:10]), text[:10], ""},
+		{"zlib deflate", "deflate", compress(t, "zlib", text[:10]), text[:10], ""},
+		{"raw deflate", "deflate", compress(t, "flate", text[:10]), text[:10], ""},
+		{"stacked encodings", "deflate, gzip", compress(t, "gzip", compress(t, "zlib", text[:10])), text[:10], ""},
+		{"empty gzip body", "gzip", nil, []byte{}, ""},
+		{"unsupported encoding", "br", []byte("x"), nil, "unsupported content encoding \"br\""},
+		{"exactly at limit", "", atLimit, atLimit, ""},
+		{"one byte over limit", "", overLimit, nil, ErrBodyTooLarge.Error()},
+		{"limit counts decompressed size", "gzip", compress(t, "gzip", overLimit), nil, ErrBodyTooLarge.Error()},
+		{"corrupt gzip", "gzip", []byte("not gzip"), nil, "failed to decode response"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			header := http.Header{}
+			if tt.encoding != "" {
+				header.Set("Content-Encoding", tt.encoding)
+			}
+			raw := &http.Response{StatusCode: 200, Header: header, Body: io.NopCloser(bytes.NewReader(tt.body))}
+
+			resp, err := NewResponse(raw, limit)
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("err = %v, want %q", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !bytes.Equal(resp.Bytes(), tt.want) {
+				t.Errorf("body = %q, want %q", resp.Bytes(), tt.want)
+			}
+			if resp.Header.Get("Content-Encoding") != "" || resp.ContentLength != int64(len(tt.want)) {
+				t.Errorf("Content-Encoding = %q, ContentLength = %d", resp.Header.Get("Content-Encoding"), resp.ContentLength)
+			}
+		})
+	}
+}
@@ -2,129 +2,217 @@ package crawlab
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"math"
+	"math/rand"
 	"time"
 )
 
 // RetryFunc 可重试的函数类型
 type RetryFunc func() error
 
-// Retry 重试执行函数
-//
-// 艹！失败自动重试，支持固定延迟
-// maxRetries: 最大重试次数（0表示不重试）
-// delay: 每次重试之间的延迟
-func Retry(fn RetryFunc, maxRetries int, delay time.Duration) error {
-	return RetryWithContext(context.Background(), fn, maxRetries, delay)
+// Backoff 退避策略：根据第几次重试（从0开始）返回等待时间
+type Backoff func(attempt int) time.Duration
+
+// ConstantBackoff 固定延迟
+func ConstantBackoff(delay time.Duration) Backoff {
+	return func(int) time.Duration {
+		return delay
+	}
 }
 
-// RetryWithContext 带Context的重试执行
+// ExponentialBackoff 指数退避
 //
-// 艹！支持取消和超时
-func RetryWithContext(ctx context.Context, fn RetryFunc, maxRetries int, delay time.Duration) error {
-	var lastErr error
-
-	for attempt := 0; attempt <= maxRetries; attempt++ {
-		// 检查context是否取消
-		select {
-		case <-ctx.Done():
-			return fmt.Errorf("retry cancelled: %w", ctx.Err())
-		default:
+// 艹！延迟时间指数增长：delay, delay*2, delay*4...，不超过maxDelay
+func ExponentialBackoff(initialDelay, maxDelay time.Duration) Backoff {
+	return func(attempt int) time.Duration {
+		// initialDelay为0时就是不等，别拿0乘Inf算出NaN
+		if initialDelay <= 0 {
+			return 0
 		}
-
-		// 执行函数
-		err := fn()
-		if err == nil {
-			// 成功
-			if attempt > 0 {
-				LogDebug("Retry succeeded on attempt %d", attempt+1)
-			}
-			return nil
+		d := time.Duration(float64(initialDelay) * math.Pow(2, float64(attempt)))
+		// 兜住溢出
+		if d > maxDelay || d <= 0 {
+			d = maxDelay
 		}
+		return d
+	}
+}
 
-		lastErr = err
+// PermanentError 不可重试的错误
+type PermanentError struct {
+	Err error
+}
 
-		// 已经是最后一次尝试
-		if attempt >= maxRetries {
-			break
-		}
+// Error 实现error接口
+func (e *PermanentError) Error() string {
+	return e.Err.Error()
+}
 
-		// 记录重试日志
-		LogWarn("Attempt %d failed: %v, retrying in %v...", attempt+1, err, delay)
+// Unwrap 支持errors.Is/As
+func (e *PermanentError) Unwrap() error {
+	return e.Err
+}
 
-		// 等待后重试
-		select {
-		case <-time.After(delay):
-			// 继续重试
-		case <-ctx.Done():
-			return fmt.Errorf("retry cancelled during delay: %w", ctx.Err())
-		}
+// Permanent 把错误标记为不可重试
+//
+// 艹！fn里返回Permanent(err)，Retrier立即停止并返回原始err
+func Permanent(err error) error {
+	if err == nil {
+		return nil
 	}
+	return &PermanentError{Err: err}
+}
 
-	return fmt.Errorf("all %d attempts failed, last error: %w", maxRetries+1, lastErr)
+// DelayedError 指定了下次等待时间的可重试错误
+type DelayedError struct {
+	Err   error
+	Delay time.Duration
 }
 
-// RetryWithBackoff 带指数退避的重试
+// Error 实现error接口
+func (e *DelayedError) Error() string {
+	return e.Err.Error()
+}
+
+// Unwrap 支持errors.Is/As
+func (e *DelayedError) Unwrap() error {
+	return e.Err
+}
+
+// Delayed 指定这次失败之后等多久再重试
 //
-// 艹！延迟时间指数增长：delay, delay*2, delay*4, delay*8...
-// maxDelay: 最大延迟时间
-func RetryWithBackoff(ctx context.Context, fn RetryFunc, maxRetries int, initialDelay, maxDelay time.Duration) error {
-	var lastErr error
+// 艹！fn里返回Delayed(err, d)，Retrier这次就等d，不走退避策略（比如服务端给了Retry-After）
+func Delayed(err error, delay time.Duration) error {
+	if err == nil {
+		return nil
+	}
+	return &DelayedError{Err: err, Delay: delay}
+}
 
-	for attempt := 0; attempt <= maxRetries; attempt++ {
-		// 检查context是否取消
-		select {
-		case <-ctx.Done():
-			return fmt.Errorf("retry cancelled: %w", ctx.Err())
-		default:
-		}
+// Retrier 通用重试器
+//
+// 艹！用选项组合退避策略、总耗时上限、重试条件和回调，Retry/RetryWithBackoff/RetryIf都是它的简写
+//
+//	r := crawlab.NewRetrier(
+//		crawlab.WithMaxRetries(5),
+//		crawlab.WithDecorrelatedJitter(time.Second, 30*time.Second),
+//		crawlab.WithMaxElapsedTime(2*time.Minute),
+//	)
+//	err := r.Do(ctx, fn)
+type Retrier struct {
+	maxRetries  int
+	nextDelay   func(attempt int, prev time.Duration) time.Duration
+	jitter      float64
+	maxElapsed  time.Duration
+	shouldRetry func(error) bool
+	onRetry     func(attempt int, err error, delay time.Duration)
+}
 
-		// 执行函数
-		err := fn()
-		if err == nil {
-			if attempt > 0 {
-				LogDebug("Retry with backoff succeeded on attempt %d", attempt+1)
-			}
-			return nil
-		}
+// RetryOption Retrier选项
+type RetryOption func(*Retrier)
 
-		lastErr = err
+// NewRetrier 创建重试器
+//
+// 艹！默认：重试3次、固定延迟1秒、所有错误都重试、失败时打WARN日志
+func NewRetrier(opts ...RetryOption) *Retrier {
+	r := &Retrier{maxRetries: 3}
+	WithConstantBackoff(time.Second)(r)
+	for _, opt := range opts {
+		opt(r)
+	}
+	return r
+}
 
-		// 已经是最后一次尝试
-		if attempt >= maxRetries {
-			break
+// WithMaxRetries 最大重试次数（0表示不重试）
+func WithMaxRetries(n int) RetryOption {
+	return func(r *Retrier) {
+		if n < 0 {
+			n = 0
 		}
+		r.maxRetries = n
+	}
+}
 
-		// 计算退避延迟（指数增长）
-		backoffDelay := time.Duration(float64(initialDelay) * math.Pow(2, float64(attempt)))
-		if backoffDelay > maxDelay {
-			backoffDelay = maxDelay
+// WithBackoff 自定义退避策略
+func WithBackoff(b Backoff) RetryOption {
+	return func(r *Retrier) {
+		r.nextDelay = func(attempt int, _ time.Duration) time.Duration {
+			return b(attempt)
 		}
+	}
+}
 
-		// 记录重试日志
-		LogWarn("Attempt %d failed: %v, retrying in %v...", attempt+1, err, backoffDelay)
+// WithConstantBackoff 固定延迟
+func WithConstantBackoff(delay time.Duration) RetryOption {
+	return WithBackoff(ConstantBackoff(delay))
+}
 
-		// 等待后重试
-		select {
-		case <-time.After(backoffDelay):
-			// 继续重试
-		case <-ctx.Done():
-			return fmt.Errorf("retry cancelled during backoff: %w", ctx.Err())
+// WithExponentialBackoff 指数退避
+func WithExponentialBackoff(initialDelay, maxDelay time.Duration) RetryOption {
+	return WithBackoff(ExponentialBackoff(initialDelay, maxDelay))
+}
+
+// WithDecorrelatedJitter 去相关抖动退避
+//
+// 艹！每次等待在[base, 上次等待*3]之间随机取，不超过maxDelay
+// 大量worker同时失败时不会扎堆重试
+func WithDecorrelatedJitter(base, maxDelay time.Duration) RetryOption {
+	return func(r *Retrier) {
+		r.nextDelay = func(_ int, prev time.Duration) time.Duration {
+			if prev < base {
+				prev = base
+			}
+			upper := prev * 3
+			if upper > maxDelay || upper <= 0 {
+				upper = maxDelay
+			}
+			if upper <= base {
+				return base
+			}
+			return base + time.Duration(rand.Int63n(int64(upper-base)))
 		}
 	}
+}
 
-	return fmt.Errorf("all %d attempts failed with backoff, last error: %w", maxRetries+1, lastErr)
+// WithJitter 给延迟加上±fraction比例的随机抖动（0~1）
+func WithJitter(fraction float64) RetryOption {
+	return func(r *Retrier) {
+		r.jitter = math.Max(0, math.Min(1, fraction))
+	}
 }
 
-// RetryIf 条件重试
+// WithMaxElapsedTime 总耗时上限，下次等待会超过上限就不再重试（0不限制）
+func WithMaxElapsedTime(d time.Duration) RetryOption {
+	return func(r *Retrier) {
+		r.maxElapsed = d
+	}
+}
+
+// WithRetryIf 重试条件，返回false的错误立即返回
+func WithRetryIf(shouldRetry func(error) bool) RetryOption {
+	return func(r *Retrier) {
+		r.shouldRetry = shouldRetry
+	}
+}
+
+// WithOnRetry 每次准备重试前的回调，替换默认的WARN日志
 //
-// 艹！只有shouldRetry返回true时才重试
-// 用于某些错误不需要重试的场景
-func RetryIf(ctx context.Context, fn RetryFunc, shouldRetry func(error) bool, maxRetries int, delay time.Duration) error {
+// 艹！attempt是刚失败的第几次尝试（从1开始）
+func WithOnRetry(fn func(attempt int, err error, delay time.Duration)) RetryOption {
+	return func(r *Retrier) {
+		r.onRetry = fn
+	}
+}
+
+// Do 执行fn，失败按配置重试
+func (r *Retrier) Do(ctx context.Context, fn RetryFunc) error {
+	start := time.Now()
 	var lastErr error
+	var delay time.Duration
 
-	for attempt := 0; attempt <= maxRetries; attempt++ {
+	for attempt := 0; attempt <= r.maxRetries; attempt++ {
 		// 检查context是否取消
 		select {
 		case <-ctx.Done():
@@ -141,30 +229,114 @@ func RetryIf(ctx context.Context, fn RetryFunc, shouldRetry func(error) bool, ma
 			return nil
 		}
 
+		var perm *PermanentError
+		if errors.As(err, &perm) {
+			return perm.Err
+		}
+
+		var delayed *DelayedError
+		if errors.As(err, &delayed) {
+			err = delayed.Err
+		}
+
 		lastErr = err
 
 		// 检查是否应该重试
-		if !shouldRetry(err) {
+		if r.shouldRetry != nil && !r.shouldRetry(err) {
 			LogWarn("Error is not retryable: %v", err)
 			return err
 		}
 
 		// 已经是最后一次尝试
-		if attempt >= maxRetries {
+		if attempt >= r.maxRetries {
 			break
 		}
 
+		if delayed != nil {
+			delay = delayed.Delay
+		} else {
+			delay = r.applyJitter(r.nextDelay(attempt, delay))
+		}
+		if r.maxElapsed > 0 && time.Since(start)+delay > r.maxElapsed {
+			return fmt.Errorf("retry gave up after %v (%d attempts), last error: %w", time.Since(start).Round(time.Millisecond), attempt+1, lastErr)
+		}
+
 		// 记录重试日志
-		LogWarn("Attempt %d failed: %v, retrying in %v...", attempt+1, err, delay)
+		if r.onRetry != nil {
+			r.onRetry(attempt+1, err, delay)
+		} else {
+			LogWarn("Attempt %d failed: %v, retrying in %v...", attempt+1, err, delay)
+		}
 
 		// 等待后重试
+		timer := time.NewTimer(delay)
 		select {
-		case <-time.After(delay):
+		case <-timer.C:
 			// 继续重试
 		case <-ctx.Done():
+			timer.Stop()
 			return fmt.Errorf("retry cancelled during delay: %w", ctx.Err())
 		}
 	}
 
-	return fmt.Errorf("all %d conditional retries failed, last error: %w", maxRetries+1, lastErr)
+	return fmt.Errorf("all %d attempts failed, last error: %w", r.maxRetries+1, lastErr)
+}
+
+// applyJitter 加随机抖动
+func (r *Retrier) applyJitter(d time.Duration) time.Duration {
+	if r.jitter <= 0 || d <= 0 {
+		return d
+	}
+	delta := (rand.Float64()*2 - 1) * r.jitter * float64(d)
+	return time.Duration(float64(d) + delta)
+}
+
+// RetryValue 带返回值的重试
+//
+// 艹！不用再在闭包外面声明变量接结果了
+//
+//	resp, err := crawlab.RetryValue(ctx, r, func() (*http.Response, error) { return client.Get(ctx, u) })
+func RetryValue[T any](ctx context.Context, r *Retrier, fn func() (T, error)) (T, error) {
+	var result T
+	err := r.Do(ctx, func() error {
+		v, err := fn()
+		if err != nil {
+			return err
+		}
+		result = v
+		return nil
+	})
+	return result, err
+}
+
+// Retry 重试执行函数
+//
+// 艹！失败自动重试，支持固定延迟
+// maxRetries: 最大重试次数（0表示不重试）
+// delay: 每次重试之间的延迟
+func Retry(fn RetryFunc, maxRetries int, delay time.Duration) error {
+	return RetryWithContext(context.Background(), fn, maxRetries, delay)
+}
+
+// RetryWithContext 带Context的重试执行
+//
+// 艹！支持取消和超时
+func RetryWithContext(ctx context.Context, fn RetryFunc, maxRetries int, delay time.Duration) error {
+	return NewRetrier(WithMaxRetries(maxRetries), WithConstantBackoff(delay)).Do(ctx, fn)
+}
+
+// RetryWithBackoff 带指数退避的重试
+//
+// 艹！延迟时间指数增长：delay, delay*2, delay*4, delay*8...
+// maxDelay: 最大延迟时间
+func RetryWithBackoff(ctx context.Context, fn RetryFunc, maxRetries int, initialDelay, maxDelay time.Duration) error {
+	return NewRetrier(WithMaxRetries(maxRetries), WithExponentialBackoff(initialDelay, maxDelay)).Do(ctx, fn)
+}
+
+// RetryIf 条件重试
+//
+// 艹！只有shouldRetry返回true时才重试
+// 用于某些错误不需要重试的场景
+func RetryIf(ctx context.Context, fn RetryFunc, shouldRetry func(error) bool, maxRetries int, delay time.Duration) error {
+	return NewRetrier(WithMaxRetries(maxRetries), WithConstantBackoff(delay), WithRetryIf(shouldRetry)).Do(ctx, fn)
 }
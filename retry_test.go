@@ -0,0 +1,204 @@
+package crawlab
+
+import (
+	"context"
+	"errors"
+	"math"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestExponentialBackoff(t *testing.T) {
+	tests := []struct {
+		name    string
+		initial time.Duration
+		max     time.Duration
+		attempt int
+		want    time.Duration
+	}{
+		{"first attempt", time.Second, time.Minute, 0, time.Second},
+		{"doubles", time.Second, time.Minute, 3, 8 * time.Second},
+		{"capped", time.Second, time.Minute, 10, time.Minute},
+		{"int64 overflow", time.Second, time.Minute, 63, time.Minute},
+		{"float overflow", time.Hour, time.Minute, 2000, time.Minute},
+		{"zero initial never waits", 0, time.Minute, 2000, 0},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := ExponentialBackoff(tt.initial, tt.max)(tt.attempt); got != tt.want {
+				t.Errorf("attempt %d = %v, want %v", tt.attempt, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestRetrierDo(t *testing.T) {
+	errFlaky := errors.New("flaky")
+	errFatal := errors.New("fatal")
+	ms := time.Millisecond
+
+	tests := []struct {
+		name       string
+		opts       []RetryOption
+		errs       []error // 第i次调用返回errs[i]，超出部分返回nil
+		wantCalls  int
+		wantDelays []time.Duration
+		wantErr    error
+		wantMsg    string
+	}{
+		{
+			name:       "succeeds after failures",
+			opts:       []RetryOption{WithConstantBackoff(ms)},
+			errs:       []error{errFlaky, errFlaky},
+			wantCalls:  3,
+			wantDelays: []time.Duration{ms, ms},
+		},
+		{
+			name:       "gives up after max retries",
+			opts:       []RetryOption{WithMaxRetries(2), WithConstantBackoff(ms)},
+			errs:       []error{errFlaky, errFlaky, errFlaky, errFlaky},
+			wantCalls:  3,
+			wantDelays: []time.Duration{ms, ms},
+			wantErr:    errFlaky,
+			wantMsg:    "all 3 attempts failed",
+		},
+		{
+			name:      "permanent error stops at once",
+			opts:      []RetryOption{WithConstantBackoff(ms)},
+			errs:      []error{Permanent(errFatal)},
+			wantCalls: 1,
+			wantErr:   errFatal,
+		},
+		{
+			name:       "delayed error overrides the backoff",
+			opts:       []RetryOption{WithConstantBackoff(time.Hour)},
+			errs:       []error{Delayed(errFlaky, 2*ms)},
+			wantCalls:  2,
+			wantDelays: []time.Duration{2 * ms},
+		},
+		{
+			name:      "retry predicate",
+			opts:      []RetryOption{WithConstantBackoff(ms), WithRetryIf(func(err error) bool { return err == errFlaky })},
+			errs:      []error{errFlaky, errFatal},
+			wantCalls: 2, wantDelays: []time.Duration{ms},
+			wantErr: errFatal,
+		},
+		{
+			name:       "exponential backoff",
+			opts:       []RetryOption{WithExponentialBackoff(ms, 3*ms)},
+			errs:       []error{errFlaky, errFlaky, errFlaky},
+			wantCalls:  4,
+			wantDelays: []time.Duration{ms, 2 * ms, 3 * ms},
+		},
+		{
+			name:      "max elapsed time",
+			opts:      []RetryOption{WithConstantBackoff(time.Hour), WithMaxElapsedTime(time.Minute)},
+			errs:      []error{errFlaky},
+			wantCalls: 1,
+			wantErr:   errFlaky,
+			wantMsg:   "retry gave up",
+		},
+		{
+			name:      "no retries",
+			opts:      []RetryOption{WithMaxRetries(-1)},
+			errs:      []error{errFlaky},
+			wantCalls: 1,
+			wantErr:   errFlaky,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var delays []time.Duration
+			opts := append(tt.opts, WithOnRetry(func(attempt int, err error, delay time.Duration) {
+				if attempt != len(delays)+1 {
+					t.Errorf("OnRetry attempt = %d, want %d", attempt, len(delays)+1)
+				}
+				delays = append(delays, delay)
+			}))
+
+			calls := 0
+			err := NewRetrier(opts...).Do(context.Background(), func() error {
+				calls++
+				if calls <= len(tt.errs) {
+					return tt.errs[calls-1]
+				}
+				return nil
+			})
+
+			if !errors.Is(err, tt.wantErr) || (tt.wantErr == nil) != (err == nil) {
+				t.Fatalf("err = %v, want %v", err, tt.wantErr)
+			}
+			if tt.wantMsg != "" && !strings.Contains(err.Error(), tt.wantMsg) {
+				t.Errorf("err = %v, want it to contain %q", err, tt.wantMsg)
+			}
+			if calls != tt.wantCalls {
+				t.Errorf("calls = %d, want %d", calls, tt.wantCalls)
+			}
+			if !reflect.DeepEqual(delays, tt.wantDelays) {
+				t.Errorf("delays = %v, want %v", delays, tt.wantDelays)
+			}
+		})
+	}
+}
+
+func TestRetrierRandomDelays(t *testing.T) {
+	base, max := 10*time.Millisecond, 100*time.Millisecond
+
+	tests := []struct {
+		name     string
+		opt      RetryOption
+		min, max time.Duration
+	}{
+		{"decorrelated jitter", WithDecorrelatedJitter(base, max), base, max},
+		{"jitter fraction", WithJitter(0.5), 5 * time.Millisecond, 15 * time.Millisecond},
+		{"jitter is clamped to 1", WithJitter(3), 0, 20 * time.Millisecond},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := NewRetrier(WithConstantBackoff(base), tt.opt)
+			var prev time.Duration
+			for i := 0; i < 1000; i++ {
+				d := r.applyJitter(r.nextDelay(i, prev))
+				if d < tt.min || d > tt.max {
+					t.Fatalf("delay %v outside [%v, %v]", d, tt.min, tt.max)
+				}
+				prev = d
+			}
+		})
+	}
+}
+
+func TestRetryValue(t *testing.T) {
+	calls := 0
+	got, err := RetryValue(context.Background(), NewRetrier(WithConstantBackoff(0), WithOnRetry(func(int, error, time.Duration) {})),
+		func() (float64, error) {
+			calls++
+			if calls < 3 {
+				return math.NaN(), errors.New("not yet")
+			}
+			return 1.5, nil
+		})
+	if err != nil || got != 1.5 || calls != 3 {
+		t.Errorf("RetryValue = %v, %v after %d calls, want 1.5 after 3", got, err, calls)
+	}
+}
+
+func TestRetrierCancel(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+
+	start := time.Now()
+	err := NewRetrier(WithConstantBackoff(time.Hour), WithOnRetry(func(int, error, time.Duration) {})).
+		Do(ctx, func() error { return errors.New("down") })
+	if !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("err = %v, want deadline exceeded", err)
+	}
+	if time.Since(start) > time.Second {
+		t.Error("cancel did not interrupt the backoff wait")
+	}
+}
@@ -0,0 +1,433 @@
+// Package robots robots.txt的抓取、解析和检查
+//
+// 艹！用法：
+//
+//	client.SetRobots(robots.NewChecker(client, ""))
+//
+// 被禁止的URL直接返回*robots.DisallowedError，请求不会发出去
+package robots
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/url"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	crawlab "github.com/arschlochnop/cl-sdk-go"
+)
+
+const (
+	// DefaultTTL robots.txt默认缓存时间
+	DefaultTTL = 24 * time.Hour
+
+	// DefaultFetchTimeout 抓robots.txt的超时时间
+	DefaultFetchTimeout = 30 * time.Second
+
+	// errorTTL 抓取失败时的缓存时间，过一会儿再试
+	errorTTL = time.Minute
+
+	// maxSize robots.txt最多读取的字节数（和Google一样500KB）
+	maxSize = 500 * 1024
+)
+
+// ErrDisallowed URL被robots.txt禁止
+var ErrDisallowed = errors.New("disallowed by robots.txt")
+
+// DisallowedError URL被robots.txt禁止时返回的错误
+//
+// 艹！errors.Is(err, robots.ErrDisallowed)判断，errors.As拿到具体规则
+type DisallowedError struct {
+	URL       string // 请求URL
+	UserAgent string // 匹配用的User-Agent
+	Rule      string // 命中的Disallow规则，robots.txt拿不到时为空
+}
+
+// Error 实现error接口
+func (e *DisallowedError) Error() string {
+	if e.Rule == "" {
+		return fmt.Sprintf("%s: %s (robots.txt unavailable)", ErrDisallowed, e.URL)
+	}
+	return fmt.Sprintf("%s: %s (rule %q for %s)", ErrDisallowed, e.URL, e.Rule, e.UserAgent)
+}
+
+// Is 支持errors.Is(err, ErrDisallowed)
+func (e *DisallowedError) Is(target error) bool {
+	return target == ErrDisallowed
+}
+
+// rule 一条Allow/Disallow规则
+type rule struct {
+	allow   bool
+	pattern string
+	re      *regexp.Regexp
+}
+
+// group 一组user-agent和它们的规则
+type group struct {
+	agents     []string
+	rules      []rule
+	crawlDelay time.Duration
+}
+
+// Data 解析后的robots.txt
+type Data struct {
+	Sitemaps []string // Sitemap地址
+
+	groups      []*group
+	disallowAll bool // robots.txt拿不到（5xx、网络错误）时全部禁止
+}
+
+// Parse 解析robots.txt
+//
+// 艹！支持：
+//   - 多个User-agent共用一组规则，同名的组会合并
+//   - Allow/Disallow，支持*通配符和结尾的$
+//   - Crawl-delay（秒，可以是小数）
+//   - Sitemap
+//
+// 不认识的行直接跳过；单行超过500KB读不下去时返回错误，不用读了一半的规则
+func Parse(data []byte) (*Data, error) {
+	r := &Data{}
+	var g *group
+	inRules := false // 当前组是否已经出现过规则，出现过再遇到User-agent就开新组
+
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	scanner.Buffer(make([]byte, 64*1024), maxSize)
+	for scanner.Scan() {
+		line := scanner.Text()
+		if i := strings.IndexByte(line, '#'); i >= 0 {
+			line = line[:i]
+		}
+		key, value, ok := strings.Cut(line, ":")
+		if !ok {
+			continue
+		}
+		key = strings.ToLower(strings.TrimSpace(key))
+		value = strings.TrimSpace(value)
+
+		switch key {
+		case "user-agent":
+			if g == nil || inRules {
+				g = &group{}
+				r.groups = append(r.groups, g)
+				inRules = false
+			}
+			g.agents = append(g.agents, strings.ToLower(value))
+
+		case "allow", "disallow":
+			if g == nil {
+				continue
+			}
+			inRules = true
+			// 空的Disallow表示全部允许，不算规则
+			if value == "" {
+				continue
+			}
+			g.rules = append(g.rules, rule{
+				allow:   key == "allow",
+				pattern: value,
+				re:      compilePattern(value),
+			})
+
+		case "crawl-delay":
+			if g == nil {
+				continue
+			}
+			inRules = true
+			if secs, err := strconv.ParseFloat(value, 64); err == nil && secs >= 0 {
+				g.crawlDelay = time.Duration(secs * float64(time.Second))
+			}
+
+		case "sitemap":
+			r.Sitemaps = append(r.Sitemaps, value)
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("failed to parse robots.txt: %w", err)
+	}
+	return r, nil
+}
+
+// compilePattern 把robots规则转成正则：*匹配任意字符，结尾的$表示精确结尾
+func compilePattern(pattern string) *regexp.Regexp {
+	anchored := strings.HasSuffix(pattern, "$")
+	pattern = strings.TrimSuffix(pattern, "$")
+	expr := "^" + strings.ReplaceAll(regexp.QuoteMeta(pattern), `\*`, ".*")
+	if anchored {
+		expr += "$"
+	}
+	return regexp.MustCompile(expr)
+}
+
+// Allowed 判断userAgent能不能访问path（包含查询参数，例如"/search?q=go"）
+//
+// 艹！最长匹配的规则生效，一样长时Allow优先；/robots.txt本身永远允许
+func (r *Data) Allowed(userAgent, path string) bool {
+	_, ok := r.match(userAgent, path)
+	return ok
+}
+
+// CrawlDelay 返回userAgent对应的Crawl-delay，没设置返回0
+func (r *Data) CrawlDelay(userAgent string) time.Duration {
+	var delay time.Duration
+	for _, g := range r.groupsFor(userAgent) {
+		if g.crawlDelay > delay {
+			delay = g.crawlDelay
+		}
+	}
+	return delay
+}
+
+// match 返回命中的Disallow规则和是否允许
+func (r *Data) match(userAgent, path string) (string, bool) {
+	if r.disallowAll {
+		return "", false
+	}
+	if path == "" {
+		path = "/"
+	}
+	if path == "/robots.txt" {
+		return "", true
+	}
+
+	var best *rule
+	for _, g := range r.groupsFor(userAgent) {
+		for i := range g.rules {
+			ru := &g.rules[i]
+			if !ru.re.MatchString(path) {
+				continue
+			}
+			if best == nil || len(ru.pattern) > len(best.pattern) ||
+				(len(ru.pattern) == len(best.pattern) && ru.allow && !best.allow) {
+				best = ru
+			}
+		}
+	}
+
+	if best == nil || best.allow {
+		return "", true
+	}
+	return best.pattern, false
+}
+
+// groupsFor 找userAgent对应的组
+//
+// 艹！User-agent名字出现在我们的UA里就算匹配，取最长的名字；一个都没匹配上才用*
+func (r *Data) groupsFor(userAgent string) []*group {
+	ua := strings.ToLower(userAgent)
+	best := ""
+	for _, g := range r.groups {
+		for _, a := range g.agents {
+			if a != "*" && a != "" && strings.Contains(ua, a) && len(a) > len(best) {
+				best = a
+			}
+		}
+	}
+	if best == "" {
+		best = "*"
+	}
+
+	var groups []*group
+	for _, g := range r.groups {
+		for _, a := range g.agents {
+			if a == best {
+				groups = append(groups, g)
+				break
+			}
+		}
+	}
+	return groups
+}
+
+// entry 缓存的robots.txt
+type entry struct {
+	ready   chan struct{} // 抓取完成后关闭
+	data    *Data
+	expires time.Time
+}
+
+// Checker robots.txt检查器，实现crawlab.RobotsChecker
+//
+// 艹！按scheme+host抓取并缓存/robots.txt，并发请求同一个host只抓一次
+//   - 2xx：按内容解析
+//   - 4xx：当作没有robots.txt，全部允许
+//   - 5xx、网络错误、超时：全部禁止，1分钟后重试
+//
+// 抓取不跟着调用方的ctx走，第一个调用方取消了也不会让其他人拿到"全部禁止"
+type Checker struct {
+	Client       *crawlab.HTTPClient // 抓robots.txt用的客户端
+	UserAgent    string              // 匹配规则用的User-Agent
+	TTL          time.Duration       // 缓存时间（默认24小时）
+	FetchTimeout time.Duration       // 抓取超时（默认30秒）
+
+	// Limiter 非nil时把Crawl-delay设置给它
+	Limiter *crawlab.RateLimiter
+
+	mu    sync.Mutex
+	cache map[string]*entry
+}
+
+// NewChecker 创建robots.txt检查器
+//
+// 艹！robots.txt用client克隆出来的客户端抓（不会自己检查自己），Crawl-delay设置给client的Limiter
+// userAgent为空时用client.Headers里的User-Agent；要设置限流器的话先SetRateLimiter再创建
+func NewChecker(client *crawlab.HTTPClient, userAgent string) *Checker {
+	if userAgent == "" {
+		userAgent = client.Headers["User-Agent"]
+	}
+	fetcher := client.Clone()
+	fetcher.Robots = nil
+
+	return &Checker{
+		Client:       fetcher,
+		UserAgent:    userAgent,
+		TTL:          DefaultTTL,
+		FetchTimeout: DefaultFetchTimeout,
+		Limiter:      client.Limiter,
+		cache:        make(map[string]*entry),
+	}
+}
+
+// Check 检查URL是否允许访问，不允许时返回*DisallowedError
+func (c *Checker) Check(ctx context.Context, rawURL string) error {
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return fmt.Errorf("invalid URL %q: %w", rawURL, err)
+	}
+	return c.check(ctx, u)
+}
+
+// Allowed 判断URL是否允许访问
+func (c *Checker) Allowed(ctx context.Context, rawURL string) (bool, error) {
+	err := c.Check(ctx, rawURL)
+	if errors.Is(err, ErrDisallowed) {
+		return false, nil
+	}
+	return err == nil, err
+}
+
+// check 检查已解析的URL
+func (c *Checker) check(ctx context.Context, u *url.URL) error {
+	if u.Scheme != "http" && u.Scheme != "https" {
+		return nil
+	}
+
+	data, err := c.Get(ctx, u.Scheme, u.Host)
+	if err != nil {
+		return err
+	}
+
+	path := u.EscapedPath()
+	if u.RawQuery != "" {
+		path += "?" + u.RawQuery
+	}
+	if rule, ok := data.match(c.UserAgent, path); !ok {
+		return &DisallowedError{URL: u.String(), UserAgent: c.UserAgent, Rule: rule}
+	}
+	return nil
+}
+
+// Get 获取host的robots.txt，有缓存用缓存
+//
+// 艹！只有ctx取消时返回错误，抓取失败按上面的规则处理
+func (c *Checker) Get(ctx context.Context, scheme, host string) (*Data, error) {
+	key := scheme + "://" + host
+
+	c.mu.Lock()
+	if c.cache == nil {
+		c.cache = make(map[string]*entry)
+	}
+	e, ok := c.cache[key]
+	if ok {
+		select {
+		case <-e.ready:
+			if time.Now().After(e.expires) {
+				ok = false
+			}
+		default:
+		}
+	}
+	if !ok {
+		e = &entry{ready: make(chan struct{})}
+		c.cache[key] = e
+		// 后台抓，谁先来都一样只是等
+		go c.fetch(ctx, key, host, e)
+	}
+	c.mu.Unlock()
+
+	select {
+	case <-e.ready:
+		return e.data, nil
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+}
+
+// fetch 抓取robots.txt并填充e
+//
+// 艹！保留ctx里的值，但去掉取消，只受FetchTimeout限制
+func (c *Checker) fetch(ctx context.Context, key, host string, e *entry) {
+	ttl := c.TTL
+	if ttl <= 0 {
+		ttl = DefaultTTL
+	}
+	timeout := c.FetchTimeout
+	if timeout <= 0 {
+		timeout = DefaultFetchTimeout
+	}
+
+	ctx, cancel := context.WithTimeout(context.WithoutCancel(ctx), timeout)
+	defer cancel()
+
+	data, err := c.download(ctx, key+"/robots.txt")
+	if err != nil {
+		crawlab.LogWarn("Failed to fetch %s/robots.txt: %v, disallowing all", key, err)
+		data = &Data{disallowAll: true}
+		ttl = errorTTL
+	}
+
+	if c.Limiter != nil {
+		if delay := data.CrawlDelay(c.UserAgent); delay > 0 {
+			crawlab.LogInfo("Crawl-delay for %s: %v", host, delay)
+			c.Limiter.SetCrawlDelay(host, delay)
+		}
+	}
+
+	e.data = data
+	e.expires = time.Now().Add(ttl)
+	close(e.ready)
+}
+
+// download 下载并解析robots.txt
+func (c *Checker) download(ctx context.Context, robotsURL string) (*Data, error) {
+	resp, err := c.Client.Get(ctx, robotsURL)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	switch {
+	case resp.StatusCode >= 500:
+		return nil, fmt.Errorf("robots.txt returned HTTP %s", resp.Status)
+	case resp.StatusCode >= 400:
+		// 没有robots.txt，全部允许
+		return &Data{}, nil
+	case resp.StatusCode >= 300:
+		// 重定向太多才会走到这里
+		return nil, fmt.Errorf("robots.txt returned HTTP %s", resp.Status)
+	}
+
+	body, err := io.ReadAll(io.LimitReader(resp.Body, maxSize))
+	if err != nil {
+		return nil, fmt.Errorf("failed to read robots.txt: %w", err)
+	}
+	return Parse(body)
+}
@@ -0,0 +1,137 @@
+package robots
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	crawlab "github.com/arschlochnop/cl-sdk-go"
+)
+
+const testRobots = `
+# 注释
+User-agent: *
+Disallow: /private/
+Allow: /private/public
+Disallow: /*.pdf$
+Crawl-delay: 1.5
+
+User-agent: BadBot
+User-agent: WorseBot
+Disallow: /
+
+Sitemap: https://example.com/sitemap.xml
+`
+
+func TestParseAllowed(t *testing.T) {
+	data, err := Parse([]byte(testRobots))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		ua, path string
+		want     bool
+	}{
+		{"MyCrawler/1.0", "/", true},
+		{"MyCrawler/1.0", "/private/secret", false},
+		{"MyCrawler/1.0", "/private/public/page", true},
+		{"MyCrawler/1.0", "/docs/a.pdf", false},
+		{"MyCrawler/1.0", "/docs/a.pdf?x=1", true},
+		{"MyCrawler/1.0", "", true},
+		{"BadBot/2.0", "/anything", false},
+		{"worsebot", "/anything", false},
+		{"BadBot/2.0", "/robots.txt", true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.ua+tt.path, func(t *testing.T) {
+			if got := data.Allowed(tt.ua, tt.path); got != tt.want {
+				t.Errorf("Allowed(%q, %q) = %v, want %v", tt.ua, tt.path, got, tt.want)
+			}
+		})
+	}
+
+	if d := data.CrawlDelay("MyCrawler"); d != 1500*time.Millisecond {
+		t.Errorf("CrawlDelay = %v, want 1.5s", d)
+	}
+	if len(data.Sitemaps) != 1 || data.Sitemaps[0] != "https://example.com/sitemap.xml" {
+		t.Errorf("Sitemaps = %v", data.Sitemaps)
+	}
+}
+
+func TestParseTooLongLine(t *testing.T) {
+	line := "Disallow: /" + strings.Repeat("a", maxSize)
+	if _, err := Parse([]byte("User-agent: *\n" + line)); err == nil {
+		t.Fatal("Parse accepted a line longer than the limit")
+	}
+}
+
+func TestCheckerStatus(t *testing.T) {
+	tests := []struct {
+		name    string
+		status  int
+		body    string
+		path    string
+		wantErr error
+	}{
+		{"disallowed", 200, "User-agent: *\nDisallow: /admin", "/admin", ErrDisallowed},
+		{"allowed", 200, "User-agent: *\nDisallow: /admin", "/page", nil},
+		{"not found allows all", 404, "", "/admin", nil},
+		{"server error disallows all", 500, "", "/page", ErrDisallowed},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				w.WriteHeader(tt.status)
+				w.Write([]byte(tt.body))
+			}))
+			defer srv.Close()
+
+			c := NewChecker(crawlab.NewHTTPClient(5*time.Second), "TestBot")
+			err := c.Check(context.Background(), srv.URL+tt.path)
+			if !errors.Is(err, tt.wantErr) {
+				t.Errorf("Check = %v, want %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestCheckerCancelledCallerDoesNotPoisonCache(t *testing.T) {
+	release := make(chan struct{})
+	var hits int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&hits, 1)
+		<-release
+		w.Write([]byte("User-agent: *\nDisallow: /admin"))
+	}))
+	defer srv.Close()
+
+	c := NewChecker(crawlab.NewHTTPClient(5*time.Second), "TestBot")
+
+	// 第一个调用方等不及先走了
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	if err := c.Check(ctx, srv.URL+"/page"); !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("Check = %v, want deadline exceeded", err)
+	}
+
+	close(release)
+
+	// 后来的调用方拿到的是真实规则，不是"全部禁止"
+	if err := c.Check(context.Background(), srv.URL+"/page"); err != nil {
+		t.Errorf("Check after cancelled caller = %v, want nil", err)
+	}
+	if err := c.Check(context.Background(), srv.URL+"/admin"); !errors.Is(err, ErrDisallowed) {
+		t.Errorf("Check /admin = %v, want ErrDisallowed", err)
+	}
+	if n := atomic.LoadInt32(&hits); n != 1 {
+		t.Errorf("robots.txt fetched %d times, want 1", n)
+	}
+}
@@ -36,77 +36,106 @@ func SaveItem(item interface{}) error {
 //
 // 艹！每条数据单独发送，适合少量数据
 // 如果数据量大，用SaveBatch批量发送
+// 设置了全局去重器时，重复数据会被跳过
 func SaveItems(items ...interface{}) error {
 	for _, item := range items {
-		// 检查数据大小
-		data, err := json.Marshal(item)
+		ticket, dup, err := reserveGlobal(item)
 		if err != nil {
-			return fmt.Errorf("failed to marshal item: %w", err)
+			return err
 		}
-
-		// 如果数据太大，输出警告
-		if len(data) > MaxIPCMessageSize {
-			LogWarn("Item size (%d bytes) exceeds recommended limit (%d bytes)", len(data), MaxIPCMessageSize)
-			LogWarn("Consider splitting large data or using external storage")
+		if dup {
+			continue
 		}
 
-		if err := sendIPCMessage("data", item); err != nil {
-			return fmt.Errorf("failed to save item: %w", err)
+		// 发送成功才记下去重键，失败的数据下次还能保存
+		err = saveItem(item)
+		ticket.done(err)
+		if err != nil {
+			return err
 		}
 	}
 	return nil
 }
 
+// saveItem 发送单条数据，不做去重
+func saveItem(item interface{}) error {
+	// 检查数据大小
+	data, err := json.Marshal(item)
+	if err != nil {
+		return fmt.Errorf("failed to marshal item: %w", err)
+	}
+
+	// 如果数据太大，输出警告
+	if len(data) > MaxIPCMessageSize {
+		LogWarn("Item size (%d bytes) exceeds recommended limit (%d bytes)", len(data), MaxIPCMessageSize)
+		LogWarn("Consider splitting large data or using external storage")
+	}
+
+	if err := sendIPCMessage("data", item); err != nil {
+		return fmt.Errorf("failed to save item: %w", err)
+	}
+	return nil
+}
+
 // SaveBatch 批量保存数据（发送数组）
 //
 // 艹！一次发送整个数组，减少IPC次数，性能更好
-// 适合大量数据，但注意总大小不要超过5MB
+// 总大小超过5MB时自动拆成多批发送，不会被Runner丢掉
+// 设置了全局去重器时，重复数据会被跳过
 func SaveBatch(items []interface{}) error {
 	if len(items) == 0 {
 		return nil
 	}
 
-	// 检查批次总大小
-	data, err := json.Marshal(items)
-	if err != nil {
-		return fmt.Errorf("failed to marshal batch: %w", err)
-	}
-
-	if len(data) > MaxIPCMessageSize {
-		LogWarn("Batch size (%d bytes) exceeds recommended limit (%d bytes)", len(data), MaxIPCMessageSize)
-		LogWarn("Consider splitting into smaller batches")
+	w := NewBatchWriter(0, 0)
+	for _, item := range items {
+		ticket, dup, err := reserveGlobal(item)
+		if err == nil && !dup {
+			err = w.add(item, ticket)
+		}
+		if err != nil {
+			// 已经进缓冲区的照常发完，它们的去重键也要有个结果
+			if cerr := w.Close(); cerr != nil {
+				LogError("Failed to flush batch: %v", cerr)
+			}
+			return err
+		}
 	}
-
-	return sendIPCMessage("data", items)
+	return w.Close()
 }
 
 // Log 输出日志到stderr（会被Runner捕获为任务日志）
 //
-// 艹！基础日志输出
+// 艹！基础日志输出，不带级别标签，按INFO级别过滤
 func Log(format string, args ...interface{}) {
-	fmt.Fprintf(os.Stderr, "[Crawlab] "+format+"\n", args...)
+	l := GetLogger()
+	if l.Enabled(LevelInfo) {
+		l.log(LevelInfo, false, fmt.Sprintf(format, args...), nil)
+	}
 }
 
 // LogInfo 输出INFO级别日志
 func LogInfo(format string, args ...interface{}) {
-	fmt.Fprintf(os.Stderr, "[Crawlab] [INFO] "+format+"\n", args...)
+	GetLogger().Logf(LevelInfo, format, args...)
 }
 
 // LogError 输出ERROR级别日志
 //
 // 艹！出错了就用这个
 func LogError(format string, args ...interface{}) {
-	fmt.Fprintf(os.Stderr, "[Crawlab] [ERROR] "+format+"\n", args...)
+	GetLogger().Logf(LevelError, format, args...)
 }
 
 // LogWarn 输出WARNING级别日志
 func LogWarn(format string, args ...interface{}) {
-	fmt.Fprintf(os.Stderr, "[Crawlab] [WARN] "+format+"\n", args...)
+	GetLogger().Logf(LevelWarn, format, args...)
 }
 
 // LogDebug 输出DEBUG级别日志
+//
+// 艹！默认级别是INFO，设置CRAWLAB_LOG_LEVEL=debug才会输出
 func LogDebug(format string, args ...interface{}) {
-	fmt.Fprintf(os.Stderr, "[Crawlab] [DEBUG] "+format+"\n", args...)
+	GetLogger().Logf(LevelDebug, format, args...)
 }
 
 // GetTaskID 从环境变量获取当前任务ID
@@ -171,21 +200,13 @@ func ParseParamJSON(v interface{}) error {
 	return nil
 }
 
-// sendIPCMessage 发送IPC消息到stdout
+// sendIPCMessage 通过当前传输通道发送IPC消息
 //
 // 艹！内部函数，别直接用
 func sendIPCMessage(msgType string, payload interface{}) error {
-	ipcMsg := IPCMessage{
+	return SendIPCMessage(IPCMessage{
 		IPC:     true,
 		Type:    msgType,
 		Payload: payload,
-	}
-
-	data, err := json.Marshal(ipcMsg)
-	if err != nil {
-		return fmt.Errorf("failed to marshal IPC message: %w", err)
-	}
-
-	fmt.Println(string(data))
-	return nil
+	})
 }
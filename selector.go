@@ -0,0 +1,622 @@
+package crawlab
+
+import (
+	"container/list"
+	"fmt"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// Selector 编译好的CSS选择器
+//
+// 艹！支持的语法：
+//   - 标签、*、#id、.class
+//   - [attr]、[attr=v]、[attr~=v]、[attr|=v]、[attr^=v]、[attr$=v]、[attr*=v]
+//   - 后代（空格）、子元素（>）、相邻兄弟（+）、后续兄弟（~）
+//   - :nth-child(an+b)、:nth-last-child()、:first-child、:last-child、:only-child、:not(...)
+//   - 逗号分隔的多个选择器
+type Selector struct {
+	text   string
+	groups []complexSelector
+}
+
+// complexSelector 用组合器连起来的一串复合选择器
+type complexSelector struct {
+	parts       []compoundSelector
+	combinators []byte // combinators[i]连接parts[i]和parts[i+1]
+}
+
+// compoundSelector 一个元素要同时满足的条件，例如a.link[href]
+type compoundSelector struct {
+	tag     string // 空表示任意标签
+	id      string
+	classes []string
+	attrs   []attrSelector
+	pseudos []pseudoSelector
+}
+
+// attrSelector 属性条件
+type attrSelector struct {
+	key, op, val string // op为空表示只要有这个属性
+}
+
+// pseudoSelector 伪类
+type pseudoSelector struct {
+	name string
+	a, b int       // nth-child的an+b
+	not  *Selector // :not()的参数
+}
+
+// maxCachedSelectors Find/First/Is缓存的选择器个数上限
+//
+// 艹！选择器是拼出来的（比如带ID）就会越攒越多，超过上限淘汰最久没用的
+const maxCachedSelectors = 512
+
+var (
+	selectorCacheMu    sync.Mutex
+	selectorCache      = make(map[string]*list.Element)
+	selectorCacheOrder = list.New() // 最近用过的在前面，元素是*Selector
+)
+
+// CompileSelector 编译CSS选择器
+func CompileSelector(selector string) (*Selector, error) {
+	p := &selectorParser{s: selector}
+	groups, err := p.parseGroups()
+	if err == nil && p.i < len(p.s) {
+		err = fmt.Errorf("unexpected %q at offset %d", p.s[p.i], p.i)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("invalid selector %q: %w", selector, err)
+	}
+	return &Selector{text: selector, groups: groups}, nil
+}
+
+// MustCompileSelector 编译CSS选择器，语法错误直接panic
+func MustCompileSelector(selector string) *Selector {
+	sel, err := CompileSelector(selector)
+	if err != nil {
+		panic(err)
+	}
+	return sel
+}
+
+// String 返回原始的选择器字符串
+func (s *Selector) String() string {
+	return s.text
+}
+
+// cachedSelector 编译并缓存选择器，语法错误打WARN并返回nil
+func cachedSelector(selector string) *Selector {
+	selectorCacheMu.Lock()
+	if el, ok := selectorCache[selector]; ok {
+		selectorCacheOrder.MoveToFront(el)
+		selectorCacheMu.Unlock()
+		return el.Value.(*Selector)
+	}
+	selectorCacheMu.Unlock()
+
+	sel, err := CompileSelector(selector)
+	if err != nil {
+		LogWarn("%v", err)
+		return nil
+	}
+
+	selectorCacheMu.Lock()
+	defer selectorCacheMu.Unlock()
+	if _, ok := selectorCache[selector]; !ok {
+		selectorCache[selector] = selectorCacheOrder.PushFront(sel)
+		if selectorCacheOrder.Len() > maxCachedSelectors {
+			oldest := selectorCacheOrder.Back()
+			selectorCacheOrder.Remove(oldest)
+			delete(selectorCache, oldest.Value.(*Selector).text)
+		}
+	}
+	return sel
+}
+
+// Match 元素是否匹配选择器
+func (s *Selector) Match(n *Node) bool {
+	if n == nil || n.Type != ElementNode {
+		return false
+	}
+	for _, g := range s.groups {
+		if g.match(n, len(g.parts)-1) {
+			return true
+		}
+	}
+	return false
+}
+
+// MatchAll 找出n下面所有匹配的元素（不含n本身），按文档顺序
+func (s *Selector) MatchAll(n *Node) []*Node {
+	var found []*Node
+	s.walk(n, func(c *Node) bool {
+		found = append(found, c)
+		return true
+	})
+	return found
+}
+
+// MatchFirst 找出n下面第一个匹配的元素，没有返回nil
+func (s *Selector) MatchFirst(n *Node) *Node {
+	var found *Node
+	s.walk(n, func(c *Node) bool {
+		found = c
+		return false
+	})
+	return found
+}
+
+// walk 按文档顺序遍历n的后代，fn返回false时停止
+func (s *Selector) walk(n *Node, fn func(*Node) bool) bool {
+	if n == nil {
+		return true
+	}
+	for _, c := range n.Children {
+		if c.Type != ElementNode {
+			continue
+		}
+		if s.Match(c) && !fn(c) {
+			return false
+		}
+		if !s.walk(c, fn) {
+			return false
+		}
+	}
+	return true
+}
+
+// Find 找出所有匹配CSS选择器的后代元素
+//
+// 艹！选择器写错了打WARN返回nil，想要错误就先用CompileSelector
+func (n *Node) Find(selector string) []*Node {
+	sel := cachedSelector(selector)
+	if sel == nil {
+		return nil
+	}
+	return sel.MatchAll(n)
+}
+
+// First 找出第一个匹配CSS选择器的后代元素，没有返回nil
+//
+// 艹！返回的nil照样能调Text()、Attr()，链式调用不用判空
+func (n *Node) First(selector string) *Node {
+	sel := cachedSelector(selector)
+	if sel == nil {
+		return nil
+	}
+	return sel.MatchFirst(n)
+}
+
+// Is 元素是否匹配CSS选择器
+func (n *Node) Is(selector string) bool {
+	sel := cachedSelector(selector)
+	return sel != nil && sel.Match(n)
+}
+
+// match 从右往左匹配parts[:i+1]
+func (cs complexSelector) match(n *Node, i int) bool {
+	if !cs.parts[i].match(n) {
+		return false
+	}
+	if i == 0 {
+		return true
+	}
+
+	switch cs.combinators[i-1] {
+	case '>':
+		p := n.Parent
+		return p != nil && p.Type == ElementNode && cs.match(p, i-1)
+	case '+':
+		prev := prevElement(n)
+		return prev != nil && cs.match(prev, i-1)
+	case '~':
+		// 脱离文档树的元素没有兄弟
+		if n.Parent == nil {
+			return false
+		}
+		for _, c := range n.Parent.Children {
+			if c == n {
+				return false
+			}
+			if c.Type == ElementNode && cs.match(c, i-1) {
+				return true
+			}
+		}
+		return false
+	default:
+		for p := n.Parent; p != nil && p.Type == ElementNode; p = p.Parent {
+			if cs.match(p, i-1) {
+				return true
+			}
+		}
+		return false
+	}
+}
+
+// match 匹配单个元素
+func (c *compoundSelector) match(n *Node) bool {
+	if c.tag != "" && c.tag != n.Tag {
+		return false
+	}
+	if c.id != "" && n.Attr("id") != c.id {
+		return false
+	}
+	for _, class := range c.classes {
+		if !n.HasClass(class) {
+			return false
+		}
+	}
+	for _, a := range c.attrs {
+		if !a.match(n) {
+			return false
+		}
+	}
+	for _, p := range c.pseudos {
+		if !p.match(n) {
+			return false
+		}
+	}
+	return true
+}
+
+// match 匹配属性
+func (a attrSelector) match(n *Node) bool {
+	v, ok := n.attr(a.key)
+	if !ok {
+		return false
+	}
+	switch a.op {
+	case "":
+		return true
+	case "=":
+		return v == a.val
+	case "~=":
+		for _, f := range strings.Fields(v) {
+			if f == a.val {
+				return true
+			}
+		}
+		return false
+	case "|=":
+		return v == a.val || strings.HasPrefix(v, a.val+"-")
+	case "^=":
+		return a.val != "" && strings.HasPrefix(v, a.val)
+	case "$=":
+		return a.val != "" && strings.HasSuffix(v, a.val)
+	case "*=":
+		return a.val != "" && strings.Contains(v, a.val)
+	}
+	return false
+}
+
+// match 匹配伪类
+func (p pseudoSelector) match(n *Node) bool {
+	switch p.name {
+	case "not":
+		return !p.not.Match(n)
+	case "only-child":
+		_, count := elementPosition(n)
+		return count == 1
+	case "last-child":
+		i, count := elementPosition(n)
+		return i == count
+	case "nth-last-child":
+		i, count := elementPosition(n)
+		return nthMatch(p.a, p.b, count-i+1)
+	default: // nth-child，first-child就是nth-child(1)
+		i, _ := elementPosition(n)
+		return nthMatch(p.a, p.b, i)
+	}
+}
+
+// elementPosition 元素在兄弟元素里排第几（从1开始）和兄弟元素总数
+func elementPosition(n *Node) (index, count int) {
+	if n.Parent == nil {
+		return 1, 1
+	}
+	for _, c := range n.Parent.Children {
+		if c.Type != ElementNode {
+			continue
+		}
+		count++
+		if c == n {
+			index = count
+		}
+	}
+	return index, count
+}
+
+// nthMatch 第i个（从1开始）是否满足an+b
+func nthMatch(a, b, i int) bool {
+	if a == 0 {
+		return i == b
+	}
+	d := i - b
+	return d%a == 0 && d/a >= 0
+}
+
+// prevElement 前一个兄弟元素
+func prevElement(n *Node) *Node {
+	if n.Parent == nil {
+		return nil
+	}
+	var prev *Node
+	for _, c := range n.Parent.Children {
+		if c == n {
+			return prev
+		}
+		if c.Type == ElementNode {
+			prev = c
+		}
+	}
+	return nil
+}
+
+// selectorParser CSS选择器解析器
+type selectorParser struct {
+	s string
+	i int
+}
+
+// parseGroups 解析逗号分隔的选择器
+func (p *selectorParser) parseGroups() ([]complexSelector, error) {
+	var groups []complexSelector
+	for {
+		p.skipSpace()
+		g, err := p.parseComplex()
+		if err != nil {
+			return nil, err
+		}
+		groups = append(groups, g)
+
+		p.skipSpace()
+		if p.i >= len(p.s) || p.s[p.i] == ')' {
+			return groups, nil
+		}
+		if p.s[p.i] != ',' {
+			return nil, fmt.Errorf("unexpected %q at offset %d", p.s[p.i], p.i)
+		}
+		p.i++
+	}
+}
+
+// parseComplex 解析用组合器连起来的选择器
+func (p *selectorParser) parseComplex() (complexSelector, error) {
+	var cs complexSelector
+	for {
+		c, err := p.parseCompound()
+		if err != nil {
+			return cs, err
+		}
+		cs.parts = append(cs.parts, c)
+
+		hadSpace := p.skipSpace()
+		if p.i >= len(p.s) || p.s[p.i] == ',' || p.s[p.i] == ')' {
+			return cs, nil
+		}
+		switch comb := p.s[p.i]; comb {
+		case '>', '+', '~':
+			p.i++
+			p.skipSpace()
+			cs.combinators = append(cs.combinators, comb)
+		default:
+			if !hadSpace {
+				return cs, fmt.Errorf("unexpected %q at offset %d", p.s[p.i], p.i)
+			}
+			cs.combinators = append(cs.combinators, ' ')
+		}
+	}
+}
+
+// parseCompound 解析复合选择器
+func (p *selectorParser) parseCompound() (compoundSelector, error) {
+	var c compoundSelector
+	start := p.i
+
+	if p.i < len(p.s) && p.s[p.i] == '*' {
+		p.i++
+	} else if name := p.ident(); name != "" {
+		c.tag = strings.ToLower(name)
+	}
+
+	for p.i < len(p.s) {
+		switch p.s[p.i] {
+		case '#':
+			p.i++
+			if c.id = p.ident(); c.id == "" {
+				return c, fmt.Errorf("expected id at offset %d", p.i)
+			}
+		case '.':
+			p.i++
+			class := p.ident()
+			if class == "" {
+				return c, fmt.Errorf("expected class name at offset %d", p.i)
+			}
+			c.classes = append(c.classes, class)
+		case '[':
+			a, err := p.parseAttr()
+			if err != nil {
+				return c, err
+			}
+			c.attrs = append(c.attrs, a)
+		case ':':
+			ps, err := p.parsePseudo()
+			if err != nil {
+				return c, err
+			}
+			c.pseudos = append(c.pseudos, ps)
+		default:
+			if p.i == start {
+				return c, fmt.Errorf("expected selector at offset %d", p.i)
+			}
+			return c, nil
+		}
+	}
+	if p.i == start {
+		return c, fmt.Errorf("expected selector at offset %d", p.i)
+	}
+	return c, nil
+}
+
+// parseAttr 解析[attr op value]
+func (p *selectorParser) parseAttr() (attrSelector, error) {
+	var a attrSelector
+	p.i++ // [
+	p.skipSpace()
+	if a.key = strings.ToLower(p.ident()); a.key == "" {
+		return a, fmt.Errorf("expected attribute name at offset %d", p.i)
+	}
+	p.skipSpace()
+	if p.i >= len(p.s) {
+		return a, fmt.Errorf("unterminated attribute selector")
+	}
+	if p.s[p.i] == ']' {
+		p.i++
+		return a, nil
+	}
+
+	if p.s[p.i] == '=' {
+		a.op = "="
+		p.i++
+	} else if p.i+1 < len(p.s) && p.s[p.i+1] == '=' && strings.IndexByte("~|^$*", p.s[p.i]) >= 0 {
+		a.op = p.s[p.i : p.i+2]
+		p.i += 2
+	} else {
+		return a, fmt.Errorf("unexpected %q at offset %d", p.s[p.i], p.i)
+	}
+
+	p.skipSpace()
+	if p.i < len(p.s) && (p.s[p.i] == '"' || p.s[p.i] == '\'') {
+		q := p.s[p.i]
+		end := strings.IndexByte(p.s[p.i+1:], q)
+		if end < 0 {
+			return a, fmt.Errorf("unterminated string at offset %d", p.i)
+		}
+		a.val = p.s[p.i+1 : p.i+1+end]
+		p.i += end + 2
+	} else {
+		a.val = p.ident()
+	}
+
+	p.skipSpace()
+	// 忽略大小写标记[attr=v i]不支持，直接报错，省得以为生效了
+	if p.i >= len(p.s) || p.s[p.i] != ']' {
+		return a, fmt.Errorf("expected ] at offset %d", p.i)
+	}
+	p.i++
+	return a, nil
+}
+
+// parsePseudo 解析伪类
+func (p *selectorParser) parsePseudo() (pseudoSelector, error) {
+	p.i++ // :
+	ps := pseudoSelector{name: strings.ToLower(p.ident())}
+
+	switch ps.name {
+	case "first-child":
+		ps.a, ps.b = 0, 1
+		return ps, nil
+	case "last-child", "only-child":
+		return ps, nil
+	case "nth-child", "nth-last-child", "not":
+	default:
+		return ps, fmt.Errorf("unsupported pseudo-class :%s", ps.name)
+	}
+
+	if p.i >= len(p.s) || p.s[p.i] != '(' {
+		return ps, fmt.Errorf("expected ( after :%s", ps.name)
+	}
+	p.i++
+
+	if ps.name == "not" {
+		groups, err := p.parseGroups()
+		if err != nil {
+			return ps, err
+		}
+		ps.not = &Selector{groups: groups}
+	} else {
+		end := strings.IndexByte(p.s[p.i:], ')')
+		if end < 0 {
+			return ps, fmt.Errorf("unterminated :%s", ps.name)
+		}
+		a, b, err := parseNth(p.s[p.i : p.i+end])
+		if err != nil {
+			return ps, err
+		}
+		ps.a, ps.b = a, b
+		p.i += end
+	}
+
+	if p.i >= len(p.s) || p.s[p.i] != ')' {
+		return ps, fmt.Errorf("expected ) at offset %d", p.i)
+	}
+	p.i++
+	return ps, nil
+}
+
+// parseNth 解析an+b、odd、even
+func parseNth(s string) (a, b int, err error) {
+	s = strings.ToLower(strings.Join(strings.Fields(s), ""))
+	switch s {
+	case "odd":
+		return 2, 1, nil
+	case "even":
+		return 2, 0, nil
+	}
+
+	n := strings.IndexByte(s, 'n')
+	if n < 0 {
+		b, err = strconv.Atoi(s)
+		if err != nil {
+			return 0, 0, fmt.Errorf("invalid nth expression %q", s)
+		}
+		return 0, b, nil
+	}
+
+	switch coef := s[:n]; coef {
+	case "", "+":
+		a = 1
+	case "-":
+		a = -1
+	default:
+		if a, err = strconv.Atoi(coef); err != nil {
+			return 0, 0, fmt.Errorf("invalid nth expression %q", s)
+		}
+	}
+	if rest := strings.TrimPrefix(s[n+1:], "+"); rest != "" {
+		if b, err = strconv.Atoi(rest); err != nil {
+			return 0, 0, fmt.Errorf("invalid nth expression %q", s)
+		}
+	}
+	return a, b, nil
+}
+
+// ident 读取标识符（字母、数字、-、_、非ASCII字符和\转义）
+func (p *selectorParser) ident() string {
+	var b strings.Builder
+	for p.i < len(p.s) {
+		c := p.s[p.i]
+		switch {
+		case c == '\\' && p.i+1 < len(p.s):
+			b.WriteByte(p.s[p.i+1])
+			p.i += 2
+		case c == '-' || c == '_' || c >= 0x80 || isASCIILetter(c) || (c >= '0' && c <= '9'):
+			b.WriteByte(c)
+			p.i++
+		default:
+			return b.String()
+		}
+	}
+	return b.String()
+}
+
+// skipSpace 跳过空白，返回有没有跳过
+func (p *selectorParser) skipSpace() bool {
+	start := p.i
+	for p.i < len(p.s) && isSpace(p.s[p.i]) {
+		p.i++
+	}
+	return p.i > start
+}
@@ -0,0 +1,105 @@
+package crawlab
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+)
+
+const selectorTestHTML = `
+<div id="main" class="content wide">
+  <h1>Title</h1>
+  <ul class="items">
+    <li class="item first"><a href="/a" data-id="1">A</a></li>
+    <li class="item"><a href="/b" data-id="2" lang="en-US">B</a></li>
+    <li class="item last"><a href="https://x.com/c" data-id="3">C</a></li>
+  </ul>
+  <p>one</p>
+  <span>s1</span>
+  <p>two</p>
+</div>`
+
+// texts 取所有节点的文本，方便比较
+func texts(nodes []*Node) string {
+	out := make([]string, len(nodes))
+	for i, n := range nodes {
+		out[i] = n.Text()
+	}
+	return strings.Join(out, ",")
+}
+
+func TestSelectorFind(t *testing.T) {
+	doc := ParseHTML(selectorTestHTML)
+
+	tests := []struct {
+		selector string
+		want     string
+	}{
+		{"h1", "Title"},
+		{"#main > h1", "Title"},
+		{"li.item.first a", "A"},
+		{"ul > li > a", "A,B,C"},
+		{"div a", "A,B,C"},
+		{"a[data-id=2]", "B"},
+		{`a[href^="https://"]`, "C"},
+		{`a[href$="/b"]`, "B"},
+		{`a[href*=x]`, "C"},
+		{"a[lang|=en]", "B"},
+		{"div[class~=wide] > h1", "Title"},
+		{"li:first-child a", "A"},
+		{"li:last-child a", "C"},
+		{"li:nth-child(2n+1) a", "A,C"},
+		{"li:nth-last-child(1) a", "C"},
+		{"li:not(.first) a", "B,C"},
+		{"h1 + ul > li.first", "A"},
+		{"h1 ~ p", "one,two"},
+		{"span + p", "two"},
+		{"h1, span", "Title,s1"},
+		{"table", ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.selector, func(t *testing.T) {
+			if got := texts(doc.Find(tt.selector)); got != tt.want {
+				t.Errorf("Find(%q) = %q, want %q", tt.selector, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestCompileSelectorErrors(t *testing.T) {
+	for _, sel := range []string{"", "a[", "a[href=", "li:nth-child(x)", ":unknown", "a >", "a,"} {
+		t.Run(sel, func(t *testing.T) {
+			if _, err := CompileSelector(sel); err == nil {
+				t.Errorf("CompileSelector(%q) succeeded, want error", sel)
+			}
+		})
+	}
+}
+
+func TestSelectorDetachedNode(t *testing.T) {
+	doc := ParseHTML(`<p>a</p><span>b</span>`)
+	span := doc.First("span")
+	span.Parent = nil
+
+	// 脱离文档树的元素匹配兄弟组合器不能panic
+	for _, sel := range []string{"p ~ span", "p + span", "span:first-child", "div span"} {
+		if MustCompileSelector(sel).Match(span) && sel != "span:first-child" {
+			t.Errorf("%q matched a detached node", sel)
+		}
+	}
+}
+
+func TestSelectorCacheBounded(t *testing.T) {
+	doc := ParseHTML(selectorTestHTML)
+	for i := 0; i < maxCachedSelectors*2; i++ {
+		doc.Find(fmt.Sprintf(`a[data-id="%d"]`, i))
+	}
+
+	selectorCacheMu.Lock()
+	n, m := selectorCacheOrder.Len(), len(selectorCache)
+	selectorCacheMu.Unlock()
+	if n > maxCachedSelectors || m > maxCachedSelectors {
+		t.Errorf("selector cache holds %d/%d entries, limit %d", n, m, maxCachedSelectors)
+	}
+}
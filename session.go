@@ -0,0 +1,150 @@
+package crawlab
+
+import (
+	"fmt"
+	"os"
+	"sort"
+)
+
+// savedSession 导出到文件的会话
+type savedSession struct {
+	Headers map[string]string `json:"headers,omitempty"`
+	Profile string            `json:"profile,omitempty"` // RotatePerSession模式下固定的请求头名称
+	Cookies []SavedCookie     `json:"cookies"`
+}
+
+// Cookies 返回客户端的CookieJar
+//
+// 艹！Client.Jar被换成别的实现时，换回一个新的CookieJar
+func (c *HTTPClient) Cookies() *CookieJar {
+	if jar, ok := c.Client.Jar.(*CookieJar); ok {
+		return jar
+	}
+	if c.Client.Jar != nil {
+		LogWarn("HTTPClient jar is not a *CookieJar, replacing it")
+	}
+	jar := NewCookieJar()
+	c.Client.Jar = jar
+	return jar
+}
+
+// SaveCookies 导出Cookie到JSON文件
+func (c *HTTPClient) SaveCookies(path string) error {
+	return c.Cookies().Save(path)
+}
+
+// LoadCookies 从JSON文件导入Cookie，文件不存在不算错误
+func (c *HTTPClient) LoadCookies(path string) error {
+	return c.Cookies().Load(path)
+}
+
+// Session 获取命名会话，不存在则创建
+//
+// 艹！每个会话有自己的CookieJar和Header，多个账号同时登录互不干扰
+// 新会话从当前客户端克隆配置（超时、重试、限流、熔断），Cookie从空的开始
+//
+//	alice := client.Session("alice")
+//	alice.SetHeader("Authorization", "Bearer ...")
+//	alice.Get(ctx, url)
+func (c *HTTPClient) Session(name string) *HTTPClient {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if s, ok := c.sessions[name]; ok {
+		return s
+	}
+
+	s := c.Clone()
+	s.Client.Jar = NewCookieJar()
+	// 创建时就选好请求头，同一个seed下会话和请求头的对应关系固定
+	if s.Rotator != nil && s.Rotator.Mode == RotatePerSession {
+		p := s.Rotator.Next()
+		s.profile = &p
+	}
+	if c.sessions == nil {
+		c.sessions = make(map[string]*HTTPClient)
+	}
+	c.sessions[name] = s
+	return s
+}
+
+// Sessions 返回所有命名会话的名字（已排序）
+func (c *HTTPClient) Sessions() []string {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	names := make([]string, 0, len(c.sessions))
+	for name := range c.sessions {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// CloseSession 删除命名会话
+func (c *HTTPClient) CloseSession(name string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	delete(c.sessions, name)
+}
+
+// SaveSessions 把所有命名会话的Header和Cookie导出到JSON文件
+//
+// 艹！登录后的爬虫下次运行用LoadSessions接着跑，不用重新登录
+func (c *HTTPClient) SaveSessions(path string) error {
+	c.mu.Lock()
+	saved := make(map[string]savedSession, len(c.sessions))
+	for name, s := range c.sessions {
+		ss := savedSession{
+			Headers: s.Headers,
+			Cookies: s.Cookies().All(),
+		}
+		if p := s.Profile(); p != nil {
+			ss.Profile = p.Name
+		}
+		saved[name] = ss
+	}
+	c.mu.Unlock()
+
+	return writeJSONFile(path, saved)
+}
+
+// LoadSessions 从JSON文件恢复命名会话，文件不存在不算错误
+//
+// 艹！已经存在的会话会合并：Header覆盖，Cookie追加
+// 登录时用的请求头也会恢复，别让网站看到同一个Cookie换了个浏览器
+func (c *HTTPClient) LoadSessions(path string) error {
+	var saved map[string]savedSession
+	if err := readJSONFile(path, &saved); err != nil {
+		if os.IsNotExist(err) {
+			return nil
+		}
+		return fmt.Errorf("failed to load sessions: %w", err)
+	}
+
+	for name, ss := range saved {
+		s := c.Session(name)
+		s.SetHeaders(ss.Headers)
+		s.Cookies().Add(ss.Cookies...)
+		s.restoreProfile(ss.Profile)
+	}
+	LogInfo("Loaded %d sessions from %s", len(saved), path)
+	return nil
+}
+
+// restoreProfile 按名称恢复固定的请求头，找不到就保持原样
+func (c *HTTPClient) restoreProfile(name string) {
+	if name == "" || c.Rotator == nil {
+		return
+	}
+	for _, p := range c.Rotator.Profiles {
+		if p.Name == name {
+			p := p
+			c.mu.Lock()
+			c.profile = &p
+			c.mu.Unlock()
+			return
+		}
+	}
+	LogWarn("Header profile %s not found, keeping current profile", name)
+}
@@ -2,6 +2,8 @@ package crawlab
 
 import (
 	"context"
+	"errors"
+	"strconv"
 	"sync"
 	"sync/atomic"
 	"time"
@@ -16,30 +18,52 @@ type Spider interface {
 
 // Stats 爬虫统计信息
 type Stats struct {
-	ItemsSaved int64     // 保存的数据条数
-	Requests   int64     // 请求次数
-	Errors     int64     // 错误次数
-	StartTime  time.Time // 开始时间
+	ItemsSaved       int64     // 保存的数据条数
+	ItemsDropped     int64     // 异步队列满被丢弃的条数
+	ItemsUnsent      int64     // 异步队列序列化或发送失败的条数
+	ItemsFiltered    int64     // 被Pipeline丢弃的条数
+	ItemsQuarantined int64     // 校验不通过进了隔离区的条数
+	ItemsFailed      int64     // Pipeline处理失败的条数
+	ItemsDuplicate   int64     // 去重跳过的条数
+	Requests         int64     // 请求次数（真正联网的）
+	CacheHits        int64     // 直接从缓存返回、没有联网的请求次数
+	Errors           int64     // 错误次数
+	CircuitOpened    int64     // 熔断器打开次数
+	CircuitClosed    int64     // 熔断器恢复次数
+	StartTime        time.Time // 开始时间
+
+	Stages []StageStats // Pipeline各阶段统计（PrintStats时填充）
 }
 
 // SpiderContext 爬虫上下文
 type SpiderContext struct {
-	TaskID     string                // 任务ID
-	SpiderID   string                // 爬虫ID
-	NodeID     string                // 节点ID
-	Param      string                // 任务参数
-	ScheduleID string                // 调度ID
-	CancelFunc context.CancelFunc    // 取消函数
+	TaskID     string             // 任务ID
+	SpiderID   string             // 爬虫ID
+	NodeID     string             // 节点ID
+	Param      string             // 任务参数
+	ScheduleID string             // 调度ID
+	CancelFunc context.CancelFunc // 取消函数
 }
 
 // BaseSpider 基础爬虫实现
 //
 // 艹！嵌入到你的Spider里，自动获得统计、日志、保存等功能
 type BaseSpider struct {
-	Name    string         // 爬虫名称
-	Stats   *Stats         // 统计信息
-	Context *SpiderContext // 爬虫上下文
-	mu      sync.Mutex     // 保护Stats的并发访问
+	Name      string         // 爬虫名称
+	Stats     *Stats         // 统计信息
+	Context   *SpiderContext // 爬虫上下文
+	BatchSize int            // SaveBatch每批条数（默认读取CRAWLAB_BATCH_SIZE）
+
+	// DrainTimeout Execute结束时等待异步队列清空的最长时间（默认30秒）
+	DrainTimeout time.Duration
+
+	sink       *AsyncSink       // 异步队列，EnableAsync后才有
+	quarantine *WriterTransport // 校验隔离区文件，ValidationQuarantine模式才有
+	pipeline   *Pipeline        // 数据处理流水线，NewSpider时创建，Use往里加阶段
+	deduper    *Deduper         // 去重器，SetDeduper后才有
+	breakers   *HostBreakers    // 熔断器，TrackBreakers后才有
+	ctx        context.Context  // Execute的context，Pipeline阶段会拿到它
+	mu         sync.Mutex       // 保护Stats的并发访问
 }
 
 // NewSpider 创建一个新的BaseSpider
@@ -58,14 +82,177 @@ func NewSpider(name string) *BaseSpider {
 			Param:      GetParam(),
 			ScheduleID: GetScheduleID(),
 		},
+		BatchSize:    defaultBatchSize(),
+		pipeline:     NewPipeline(),
+		DrainTimeout: 30 * time.Second,
+	}
+}
+
+// defaultBatchSize 读取CRAWLAB_BATCH_SIZE，默认100
+func defaultBatchSize() int {
+	n, err := strconv.Atoi(GetEnv("CRAWLAB_BATCH_SIZE", "100"))
+	if err != nil || n < 1 {
+		LogWarn("Invalid CRAWLAB_BATCH_SIZE, using default 100")
+		return 100
+	}
+	return n
+}
+
+// EnableAsync 开启异步保存
+//
+// 艹！开启后Save只入队，后台按BatchSize攒批发送
+// Execute结束前会自动把队列清空，再打印统计
+func (s *BaseSpider) EnableAsync(queueSize int, mode BackpressureMode, flushInterval time.Duration) *AsyncSink {
+	w := NewBatchWriter(s.BatchSize, flushInterval)
+	w.OnFlush = func(r BatchResult) {
+		if r.Err != nil {
+			atomic.AddInt64(&s.Stats.Errors, 1)
+			atomic.AddInt64(&s.Stats.ItemsUnsent, int64(r.Items))
+			return
+		}
+		atomic.AddInt64(&s.Stats.ItemsSaved, int64(r.Items))
+	}
+
+	s.sink = NewAsyncSink(queueSize, mode, w)
+	return s.sink
+}
+
+// Flush 等待异步队列中的数据发送完成
+//
+// 艹！没开启异步时什么都不做
+func (s *BaseSpider) Flush(ctx context.Context) error {
+	if s.sink == nil {
+		return nil
+	}
+	return s.sink.Flush(ctx)
+}
+
+// Use 注册一个数据处理阶段
+//
+// 艹！Save/SaveBatch保存前会按注册顺序执行所有阶段
+func (s *BaseSpider) Use(name string, fn StageFunc) *BaseSpider {
+	s.pipeline.Use(name, fn)
+	return s
+}
+
+// EnableValidation 开启数据校验
+//
+// 艹！结构体按validate tag校验，map按schema校验
+// ValidationQuarantine模式下不合格数据写入 <Name>.quarantine.jsonl
+// 校验作为一个Pipeline阶段注册，注意和其他阶段的先后顺序
+func (s *BaseSpider) EnableValidation(mode ValidationMode, schema MapSchema) error {
+	var quarantine Transport
+	if mode == ValidationQuarantine {
+		t, err := NewFileTransport(s.Name + ".quarantine.jsonl")
+		if err != nil {
+			return err
+		}
+		s.quarantine = t
+		quarantine = t
 	}
+
+	s.Use("validate", ValidationStage(mode, schema, quarantine))
+	return nil
+}
+
+// SetDeduper 设置去重器
+//
+// 艹！Pipeline处理完之后再去重，重复数据单独计入Stats.ItemsDuplicate
+// BaseSpider只用自己的去重器，不受全局SetDeduper影响
+func (s *BaseSpider) SetDeduper(d *Deduper) {
+	s.deduper = d
+}
+
+// TrackBreakers 把熔断器的状态变化计入统计
+//
+// 艹！HTTPClient用的HostBreakers交给它，PrintStats会打印熔断次数和被拒绝的请求数
+//
+//	breakers := crawlab.NewHostBreakers(0.5, time.Minute, 30*time.Second)
+//	client.SetCircuitBreaker(breakers)
+//	spider.TrackBreakers(breakers)
+func (s *BaseSpider) TrackBreakers(h *HostBreakers) {
+	s.breakers = h
+	h.OnStateChange(func(host string, from, to CircuitState) {
+		switch to {
+		case CircuitOpen:
+			atomic.AddInt64(&s.Stats.CircuitOpened, 1)
+		case CircuitClosed:
+			atomic.AddInt64(&s.Stats.CircuitClosed, 1)
+		}
+	})
+}
+
+// process 执行Pipeline和去重
+//
+// 艹！返回ok=false表示数据不用保存（被丢弃、重复或处理失败）
+// 返回的ticket是预留的去重键，发送结束后必须done
+func (s *BaseSpider) process(item interface{}) (interface{}, dedupTicket, bool, error) {
+	item, ok, err := s.runPipeline(item)
+	if !ok {
+		return item, dedupTicket{}, ok, err
+	}
+
+	ticket, dup, err := s.deduper.reserve(item)
+	if err != nil {
+		atomic.AddInt64(&s.Stats.Errors, 1)
+		return nil, dedupTicket{}, false, err
+	}
+	if dup {
+		atomic.AddInt64(&s.Stats.ItemsDuplicate, 1)
+		return nil, dedupTicket{}, false, nil
+	}
+	return item, ticket, true, nil
+}
+
+// runPipeline 执行Pipeline
+func (s *BaseSpider) runPipeline(item interface{}) (interface{}, bool, error) {
+	if s.pipeline.Len() == 0 {
+		return item, true, nil
+	}
+
+	ctx := s.ctx
+	if ctx == nil {
+		ctx = context.Background()
+	}
+
+	out, err := s.pipeline.Process(ctx, item)
+	if err == nil {
+		return out, true, nil
+	}
+	if errors.Is(err, ErrItemQuarantined) {
+		atomic.AddInt64(&s.Stats.ItemsQuarantined, 1)
+		return nil, false, nil
+	}
+	if errors.Is(err, ErrDropItem) {
+		atomic.AddInt64(&s.Stats.ItemsFiltered, 1)
+		return nil, false, nil
+	}
+
+	atomic.AddInt64(&s.Stats.ItemsFailed, 1)
+	atomic.AddInt64(&s.Stats.Errors, 1)
+	return nil, false, err
 }
 
 // Save 保存单条数据
 //
 // 艹！自动更新统计信息
 func (s *BaseSpider) Save(item interface{}) error {
-	if err := SaveItem(item); err != nil {
+	item, ticket, ok, err := s.process(item)
+	if !ok {
+		return err
+	}
+
+	if s.sink != nil {
+		if err := s.sink.enqueue(item, ticket); err != nil {
+			atomic.AddInt64(&s.Stats.Errors, 1)
+			return err
+		}
+		return nil
+	}
+
+	err = saveItem(item)
+	ticket.done(err)
+	if err != nil {
 		atomic.AddInt64(&s.Stats.Errors, 1)
 		return err
 	}
@@ -75,14 +262,50 @@ func (s *BaseSpider) Save(item interface{}) error {
 
 // SaveBatch 批量保存数据
 //
-// 艹！一次保存多条，自动更新统计
+// 艹！按BatchSize和5MB上限自动分批，不用自己切片
+// 统计按实际发送成功的批次累加
 func (s *BaseSpider) SaveBatch(items []interface{}) error {
-	if err := SaveBatch(items); err != nil {
+	if len(items) == 0 {
+		return nil
+	}
+
+	// 先过Pipeline，失败的记下第一个错误，其余照常保存
+	var firstErr error
+	kept := make([]sinkEntry, 0, len(items))
+	for _, item := range items {
+		out, ticket, ok, err := s.process(item)
+		if err != nil && firstErr == nil {
+			firstErr = err
+		}
+		if ok {
+			kept = append(kept, sinkEntry{item: out, ticket: ticket})
+		}
+	}
+
+	w := NewBatchWriter(s.BatchSize, 0)
+	w.OnFlush = func(r BatchResult) {
+		if r.Err == nil {
+			atomic.AddInt64(&s.Stats.ItemsSaved, int64(r.Items))
+		}
+	}
+
+	for i, k := range kept {
+		if err := w.add(k.item, k.ticket); err != nil {
+			// 还没交给BatchWriter的数据不会发送，放掉它们的去重键
+			for _, rest := range kept[i+1:] {
+				rest.ticket.done(err)
+			}
+			w.Close()
+			atomic.AddInt64(&s.Stats.Errors, 1)
+			return err
+		}
+	}
+
+	if err := w.Close(); err != nil {
 		atomic.AddInt64(&s.Stats.Errors, 1)
 		return err
 	}
-	atomic.AddInt64(&s.Stats.ItemsSaved, int64(len(items)))
-	return nil
+	return firstErr
 }
 
 // LogInfo 输出INFO日志
@@ -108,6 +331,13 @@ func (s *BaseSpider) LogDebug(format string, args ...interface{}) {
 	LogDebug("[%s] "+format, append([]interface{}{s.Name}, args...)...)
 }
 
+// Logger 返回带spider字段的结构化日志器
+//
+// 用法：s.Logger().Info("page fetched", "url", u, "status", 200)
+func (s *BaseSpider) Logger() *Logger {
+	return GetLogger().With("spider", s.Name)
+}
+
 // IncRequests 增加请求计数
 //
 // 艹！爬取网页后记得调用
@@ -128,8 +358,36 @@ func (s *BaseSpider) PrintStats() {
 	s.LogInfo("========== 统计信息 ==========")
 	s.LogInfo("运行时间: %v", elapsed)
 	s.LogInfo("保存数据: %d 条", s.Stats.ItemsSaved)
+	if s.Stats.ItemsDropped > 0 {
+		s.LogInfo("丢弃数据: %d 条", s.Stats.ItemsDropped)
+	}
+	if s.Stats.ItemsUnsent > 0 {
+		s.LogInfo("发送失败: %d 条", s.Stats.ItemsUnsent)
+	}
+	if s.deduper != nil {
+		s.LogInfo("重复数据: %d 条", s.Stats.ItemsDuplicate)
+	}
+	if s.pipeline.Len() > 0 {
+		s.Stats.Stages = s.pipeline.Stats()
+		s.LogInfo("过滤数据: %d 条", s.Stats.ItemsFiltered)
+		if s.Stats.ItemsQuarantined > 0 {
+			s.LogInfo("隔离数据: %d 条", s.Stats.ItemsQuarantined)
+		}
+		s.LogInfo("处理失败: %d 条", s.Stats.ItemsFailed)
+		for _, st := range s.Stats.Stages {
+			s.LogInfo("  阶段[%s]: 处理 %d, 丢弃 %d, 跳过 %d, 失败 %d",
+				st.Name, st.Processed, st.Dropped, st.Skipped, st.Failed)
+		}
+	}
 	s.LogInfo("请求次数: %d 次", s.Stats.Requests)
+	if hits := atomic.LoadInt64(&s.Stats.CacheHits); hits > 0 {
+		s.LogInfo("缓存命中: %d 次", hits)
+	}
 	s.LogInfo("错误次数: %d 次", s.Stats.Errors)
+	if s.breakers != nil {
+		s.LogInfo("熔断次数: %d 次（恢复 %d 次，拒绝请求 %d 次）",
+			atomic.LoadInt64(&s.Stats.CircuitOpened), atomic.LoadInt64(&s.Stats.CircuitClosed), s.breakers.Rejected())
+	}
 	s.LogInfo("=============================")
 }
 
@@ -141,6 +399,7 @@ func (s *BaseSpider) Execute(spider Spider) error {
 	// 创建可取消的context
 	ctx, cancel := context.WithCancel(context.Background())
 	s.Context.CancelFunc = cancel
+	s.ctx = ctx
 	defer cancel()
 
 	// 捕获panic
@@ -148,8 +407,20 @@ func (s *BaseSpider) Execute(spider Spider) error {
 		if r := recover(); r != nil {
 			s.LogError("爬虫发生panic: %v", r)
 		}
+		// 先把异步队列清空，统计才准
+		s.closeSink()
+		if s.quarantine != nil {
+			s.quarantine.Close()
+		}
 		// 打印统计信息
 		s.PrintStats()
+		// 本地模式把数据落盘、关闭输出文件并打印文件位置
+		if t, ok := GetTransport().(*LocalTransport); ok {
+			if err := t.Close(); err != nil {
+				s.LogError("本地输出写入失败: %v", err)
+			}
+			t.PrintSummary()
+		}
 	}()
 
 	s.LogInfo("开始执行爬虫: %s", s.Name)
@@ -166,6 +437,22 @@ func (s *BaseSpider) Execute(spider Spider) error {
 	return nil
 }
 
+// closeSink 关闭异步队列并合并丢弃和失败计数
+func (s *BaseSpider) closeSink() {
+	if s.sink == nil {
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), s.DrainTimeout)
+	defer cancel()
+
+	if err := s.sink.Close(ctx); err != nil {
+		s.LogError("异步队列清空失败: %v", err)
+	}
+	atomic.AddInt64(&s.Stats.ItemsDropped, s.sink.Dropped())
+	atomic.AddInt64(&s.Stats.ItemsUnsent, s.sink.Failed())
+}
+
 // GetDuration 获取运行时长
 func (s *BaseSpider) GetDuration() time.Duration {
 	return time.Since(s.Stats.StartTime)
@@ -177,3 +464,10 @@ func (s *BaseSpider) GetDuration() time.Duration {
 func (s *BaseSpider) ParseParam(v interface{}) error {
 	return ParseParamJSON(v)
 }
+
+// BindParam 绑定任务参数到结构体
+//
+// 艹！支持default/env/required等tag，详见BindParams
+func (s *BaseSpider) BindParam(v interface{}) error {
+	return BindParams(v)
+}
@@ -0,0 +1,175 @@
+package crawlab
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"strings"
+	"sync"
+)
+
+// EnvIPCTransport IPC传输通道配置的环境变量
+//
+// 支持格式：stdout（默认）、stderr、local、file:/path/to/file、unix:/path/to/socket
+const EnvIPCTransport = "CRAWLAB_IPC_TRANSPORT"
+
+// Transport IPC消息传输通道
+//
+// 艹！SaveItem/SaveItems/SaveBatch最终都走这里
+// 实现必须是并发安全的，一条消息对应一行JSON，不能被别的goroutine插队
+type Transport interface {
+	Send(msg IPCMessage) error
+	Close() error
+}
+
+// WriterTransport 基于io.Writer的传输通道
+//
+// 艹！内部有锁，整行JSON一次性写入，并发调用不会串行
+type WriterTransport struct {
+	w      io.Writer
+	closer io.Closer
+	mu     sync.Mutex
+}
+
+// NewWriterTransport 创建写入任意io.Writer的传输通道
+//
+// 测试里传个bytes.Buffer就能拿到SaveItem输出的内容
+func NewWriterTransport(w io.Writer) *WriterTransport {
+	return &WriterTransport{w: w}
+}
+
+// NewStdoutTransport 创建写入stdout的传输通道（默认）
+func NewStdoutTransport() *WriterTransport {
+	return NewWriterTransport(os.Stdout)
+}
+
+// NewFileTransport 创建写入文件的传输通道
+//
+// 艹！文件以追加方式打开，不存在会自动创建
+func NewFileTransport(path string) (*WriterTransport, error) {
+	f, err := os.OpenFile(path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0644)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open IPC file %s: %w", path, err)
+	}
+	return &WriterTransport{w: f, closer: f}, nil
+}
+
+// NewUnixSocketTransport 创建写入Unix domain socket的传输通道
+func NewUnixSocketTransport(path string) (*WriterTransport, error) {
+	conn, err := net.Dial("unix", path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to connect IPC socket %s: %w", path, err)
+	}
+	return &WriterTransport{w: conn, closer: conn}, nil
+}
+
+// Send 序列化并发送一条IPC消息
+func (t *WriterTransport) Send(msg IPCMessage) error {
+	data, err := json.Marshal(msg)
+	if err != nil {
+		return fmt.Errorf("failed to marshal IPC message: %w", err)
+	}
+	data = append(data, '\n')
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	if _, err := t.w.Write(data); err != nil {
+		return fmt.Errorf("failed to write IPC message: %w", err)
+	}
+	return nil
+}
+
+// Close 关闭底层连接或文件
+//
+// 艹！stdout/stderr和外部传入的Writer不会被关闭
+func (t *WriterTransport) Close() error {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	if t.closer == nil {
+		return nil
+	}
+	err := t.closer.Close()
+	t.closer = nil
+	return err
+}
+
+// NewTransportFromSpec 根据配置字符串创建传输通道
+//
+// 艹！格式见EnvIPCTransport
+func NewTransportFromSpec(spec string) (Transport, error) {
+	spec = strings.TrimSpace(spec)
+	switch {
+	case spec == "" || spec == "stdout":
+		return NewStdoutTransport(), nil
+	case spec == "stderr":
+		return NewWriterTransport(os.Stderr), nil
+	case spec == "local":
+		return newLocalTransportFromEnv(), nil
+	case strings.HasPrefix(spec, "file:"):
+		return writerTransport(NewFileTransport(strings.TrimPrefix(spec, "file:")))
+	case strings.HasPrefix(spec, "unix:"):
+		return writerTransport(NewUnixSocketTransport(strings.TrimPrefix(spec, "unix:")))
+	default:
+		return nil, fmt.Errorf("unknown IPC transport: %s", spec)
+	}
+}
+
+// writerTransport 出错时返回真正的nil接口
+//
+// 艹！直接返回(*WriterTransport)(nil)的话接口不等于nil，调用方判断tr != nil就会踩空指针
+func writerTransport(t *WriterTransport, err error) (Transport, error) {
+	if err != nil {
+		return nil, err
+	}
+	return t, nil
+}
+
+var (
+	transportMu      sync.RWMutex
+	currentTransport Transport = defaultTransport()
+)
+
+// defaultTransport 默认传输通道
+//
+// 艹！本地模式写文件，在Crawlab里跑才写stdout
+func defaultTransport() Transport {
+	if IsLocalMode() {
+		return newLocalTransportFromEnv()
+	}
+	return NewStdoutTransport()
+}
+
+// SetTransport 替换全局IPC传输通道
+//
+// 艹！返回旧的通道，由调用方决定要不要Close
+// 传nil会恢复为stdout
+func SetTransport(t Transport) Transport {
+	if t == nil {
+		t = NewStdoutTransport()
+	}
+
+	transportMu.Lock()
+	defer transportMu.Unlock()
+
+	old := currentTransport
+	currentTransport = t
+	return old
+}
+
+// GetTransport 获取当前全局IPC传输通道
+func GetTransport() Transport {
+	transportMu.RLock()
+	defer transportMu.RUnlock()
+	return currentTransport
+}
+
+// SendIPCMessage 通过当前传输通道发送一条IPC消息
+//
+// 艹！一般用SaveItem就够了，自定义消息类型才用这个
+func SendIPCMessage(msg IPCMessage) error {
+	return GetTransport().Send(msg)
+}
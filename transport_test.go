@@ -0,0 +1,141 @@
+package crawlab
+
+import (
+	"bytes"
+	"net"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+)
+
+// closeTracker 记录是否被关闭的传输通道
+type closeTracker struct {
+	discardTransport
+	closed bool
+}
+
+func (c *closeTracker) Close() error {
+	c.closed = true
+	return nil
+}
+
+func TestNewTransportFromSpec(t *testing.T) {
+	dir := t.TempDir()
+	sock := filepath.Join(dir, "ipc.sock")
+	ln, err := net.Listen("unix", sock)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ln.Close()
+
+	tests := []struct {
+		spec    string
+		wantErr bool
+	}{
+		{"", false},
+		{"stdout", false},
+		{" stderr ", false},
+		{"local", false},
+		{"file:" + filepath.Join(dir, "ipc.jsonl"), false},
+		{"file:" + filepath.Join(dir, "missing", "ipc.jsonl"), true},
+		{"unix:" + sock, false},
+		{"unix:" + filepath.Join(dir, "nobody.sock"), true},
+		{"tcp://localhost:1", true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.spec, func(t *testing.T) {
+			tr, err := NewTransportFromSpec(tt.spec)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("err = %v, wantErr %v", err, tt.wantErr)
+			}
+			if tr != nil {
+				tr.Close()
+			}
+		})
+	}
+}
+
+func TestWriterTransportLines(t *testing.T) {
+	var buf bytes.Buffer
+	tr := NewWriterTransport(&buf)
+
+	// 并发发送，每条消息必须是完整的一行
+	var wg sync.WaitGroup
+	for i := 0; i < 50; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			tr.Send(IPCMessage{IPC: true, Type: "data", Payload: map[string]string{"k": strings.Repeat("v", 1000)}})
+		}()
+	}
+	wg.Wait()
+
+	lines := strings.Split(strings.TrimSuffix(buf.String(), "\n"), "\n")
+	if len(lines) != 50 {
+		t.Fatalf("got %d lines, want 50", len(lines))
+	}
+	for i, line := range lines {
+		if !strings.HasPrefix(line, `{"ipc":true,"type":"data"`) || !strings.HasSuffix(line, `"}}`) {
+			t.Fatalf("line %d is not a complete message: %.60s...", i, line)
+		}
+	}
+}
+
+func TestLoadConfigSwitchesTransport(t *testing.T) {
+	tests := []struct {
+		name       string
+		spec       string // 空表示不设置环境变量
+		wantSwitch bool
+	}{
+		{"not configured keeps the current transport", "", false},
+		{"file transport", "file:", true},
+		{"explicit stdout still switches", "stdout", true},
+		{"invalid spec keeps the current transport", "ftp://x", false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			path := filepath.Join(t.TempDir(), "ipc.jsonl")
+			spec := tt.spec
+			if spec == "file:" {
+				spec += path
+			}
+			t.Setenv(EnvIPCTransport, spec)
+			if spec == "" {
+				os.Unsetenv(EnvIPCTransport)
+			}
+
+			old := &closeTracker{}
+			useTransport(t, old)
+			LoadConfig()
+
+			current := GetTransport()
+			if switched := current != Transport(old); switched != tt.wantSwitch {
+				t.Fatalf("switched = %v, want %v", switched, tt.wantSwitch)
+			}
+			if old.closed != tt.wantSwitch {
+				t.Errorf("previous transport closed = %v, want %v", old.closed, tt.wantSwitch)
+			}
+			if !tt.wantSwitch {
+				return
+			}
+			defer current.Close()
+
+			if tt.spec == "file:" {
+				if err := SaveItem(map[string]string{"title": "t"}); err != nil {
+					t.Fatal(err)
+				}
+				data, err := os.ReadFile(path)
+				if err != nil {
+					t.Fatal(err)
+				}
+				if !strings.Contains(string(data), `"payload":{"title":"t"}`) {
+					t.Errorf("file content = %s", data)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,393 @@
+package crawlab
+
+import (
+	"context"
+	"fmt"
+	"net/url"
+	"reflect"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"unicode/utf8"
+)
+
+// ValidateTag 校验规则使用的struct tag名
+//
+// 艹！规则用逗号分隔：required、nonzero、url、min=N、max=N、enum=a|b|c、regex=表达式
+// regex里可能有逗号，所以regex必须写在最后
+// 例：Title string `json:"title" validate:"required,max=200"`
+const ValidateTag = "validate"
+
+// FieldError 单个字段的校验失败
+type FieldError struct {
+	Field   string `json:"field"`   // 字段名（优先用json tag）
+	Rule    string `json:"rule"`    // 失败的规则
+	Message string `json:"message"` // 说明
+}
+
+// ValidationError 校验失败，包含所有不合格字段
+type ValidationError struct {
+	Errors []FieldError
+}
+
+// Error 实现error接口
+func (e *ValidationError) Error() string {
+	parts := make([]string, 0, len(e.Errors))
+	for _, fe := range e.Errors {
+		parts = append(parts, fmt.Sprintf("%s: %s", fe.Field, fe.Message))
+	}
+	return fmt.Sprintf("validation failed (%d errors): %s", len(e.Errors), strings.Join(parts, "; "))
+}
+
+// MapSchema map数据的校验规则
+//
+// 艹！key是字段名，value和validate tag写法一样
+// 例：MapSchema{"title": "required,max=200", "url": "required,url"}
+type MapSchema map[string]string
+
+// Validate 按schema校验map数据
+func (s MapSchema) Validate(item map[string]interface{}) error {
+	fields := make([]string, 0, len(s))
+	for field := range s {
+		fields = append(fields, field)
+	}
+	sort.Strings(fields)
+
+	var errs []FieldError
+	for _, field := range fields {
+		rules := s[field]
+		v, ok := item[field]
+		var rv reflect.Value
+		if ok && v != nil {
+			rv = reflect.ValueOf(v)
+		}
+		errs = append(errs, checkRules(field, rv, rules)...)
+	}
+
+	if len(errs) > 0 {
+		return &ValidationError{Errors: errs}
+	}
+	return nil
+}
+
+// ValidateStruct 按validate tag校验结构体（或结构体指针）
+//
+// 艹！嵌套结构体也会递归校验，字段名用点号连接
+// 不是结构体的直接返回nil
+func ValidateStruct(item interface{}) error {
+	// 根指针也算走过，循环引用绕回来时不会在带前缀的路径下再校验一遍
+	visited := make(map[visitedPtr]bool)
+	rv := reflect.ValueOf(item)
+	for rv.Kind() == reflect.Ptr {
+		if rv.IsNil() {
+			return nil
+		}
+		visited[visitedPtr{rv.Pointer(), rv.Type()}] = true
+		rv = rv.Elem()
+	}
+	if rv.Kind() != reflect.Struct {
+		return nil
+	}
+
+	errs := validateStruct("", rv, visited)
+	if len(errs) > 0 {
+		return &ValidationError{Errors: errs}
+	}
+	return nil
+}
+
+// visitedPtr 递归时走过的指针，防止循环引用死循环
+type visitedPtr struct {
+	ptr uintptr
+	typ reflect.Type
+}
+
+// validateStruct 递归校验结构体字段
+func validateStruct(prefix string, rv reflect.Value, visited map[visitedPtr]bool) []FieldError {
+	var errs []FieldError
+	rt := rv.Type()
+
+	for i := 0; i < rt.NumField(); i++ {
+		sf := rt.Field(i)
+		if !sf.IsExported() {
+			continue
+		}
+
+		name := fieldName(sf)
+		if prefix != "" {
+			name = prefix + "." + name
+		}
+		fv := rv.Field(i)
+
+		if rules, ok := sf.Tag.Lookup(ValidateTag); ok && rules != "-" {
+			errs = append(errs, checkRules(name, fv, rules)...)
+		}
+
+		// 递归嵌套结构体，同一个指针只进去一次
+		inner := fv
+		seen := false
+		for inner.Kind() == reflect.Ptr && !inner.IsNil() {
+			key := visitedPtr{inner.Pointer(), inner.Type()}
+			if visited[key] {
+				seen = true
+				break
+			}
+			visited[key] = true
+			inner = inner.Elem()
+		}
+		if !seen && inner.Kind() == reflect.Struct {
+			errs = append(errs, validateStruct(name, inner, visited)...)
+		}
+	}
+
+	return errs
+}
+
+// fieldName 优先使用json tag里的名字
+func fieldName(sf reflect.StructField) string {
+	if tag := sf.Tag.Get("json"); tag != "" {
+		name := strings.Split(tag, ",")[0]
+		if name != "" && name != "-" {
+			return name
+		}
+	}
+	return sf.Name
+}
+
+// checkRules 对一个值执行全部规则
+//
+// 艹！值为空且不是required时，其余规则全部跳过；
+// 只有min/max例外，空字符串、空slice按长度0判断，min=1就是不能为空
+func checkRules(field string, v reflect.Value, rules string) []FieldError {
+	var errs []FieldError
+	fail := func(rule, format string, args ...interface{}) {
+		errs = append(errs, FieldError{Field: field, Rule: rule, Message: fmt.Sprintf(format, args...)})
+	}
+
+	// 解引用指针和interface
+	for v.IsValid() && (v.Kind() == reflect.Ptr || v.Kind() == reflect.Interface) {
+		if v.IsNil() {
+			v = reflect.Value{}
+			break
+		}
+		v = v.Elem()
+	}
+
+	empty := isEmptyValue(v)
+
+	for _, rule := range splitRules(rules) {
+		name, arg, _ := strings.Cut(rule, "=")
+
+		switch name {
+		case "required":
+			if empty {
+				fail("required", "is required")
+			}
+			continue
+		case "nonzero":
+			if !v.IsValid() || v.IsZero() {
+				fail("nonzero", "must not be zero")
+			}
+			continue
+		}
+
+		if empty && !(v.IsValid() && (name == "min" || name == "max")) {
+			continue
+		}
+
+		switch name {
+		case "min", "max":
+			limit, err := strconv.ParseFloat(arg, 64)
+			if err != nil {
+				fail(name, "invalid rule %q", rule)
+				continue
+			}
+			size, isLen, ok := measure(v)
+			if !ok {
+				fail(name, "rule %s is not supported for %s", name, v.Kind())
+				continue
+			}
+			label := "value"
+			if isLen {
+				label = "length"
+			}
+			if name == "min" && size < limit {
+				fail(name, "%s must be >= %s", label, arg)
+			}
+			if name == "max" && size > limit {
+				fail(name, "%s must be <= %s", label, arg)
+			}
+
+		case "regex":
+			re, err := compileRegex(arg)
+			if err != nil {
+				fail("regex", "invalid pattern %q: %v", arg, err)
+				continue
+			}
+			if v.Kind() != reflect.String || !re.MatchString(v.String()) {
+				fail("regex", "must match %s", arg)
+			}
+
+		case "enum":
+			got := fmt.Sprint(v.Interface())
+			allowed := strings.Split(arg, "|")
+			found := false
+			for _, a := range allowed {
+				if a == got {
+					found = true
+					break
+				}
+			}
+			if !found {
+				fail("enum", "must be one of [%s], got %q", strings.Join(allowed, ", "), got)
+			}
+
+		case "url":
+			if v.Kind() != reflect.String {
+				fail("url", "must be a string URL")
+				continue
+			}
+			u, err := url.Parse(v.String())
+			if err != nil || u.Scheme == "" || u.Host == "" {
+				fail("url", "must be an absolute URL, got %q", v.String())
+			}
+
+		default:
+			fail(name, "unknown rule %q", name)
+		}
+	}
+
+	return errs
+}
+
+// splitRules 拆分规则，regex=之后的内容整体算一条
+func splitRules(rules string) []string {
+	var result []string
+	for rules != "" {
+		if strings.HasPrefix(rules, "regex=") {
+			result = append(result, rules)
+			break
+		}
+		rule, rest, _ := strings.Cut(rules, ",")
+		if rule = strings.TrimSpace(rule); rule != "" {
+			result = append(result, rule)
+		}
+		rules = rest
+	}
+	return result
+}
+
+// measure 返回用于min/max比较的数值
+//
+// 艹！字符串按字符数，slice/map按长度，数字按值
+func measure(v reflect.Value) (size float64, isLen bool, ok bool) {
+	switch v.Kind() {
+	case reflect.String:
+		return float64(utf8.RuneCountInString(v.String())), true, true
+	case reflect.Slice, reflect.Map, reflect.Array:
+		return float64(v.Len()), true, true
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return float64(v.Int()), false, true
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return float64(v.Uint()), false, true
+	case reflect.Float32, reflect.Float64:
+		return v.Float(), false, true
+	}
+	return 0, false, false
+}
+
+// isEmptyValue 判断值是否为空（nil、空字符串、空slice/map）
+func isEmptyValue(v reflect.Value) bool {
+	if !v.IsValid() {
+		return true
+	}
+	switch v.Kind() {
+	case reflect.String, reflect.Slice, reflect.Map, reflect.Array:
+		return v.Len() == 0
+	}
+	return false
+}
+
+var regexCache sync.Map
+
+// compileRegex 编译并缓存正则
+func compileRegex(pattern string) (*regexp.Regexp, error) {
+	if re, ok := regexCache.Load(pattern); ok {
+		return re.(*regexp.Regexp), nil
+	}
+	re, err := regexp.Compile(pattern)
+	if err != nil {
+		return nil, err
+	}
+	regexCache.Store(pattern, re)
+	return re, nil
+}
+
+// ValidationMode 校验失败时的处理方式
+type ValidationMode int
+
+const (
+	// ValidationReject 拒绝保存并返回ValidationError（默认）
+	ValidationReject ValidationMode = iota
+	// ValidationWarn 只打警告，数据照常保存
+	ValidationWarn
+	// ValidationQuarantine 不保存，写入隔离区供事后排查
+	ValidationQuarantine
+)
+
+// ErrItemQuarantined 数据没通过校验被放进隔离区
+//
+// 艹！它包着ErrDropItem，Pipeline照样当丢弃处理，BaseSpider单独计入ItemsQuarantined
+var ErrItemQuarantined = fmt.Errorf("item quarantined: %w", ErrDropItem)
+
+// QuarantineRecord 隔离区中的一条记录
+type QuarantineRecord struct {
+	Item   interface{}  `json:"item"`
+	Errors []FieldError `json:"errors"`
+}
+
+// ValidationStage 创建校验阶段
+//
+// 艹！结构体按validate tag校验；map按schema校验（schema为nil则不校验map）
+// quarantine只在ValidationQuarantine模式下使用，为nil时只记日志
+func ValidationStage(mode ValidationMode, schema MapSchema, quarantine Transport) StageFunc {
+	return func(ctx context.Context, item interface{}) (interface{}, error) {
+		var err error
+		if m, ok := item.(map[string]interface{}); ok {
+			if schema != nil {
+				err = schema.Validate(m)
+			}
+		} else {
+			err = ValidateStruct(item)
+		}
+		if err == nil {
+			return item, nil
+		}
+
+		switch mode {
+		case ValidationWarn:
+			LogWarn("Invalid item saved anyway: %v", err)
+			return item, nil
+
+		case ValidationQuarantine:
+			var fieldErrs []FieldError
+			if ve, ok := err.(*ValidationError); ok {
+				fieldErrs = ve.Errors
+			}
+			if quarantine == nil {
+				LogWarn("Invalid item quarantined: %v", err)
+			} else if qerr := quarantine.Send(IPCMessage{
+				Type:    "quarantine",
+				Payload: QuarantineRecord{Item: item, Errors: fieldErrs},
+			}); qerr != nil {
+				LogError("Failed to write quarantine record: %v", qerr)
+			}
+			return nil, ErrItemQuarantined
+
+		default:
+			return nil, err
+		}
+	}
+}
@@ -0,0 +1,221 @@
+package crawlab
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"reflect"
+	"testing"
+)
+
+// recordingTransport 记下发送过的消息
+type recordingTransport struct {
+	msgs []IPCMessage
+}
+
+func (r *recordingTransport) Send(msg IPCMessage) error {
+	r.msgs = append(r.msgs, msg)
+	return nil
+}
+func (r *recordingTransport) Close() error { return nil }
+
+// failedRules 取出错误里所有的 字段:规则
+func failedRules(err error) []string {
+	var ve *ValidationError
+	if !errors.As(err, &ve) {
+		return nil
+	}
+	var out []string
+	for _, fe := range ve.Errors {
+		out = append(out, fe.Field+":"+fe.Rule)
+	}
+	return out
+}
+
+func TestMapSchemaValidate(t *testing.T) {
+	schema := MapSchema{
+		"title":  "required,max=5",
+		"url":    "url",
+		"price":  "min=0,max=100",
+		"status": "enum=on|off",
+		"sku":    "regex=^[A-Z]{2},[0-9]+$",
+		"count":  "nonzero",
+	}
+
+	tests := []struct {
+		name string
+		item map[string]interface{}
+		want []string
+	}{
+		{
+			"valid",
+			map[string]interface{}{"title": "中文标题", "url": "https://x.com/a", "price": 9.5, "status": "on", "sku": "AB,12", "count": 1},
+			nil,
+		},
+		{
+			"empty optional fields skip rules",
+			map[string]interface{}{"title": "t", "url": "", "count": 1},
+			nil,
+		},
+		{
+			"missing required",
+			map[string]interface{}{"count": 1},
+			[]string{"title:required"},
+		},
+		{
+			"nil counts as missing",
+			map[string]interface{}{"title": nil, "count": nil},
+			[]string{"count:nonzero", "title:required"},
+		},
+		{
+			"every rule fails",
+			map[string]interface{}{"title": "too long", "url": "/relative", "price": -1, "status": "maybe", "sku": "ab,12", "count": 0},
+			[]string{"count:nonzero", "price:min", "sku:regex", "status:enum", "title:max", "url:url"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := failedRules(schema.Validate(tt.item)); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("failed rules = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestValidateStruct(t *testing.T) {
+	type Seller struct {
+		Name string `json:"name" validate:"required"`
+	}
+	type Product struct {
+		Title  string   `json:"title" validate:"required,max=10"`
+		Tags   []string `json:"tags" validate:"min=1"`
+		Seller Seller   `json:"seller"`
+		Owner  *Seller  `validate:"required"`
+		Skip   string   `json:"-" validate:"-"`
+		hidden string   `validate:"required"`
+	}
+
+	tags := []string{"a"}
+	tests := []struct {
+		name string
+		item interface{}
+		want []string
+	}{
+		{"valid", &Product{Title: "t", Tags: tags, Seller: Seller{Name: "s"}, Owner: &Seller{Name: "o"}}, nil},
+		{"nested uses json names", Product{Title: "t", Tags: tags, Owner: &Seller{}}, []string{"seller.name:required", "Owner.name:required"}},
+		{"nil pointer is required", Product{Title: "t", Tags: tags, Seller: Seller{Name: "s"}}, []string{"Owner:required"}},
+		{"empty slice fails min", Product{Title: "t", Tags: []string{}, Seller: Seller{Name: "s"}, Owner: &Seller{Name: "o"}}, []string{"tags:min"}},
+		{"nil slice fails min", Product{Title: "t", Seller: Seller{Name: "s"}, Owner: &Seller{Name: "o"}}, []string{"tags:min"}},
+		{"not a struct", "text", nil},
+		{"nil pointer", (*Product)(nil), nil},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := failedRules(ValidateStruct(tt.item)); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("failed rules = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestValidateStructPointerCycle(t *testing.T) {
+	type Node struct {
+		Name string `json:"name" validate:"required"`
+		Next *Node  `json:"next"`
+	}
+
+	tests := []struct {
+		name  string
+		names [3]string // 三个节点连成环：0 -> 1 -> 2 -> 0
+		want  []string
+	}{
+		{"all valid", [3]string{"a", "b", "c"}, nil},
+		{"invalid inner node", [3]string{"a", "", "c"}, []string{"next.name:required"}},
+		{"invalid root", [3]string{"", "b", "c"}, []string{"name:required"}},
+	}
+
+	// 循环引用不能死循环，绕回根节点时也不能再校验一遍
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			nodes := make([]*Node, 3)
+			for i := range nodes {
+				nodes[i] = &Node{Name: tt.names[i]}
+			}
+			for i := range nodes {
+				nodes[i].Next = nodes[(i+1)%3]
+			}
+			if got := failedRules(ValidateStruct(nodes[0])); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("failed rules = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestFieldErrorJSON(t *testing.T) {
+	data, err := json.Marshal(FieldError{Field: "title", Rule: "required", Message: "is required"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := `{"field":"title","rule":"required","message":"is required"}`
+	if string(data) != want {
+		t.Errorf("json = %s, want %s", data, want)
+	}
+}
+
+func TestValidationStage(t *testing.T) {
+	schema := MapSchema{"title": "required"}
+	bad := map[string]interface{}{"price": 1}
+	good := map[string]interface{}{"title": "t"}
+
+	tests := []struct {
+		name       string
+		mode       ValidationMode
+		item       interface{}
+		wantItem   bool
+		wantErr    error
+		quarantine int
+	}{
+		{"valid passes", ValidationReject, good, true, nil, 0},
+		{"reject", ValidationReject, bad, false, nil, 0},
+		{"warn keeps item", ValidationWarn, bad, true, nil, 0},
+		{"quarantine", ValidationQuarantine, bad, false, ErrItemQuarantined, 1},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			q := &recordingTransport{}
+			out, err := ValidationStage(tt.mode, schema, q)(context.Background(), tt.item)
+
+			switch {
+			case tt.wantErr != nil:
+				if !errors.Is(err, tt.wantErr) || !errors.Is(err, ErrDropItem) {
+					t.Fatalf("err = %v, want %v wrapping ErrDropItem", err, tt.wantErr)
+				}
+			case tt.wantItem:
+				if err != nil {
+					t.Fatalf("err = %v, want nil", err)
+				}
+			default:
+				var ve *ValidationError
+				if !errors.As(err, &ve) {
+					t.Fatalf("err = %v, want *ValidationError", err)
+				}
+			}
+			if (out != nil) != tt.wantItem {
+				t.Errorf("item = %v, wantItem %v", out, tt.wantItem)
+			}
+
+			if len(q.msgs) != tt.quarantine {
+				t.Fatalf("quarantined %d items, want %d", len(q.msgs), tt.quarantine)
+			}
+			if tt.quarantine > 0 {
+				rec, ok := q.msgs[0].Payload.(QuarantineRecord)
+				if !ok || q.msgs[0].Type != "quarantine" || len(rec.Errors) != 1 || rec.Errors[0].Field != "title" {
+					t.Errorf("quarantine message = %+v", q.msgs[0])
+				}
+			}
+		})
+	}
+}